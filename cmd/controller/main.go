@@ -27,8 +27,11 @@ import (
 	"knative.dev/serving/pkg/reconciler/service"
 
 	// This defines the shared main for injected controllers.
+	filteredinformerfactory "knative.dev/pkg/client/injection/kube/informers/factory/filtered"
 	"knative.dev/pkg/injection"
 	"knative.dev/pkg/injection/sharedmain"
+	"knative.dev/pkg/signals"
+	"knative.dev/serving/pkg/apis/serving"
 )
 
 var ctors = []injection.ControllerConstructor{
@@ -42,5 +45,8 @@ var ctors = []injection.ControllerConstructor{
 }
 
 func main() {
-	sharedmain.Main("controller", ctors...)
+	// The revision reconciler only caches the ConfigMaps and Secrets labeled
+	// for revisions to reference.
+	ctx := filteredinformerfactory.WithSelectors(signals.NewContext(), serving.RevisionReferenceLabelKey)
+	sharedmain.MainWithContext(ctx, "controller", ctors...)
 }
@@ -18,13 +18,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -32,6 +36,7 @@ import (
 	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	network "knative.dev/networking/pkg"
@@ -58,6 +63,10 @@ const (
 	// reportingPeriod is the interval of time between reporting stats by queue proxy.
 	reportingPeriod = 1 * time.Second
 
+	// auditPeriod is the interval of time between audits of the breaker for
+	// leaked tokens.
+	auditPeriod = 1 * time.Minute
+
 	// Duration the /wait-for-drain handler should wait before returning.
 	// This is to give networking a little bit more time to remove the pod
 	// from its configuration and propagate that to all loadbalancers and nodes.
@@ -66,6 +75,8 @@ const (
 
 var (
 	startupProbeTimeout = flag.Duration("probe-timeout", -1, "run startup probe with given timeout")
+	sidecarProbe        = flag.String("sidecar-probe", "", "run the given JSON encoded sidecar readiness probe until it passes or -probe-timeout expires")
+	installPath         = flag.String("install", "", "copy this binary to the given path and exit")
 
 	// This creates an abstract socket instead of an actual file.
 	unixSocketPath = "@/knative.dev/serving/queue.sock"
@@ -79,6 +90,9 @@ type config struct {
 	ServingReadinessProbe    string `split_words:"true" required:"true"`
 	EnableProfiling          bool   `split_words:"true"` // optional
 	EnableHTTP2AutoDetection bool   `split_words:"true"` // optional
+	MaxRequestBodySize       int64  `split_words:"true"` // optional
+	EnforceRequestTimeout    bool   `split_words:"true"` // optional
+	ServingPreStopHook       string `split_words:"true"` // optional
 
 	// Logging configuration
 	ServingLoggingConfig         string `split_words:"true" required:"true"`
@@ -112,6 +126,16 @@ func init() {
 func main() {
 	flag.Parse()
 
+	// If this is set, we only install ourselves to gate the sidecars' startup.
+	if *installPath != "" {
+		os.Exit(installMain(*installPath))
+	}
+
+	// If this is set, we run from a sidecar's postStart hook to wait for it.
+	if *sidecarProbe != "" {
+		os.Exit(sidecarProbeMain(*sidecarProbe, *startupProbeTimeout))
+	}
+
 	// If this is set, we run as a standalone binary to probe the queue-proxy.
 	if *startupProbeTimeout >= 0 {
 		// Use a unix socket rather than TCP to avoid going via entire TCP stack
@@ -174,10 +198,23 @@ func main() {
 	probe := buildProbe(logger, env)
 	healthState := health.NewState()
 
-	mainServer := buildServer(ctx, env, healthState, probe, stats, logger)
+	breaker := buildBreaker(logger, env)
+	if breaker != nil {
+		auditTicker := time.NewTicker(auditPeriod)
+		defer auditTicker.Stop()
+		// Requests can't take longer than the revision timeout to respond,
+		// so tokens held for much longer than that most likely leaked.
+		maxHold := time.Duration(env.RevisionTimeoutSeconds)*time.Second + auditPeriod
+		go auditBreaker(logger, breaker, maxHold, auditTicker.C)
+
+		quitCh := make(chan os.Signal, 1)
+		signal.Notify(quitCh, syscall.SIGQUIT)
+		go dumpBreakerOnQuit(logger, breaker, quitCh)
+	}
+	mainServer := buildServer(ctx, env, healthState, probe, stats, breaker, logger)
 	servers := map[string]*http.Server{
 		"main":    mainServer,
-		"admin":   buildAdminServer(logger, healthState),
+		"admin":   buildAdminServer(logger, healthState, buildPreStopHook(logger, env)),
 		"metrics": buildMetricsServer(promStatReporter, protoStatReporter),
 	}
 	if env.EnableProfiling {
@@ -240,12 +277,7 @@ func main() {
 			logger.Infof("Sleeping %v to allow K8s propagation of non-ready state", drainSleepDuration)
 			time.Sleep(drainSleepDuration)
 
-			// Calling server.Shutdown() allows pending requests to
-			// complete, while no new work is accepted.
-			logger.Info("Shutting down main server")
-			if err := mainServer.Shutdown(context.Background()); err != nil {
-				logger.Errorw("Failed to shutdown proxy server", zap.Error(err))
-			}
+			shutdownMainServer(logger, mainServer, breaker, time.Duration(env.RevisionTimeoutSeconds)*time.Second)
 			// Removing the main server from the shutdown logic as we've already shut it down.
 			delete(servers, "main")
 		})
@@ -260,6 +292,28 @@ func main() {
 	}
 }
 
+// shutdownMainServer drains the breaker and gracefully shuts down the main
+// server afterwards. Draining rejects new requests, including those reaching
+// the user-container via the unix socket, while the executing and queued ones
+// get up to drainTimeout to complete.
+func shutdownMainServer(logger *zap.SugaredLogger, server *http.Server, breaker *queue.Breaker, drainTimeout time.Duration) {
+	if breaker != nil {
+		logger.Info("Draining the breaker")
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		if err := breaker.DrainAndWait(ctx); err != nil {
+			logger.Errorw("Requests still in flight after draining the breaker", zap.Error(err))
+		}
+	}
+
+	// Calling server.Shutdown() allows pending requests to
+	// complete, while no new work is accepted.
+	logger.Info("Shutting down main server")
+	if err := server.Shutdown(context.Background()); err != nil {
+		logger.Errorw("Failed to shutdown proxy server", zap.Error(err))
+	}
+}
+
 func buildProbe(logger *zap.SugaredLogger, env config) *readiness.Probe {
 	coreProbe, err := readiness.DecodeProbe(env.ServingReadinessProbe)
 	if err != nil {
@@ -271,7 +325,7 @@ func buildProbe(logger *zap.SugaredLogger, env config) *readiness.Probe {
 	return readiness.NewProbe(coreProbe)
 }
 
-func buildServer(ctx context.Context, env config, healthState *health.State, rp *readiness.Probe, stats *network.RequestStats,
+func buildServer(ctx context.Context, env config, healthState *health.State, rp *readiness.Probe, stats *network.RequestStats, breaker *queue.Breaker,
 	logger *zap.SugaredLogger) *http.Server {
 
 	maxIdleConns := 1000 // TODO: somewhat arbitrary value for CC=0, needs experimental validation.
@@ -283,11 +337,10 @@ func buildServer(ctx context.Context, env config, healthState *health.State, rp
 
 	httpProxy := pkghttp.NewHeaderPruningReverseProxy(target, pkghttp.NoHostOverride, activator.RevisionHeaders)
 	httpProxy.Transport = buildTransport(env, logger, maxIdleConns)
-	httpProxy.ErrorHandler = pkgnet.ErrorHandler(logger)
+	httpProxy.ErrorHandler = queue.TimeoutErrorHandler(queue.MaxBodySizeErrorHandler(pkgnet.ErrorHandler(logger)))
 	httpProxy.BufferPool = network.NewBufferPool()
 	httpProxy.FlushInterval = network.FlushInterval
 
-	breaker := buildBreaker(logger, env)
 	metricsSupported := supportsMetrics(ctx, logger, env)
 	tracingEnabled := env.TracingConfigBackend != tracingconfig.None
 	timeout := time.Duration(env.RevisionTimeoutSeconds) * time.Second
@@ -298,7 +351,19 @@ func buildServer(ctx context.Context, env config, healthState *health.State, rp
 	if metricsSupported {
 		composedHandler = requestAppMetricsHandler(logger, composedHandler, breaker, env)
 	}
-	composedHandler = queue.ProxyHandler(breaker, stats, tracingEnabled, composedHandler)
+	var onReject func()
+	if metricsSupported && breaker != nil {
+		var err error
+		onReject, err = queue.NewBreakerRejectionRecorder(env.ServingNamespace, env.ServingService,
+			env.ServingConfiguration, env.ServingRevision, env.ServingPod)
+		if err != nil {
+			logger.Errorw("Error setting up the breaker's rejection metric. It will be unavailable.", zap.Error(err))
+		}
+	}
+	composedHandler = queue.ProxyHandler(breaker, stats, tracingEnabled, onReject, composedHandler)
+	if env.MaxRequestBodySize > 0 {
+		composedHandler = queue.MaxBodySizeHandler(env.MaxRequestBodySize, composedHandler)
+	}
 	composedHandler = queue.ForwardedShimHandler(composedHandler)
 	composedHandler = handler.NewTimeToFirstByteTimeoutHandler(composedHandler, "request timeout", timeout)
 
@@ -346,18 +411,50 @@ func buildBreaker(logger *zap.SugaredLogger, env config) *queue.Breaker {
 		return nil
 	}
 
-	// We set the queue depth to be equal to the container concurrency * 10 to
-	// allow the autoscaler time to react.
-	queueDepth := 10 * env.ContainerConcurrency
-	params := queue.BreakerParams{
-		QueueDepth:      queueDepth,
-		MaxConcurrency:  env.ContainerConcurrency,
-		InitialCapacity: env.ContainerConcurrency,
+	params := queue.NewBreakerParams(env.ContainerConcurrency)
+	params.Logger = logger
+	// Allows auditBreaker to report leaked capacity.
+	params.TrackHolds = true
+	// Allows ProxyHandler to estimate when to retry rejected requests.
+	params.EstimateWait = true
+	if env.EnforceRequestTimeout {
+		// Otherwise the revision's timeout only limits the time to the first
+		// byte, which the timeout handler takes care of.
+		params.Timeout = time.Duration(env.RevisionTimeoutSeconds) * time.Second
+	}
+	if env.ServingRequestMetricsBackend != "" {
+		onWait, err := queue.NewBreakerWaitRecorder(env.ServingNamespace, env.ServingService,
+			env.ServingConfiguration, env.ServingRevision, env.ServingPod)
+		if err != nil {
+			logger.Errorw("Error setting up the breaker's wait time metric. It will be unavailable.", zap.Error(err))
+		}
+		params.OnWait = onWait
 	}
 	logger.Infof("Queue container is starting with BreakerParams = %#v", params)
 	return queue.NewBreaker(params)
 }
 
+// auditBreaker audits the breaker every time tick fires and logs a warning if
+// tokens were held for longer than maxHold or released twice.
+func auditBreaker(logger *zap.SugaredLogger, breaker *queue.Breaker, maxHold time.Duration, tick <-chan time.Time) {
+	for range tick {
+		if _, _, err := breaker.Audit(maxHold); err != nil {
+			logger.Warnw("Breaker tokens might have leaked", zap.Error(err), zap.Stringer("breaker", breaker))
+		}
+	}
+}
+
+// dumpBreakerOnQuit logs the breaker's state once a SIGQUIT is received and
+// re-raises the signal with its default handling restored, so that the
+// runtime's goroutine dump is accompanied by the breaker's state.
+func dumpBreakerOnQuit(logger *zap.SugaredLogger, breaker *queue.Breaker, quit <-chan os.Signal) {
+	<-quit
+	logger.Infow("Received QUIT signal, dumping breaker state", zap.Stringer("breaker", breaker))
+	flush(logger)
+	signal.Reset(syscall.SIGQUIT)
+	syscall.Kill(os.Getpid(), syscall.SIGQUIT)
+}
+
 func supportsMetrics(ctx context.Context, logger *zap.SugaredLogger, env config) bool {
 	// Setup request metrics reporting for end-user metrics.
 	if env.ServingRequestMetricsBackend == "" {
@@ -372,12 +469,50 @@ func supportsMetrics(ctx context.Context, logger *zap.SugaredLogger, env config)
 	return true
 }
 
-func buildAdminServer(logger *zap.SugaredLogger, healthState *health.State) *http.Server {
+// buildPreStopHook returns a function running the user-provided preStop hook,
+// if any. It only runs the hook once, no matter how many containers wait for
+// the drain, and keeps them all waiting until the hook finished.
+func buildPreStopHook(logger *zap.SugaredLogger, env config) func() {
+	if env.ServingPreStopHook == "" {
+		return nil
+	}
+	hook := &corev1.Handler{}
+	if err := json.Unmarshal([]byte(env.ServingPreStopHook), hook); err != nil || hook.HTTPGet == nil {
+		logger.Errorw("Failed to decode the preStop hook, it won't be run", zap.Error(err))
+		return nil
+	}
+	port, err := strconv.Atoi(env.UserPort)
+	if err != nil {
+		logger.Errorw("Failed to parse the user port, the preStop hook won't be run", zap.Error(err))
+		return nil
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// The hook gets another revision timeout on top of the drain, which
+			// the termination grace period accounts for.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(env.RevisionTimeoutSeconds)*time.Second)
+			defer cancel()
+			logger.Info("Running the preStop hook")
+			if err := queue.RunPreStopHook(ctx, hook.HTTPGet, port); err != nil {
+				logger.Errorw("The preStop hook failed", zap.Error(err))
+			}
+		})
+	}
+}
+
+func buildAdminServer(logger *zap.SugaredLogger, healthState *health.State, preStopHook func()) *http.Server {
 	adminMux := http.NewServeMux()
 	drainHandler := healthState.DrainHandlerFunc()
 	adminMux.HandleFunc(queue.RequestQueueDrainPath, func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Attached drain handler from user-container")
 		drainHandler(w, r)
+		// The user's hook only runs once all requests are drained, so the
+		// user container is still around to serve them.
+		if preStopHook != nil {
+			preStopHook()
+		}
 	})
 
 	return &http.Server{
@@ -17,15 +17,22 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/http/httputil"
 	"net/url"
+	"sync"
 	"testing"
 	"time"
 
 	"go.opencensus.io/plugin/ochttp"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
 
+	"k8s.io/apimachinery/pkg/util/wait"
 	network "knative.dev/networking/pkg"
 	pkgnet "knative.dev/pkg/network"
 	"knative.dev/pkg/tracing"
@@ -146,7 +153,7 @@ func TestQueueTraceSpans(t *testing.T) {
 					Propagation: tracecontextb3.TraceContextB3Egress,
 				}
 
-				h := queue.ProxyHandler(breaker, network.NewRequestStats(time.Now()), true /*tracingEnabled*/, proxy)
+				h := queue.ProxyHandler(breaker, network.NewRequestStats(time.Now()), true /*tracingEnabled*/, nil /*onReject*/, proxy)
 				h(writer, req)
 			} else {
 				h := health.ProbeHandler(healthState, tc.prober, true /* isAggressive*/, true /*tracingEnabled*/, nil)
@@ -188,3 +195,120 @@ func TestQueueTraceSpans(t *testing.T) {
 		})
 	}
 }
+
+func TestPreStopHookRunsOnce(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Inc()
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	logger := zap.NewNop().Sugar()
+	if hook := buildPreStopHook(logger, config{}); hook != nil {
+		t.Error("buildPreStopHook() = non-nil, want nil without a hook")
+	}
+	if hook := buildPreStopHook(logger, config{ServingPreStopHook: `{"exec":{"command":["/drain"]}}`}); hook != nil {
+		t.Error("buildPreStopHook() = non-nil, want nil for an exec hook")
+	}
+
+	hook := buildPreStopHook(logger, config{
+		ServingPreStopHook:     `{"httpGet":{"path":"/drain"}}`,
+		UserPort:               u.Port(),
+		RevisionTimeoutSeconds: 10,
+	})
+	// Every container waiting for the drain calls the hook.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hook()
+		}()
+	}
+	wg.Wait()
+	if got, want := calls.Load(), int32(1); got != want {
+		t.Errorf("Hook calls = %d, want: %d", got, want)
+	}
+}
+
+func TestShutdownMainServerDrainsBeforeShutdown(t *testing.T) {
+	breaker := queue.NewBreaker(queue.BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 10})
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := breaker.Maybe(r.Context(), func() {
+			close(started)
+			<-release
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		}
+	})}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen:", err)
+	}
+	go server.Serve(l)
+
+	respCh := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			t.Error("Request failed:", err)
+		}
+		respCh <- resp
+	}()
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		shutdownMainServer(zap.NewNop().Sugar(), server, breaker, time.Minute)
+	}()
+
+	// New requests are rejected right away, while the executing one holds up
+	// the shutdown.
+	if err := wait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		return errors.Is(breaker.Maybe(context.Background(), func() {}), queue.ErrDraining), nil
+	}); err != nil {
+		t.Fatal("The breaker was never drained:", err)
+	}
+	select {
+	case <-done:
+		t.Fatal("The server shut down before the executing request completed")
+	default:
+	}
+
+	close(release)
+	if resp := <-respCh; resp != nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("StatusCode = %d, want: %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+	<-done
+}
+
+func TestShutdownMainServerDrainTimeout(t *testing.T) {
+	breaker := queue.NewBreaker(queue.BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	release, ok := breaker.Reserve(context.Background())
+	if !ok {
+		t.Fatal("Reserve() = false, want true")
+	}
+	defer release()
+
+	// A request that never completes doesn't hold up the shutdown forever.
+	shutdownMainServer(zap.NewNop().Sugar(), &http.Server{}, breaker, 10*time.Millisecond)
+}
+
+func TestBuildBreaker(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	if b := buildBreaker(logger, config{ContainerConcurrency: 0}); b != nil {
+		t.Errorf("buildBreaker() = %v, want no breaker for unbounded concurrency", b)
+	}
+
+	// The breaker starts out with the full container concurrency.
+	b := buildBreaker(logger, config{ContainerConcurrency: 10})
+	if got, want := b.Capacity(), 10; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"knative.dev/serving/pkg/queue/readiness"
+)
+
+// To start the serving container only once its sidecars are ready, the Queue
+// Proxy binary is installed into a volume shared with the sidecars by an init
+// container when the `--install` flag is passed. The sidecars then run it from
+// their postStart hook with the `--sidecar-probe` flag, which blocks until the
+// given readiness probe passes. The kubelet doesn't start the next container
+// of the pod before the hook returned.
+
+// installMain copies the running binary to the given path.
+func installMain(path string) (exitCode int) {
+	if err := install(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func install(path string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the binary: %w", err)
+	}
+	src, err := os.Open(self)
+	if err != nil {
+		return fmt.Errorf("failed to open the binary: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to copy the binary to %s: %w", path, err)
+	}
+	return dst.Close()
+}
+
+// sidecarProbeMain runs the JSON encoded readiness probe until it passes or
+// the timeout expires.
+func sidecarProbeMain(encodedProbe string, timeout time.Duration) (exitCode int) {
+	if err := probeSidecar(encodedProbe, timeout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func probeSidecar(encodedProbe string, timeout time.Duration) error {
+	probe, err := readiness.DecodeProbe(encodedProbe)
+	if err != nil {
+		return fmt.Errorf("failed to decode the probe: %w", err)
+	}
+	// Probe once per poll rather than aggressively retrying within a probe.
+	if probe.PeriodSeconds <= 0 {
+		probe.PeriodSeconds = 1
+	}
+	if probe.TimeoutSeconds <= 0 {
+		probe.TimeoutSeconds = 1
+	}
+
+	p := readiness.NewProbe(probe)
+	if err := wait.PollImmediate(aggressivePollInterval, timeout, func() (bool, error) {
+		return p.ProbeContainer(), nil
+	}); err != nil {
+		return errors.New("sidecar did not become ready")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+func TestProbeSidecar(t *testing.T) {
+	var ready atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("%s is not a valid URL: %v", ts.URL, err)
+	}
+	probe := fmt.Sprintf(`{"httpGet":{"path":"/","port":%s,"host":"127.0.0.1","scheme":"HTTP"}}`, u.Port())
+
+	if err := probeSidecar(probe, 200*time.Millisecond); err == nil {
+		t.Error("probeSidecar() = nil, want an error for a sidecar that never becomes ready")
+	}
+
+	// The probe keeps polling until the sidecar becomes ready.
+	time.AfterFunc(200*time.Millisecond, func() { ready.Store(true) })
+	if err := probeSidecar(probe, 5*time.Second); err != nil {
+		t.Error("probeSidecar() =", err)
+	}
+}
+
+func TestProbeSidecarInvalidProbe(t *testing.T) {
+	if rv := sidecarProbeMain("not a probe", time.Second); rv != 1 {
+		t.Error("Unexpected return code", rv)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	if rv := installMain(path); rv != 0 {
+		t.Fatal("Unexpected return code", rv)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("Stat() =", err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("Installed binary mode = %v, want it to be executable", info.Mode())
+	}
+}
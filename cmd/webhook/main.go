@@ -37,6 +37,7 @@ import (
 	// resource validation types
 	net "knative.dev/networking/pkg/apis/networking/v1alpha1"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
+	"knative.dev/serving/pkg/apis/serving"
 	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
 	extravalidation "knative.dev/serving/pkg/webhook"
 
@@ -104,6 +105,10 @@ func newValidationAdmissionController(ctx context.Context, cmw configmap.Watcher
 	store := apisconfig.NewStore(logging.FromContext(ctx).Named("config-store"))
 	store.WatchConfigs(cmw)
 
+	// The deployment config carries the allow-list of tolerated taint keys.
+	deploymentStore := deployment.NewStore(logging.FromContext(ctx).Named("deployment-config-store"))
+	deploymentStore.WatchConfigs(cmw)
+
 	return validation.NewAdmissionController(ctx,
 
 		// Name of the resource webhook.
@@ -116,7 +121,13 @@ func newValidationAdmissionController(ctx context.Context, cmw configmap.Watcher
 		types,
 
 		// A function that infuses the context passed to Validate/SetDefaults with custom metadata.
-		store.ToContext,
+		func(ctx context.Context) context.Context {
+			ctx = store.ToContext(ctx)
+			if cfg := deploymentStore.Load(); cfg != nil {
+				ctx = serving.WithAllowedTolerationKeys(ctx, cfg.AllowedTolerationKeys)
+			}
+			return ctx
+		},
 
 		// Whether to disallow unknown fields.
 		true,
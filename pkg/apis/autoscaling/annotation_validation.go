@@ -57,6 +57,7 @@ func ValidateAnnotations(ctx context.Context, config *autoscalerconfig.Config, a
 		Also(validateWindow(anns)).
 		Also(validateLastPodRetention(anns)).
 		Also(validateScaleDownDelay(anns)).
+		Also(validateScaleToZero(anns)).
 		Also(validateMetric(anns)).
 		Also(validateAlgorithm(anns)).
 		Also(validateInitialScale(config, anns))
@@ -143,6 +144,15 @@ func validateScaleDownDelay(annotations map[string]string) *apis.FieldError {
 	return errs
 }
 
+func validateScaleToZero(annotations map[string]string) *apis.FieldError {
+	if v, ok := annotations[ScaleToZeroAnnotationKey]; ok {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return apis.ErrInvalidValue(v, ScaleToZeroAnnotationKey)
+		}
+	}
+	return nil
+}
+
 func validateLastPodRetention(annotations map[string]string) *apis.FieldError {
 	if w, ok := annotations[ScaleToZeroPodRetentionPeriodKey]; ok {
 		if d, err := time.ParseDuration(w); err != nil {
@@ -302,6 +302,13 @@ func TestValidateAnnotations(t *testing.T) {
 		name:        "invalid scale down delay",
 		annotations: map[string]string{ScaleDownDelayAnnotationKey: "twenty-two-minutes-and-five-seconds"},
 		expectErr:   "invalid value: twenty-two-minutes-and-five-seconds: " + ScaleDownDelayAnnotationKey,
+	}, {
+		name:        "valid scale to zero",
+		annotations: map[string]string{ScaleToZeroAnnotationKey: "false"},
+	}, {
+		name:        "invalid scale to zero",
+		annotations: map[string]string{ScaleToZeroAnnotationKey: "never"},
+		expectErr:   "invalid value: never: " + ScaleToZeroAnnotationKey,
 	}, {
 		name: "all together now fail",
 		annotations: map[string]string{
@@ -51,6 +51,12 @@ const (
 	// allow-zero-initial-scale of config-autoscaler is true.
 	InitialScaleAnnotationKey = GroupName + "/initialScale"
 
+	// ScaleToZeroAnnotationKey is the annotation to specify whether a revision
+	// may be scaled to zero. If set to "false", the revision still autoscales
+	// but never below a single replica, independent of minScale. For example,
+	//   autoscaling.knative.dev/scaleToZero: "false"
+	ScaleToZeroAnnotationKey = GroupName + "/scaleToZero"
+
 	// ScaleDownDelayAnnotationKey is the annotation to specify a scale down delay.
 	ScaleDownDelayAnnotationKey = GroupName + "/scaleDownDelay"
 
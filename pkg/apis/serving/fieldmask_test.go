@@ -151,6 +151,7 @@ func TestContainerMask(t *testing.T) {
 		ReadinessProbe:           &corev1.Probe{},
 		Resources:                corev1.ResourceRequirements{},
 		SecurityContext:          &corev1.SecurityContext{},
+		StartupProbe:             &corev1.Probe{},
 		TerminationMessagePath:   "/",
 		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
 		VolumeMounts:             []corev1.VolumeMount{{}},
@@ -167,6 +168,7 @@ func TestContainerMask(t *testing.T) {
 		ReadinessProbe:           &corev1.Probe{},
 		Resources:                corev1.ResourceRequirements{},
 		SecurityContext:          &corev1.SecurityContext{},
+		StartupProbe:             &corev1.Probe{},
 		TerminationMessagePath:   "/",
 		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
 		VolumeMounts:             []corev1.VolumeMount{{}},
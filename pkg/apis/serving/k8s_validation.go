@@ -79,6 +79,13 @@ var (
 		"http1",
 		"",
 	)
+
+	validTolerationEffects = sets.NewString(
+		"",
+		string(corev1.TaintEffectNoSchedule),
+		string(corev1.TaintEffectPreferNoSchedule),
+		string(corev1.TaintEffectNoExecute),
+	)
 )
 
 // ValidateVolumes validates the Volumes of a PodSpec.
@@ -308,6 +315,60 @@ func ValidatePodSpec(ctx context.Context, ps corev1.PodSpec) *apis.FieldError {
 			errs = errs.Also(apis.ErrInvalidValue("serviceAccountName", ps.ServiceAccountName))
 		}
 	}
+	allowedKeys := allowedTolerationKeysFromContext(ctx)
+	for i, toleration := range ps.Tolerations {
+		errs = errs.Also(validateToleration(toleration, allowedKeys).ViaFieldIndex("tolerations", i))
+	}
+	return errs
+}
+
+// validateToleration validates the structure of a single toleration, following
+// the rules the K8s API server applies to pod tolerations, and that its key is
+// in the operator's allow-list, unless that is empty.
+func validateToleration(t corev1.Toleration, allowedKeys sets.String) (errs *apis.FieldError) {
+	if allowedKeys.Len() > 0 && !allowedKeys.Has(t.Key) {
+		errs = errs.Also(&apis.FieldError{
+			Message: fmt.Sprintf("toleration for taint key %q is not allowed", t.Key),
+			Paths:   []string{"key"},
+		})
+	}
+	if t.Key != "" {
+		if verrs := validation.IsQualifiedName(t.Key); len(verrs) != 0 {
+			errs = errs.Also(apis.ErrInvalidValue(strings.Join(verrs, ", "), "key"))
+		}
+	} else if t.Operator != corev1.TolerationOpExists {
+		// An empty key matches all taints, which is only meaningful with Exists.
+		errs = errs.Also(&apis.FieldError{
+			Message: "operator must be Exists when key is empty",
+			Paths:   []string{"operator"},
+		})
+	}
+
+	switch t.Operator {
+	case corev1.TolerationOpEqual, "":
+		if verrs := validation.IsValidLabelValue(t.Value); len(verrs) != 0 {
+			errs = errs.Also(apis.ErrInvalidValue(strings.Join(verrs, ", "), "value"))
+		}
+	case corev1.TolerationOpExists:
+		if t.Value != "" {
+			errs = errs.Also(&apis.FieldError{
+				Message: "value must be empty when operator is Exists",
+				Paths:   []string{"value"},
+			})
+		}
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(t.Operator, "operator"))
+	}
+
+	if !validTolerationEffects.Has(string(t.Effect)) {
+		errs = errs.Also(apis.ErrInvalidValue(t.Effect, "effect"))
+	}
+	if t.TolerationSeconds != nil && t.Effect != corev1.TaintEffectNoExecute {
+		errs = errs.Also(&apis.FieldError{
+			Message: "tolerationSeconds may only be set when effect is NoExecute",
+			Paths:   []string{"tolerationSeconds"},
+		})
+	}
 	return errs
 }
 
@@ -368,6 +429,10 @@ func validateSidecarContainer(ctx context.Context, container corev1.Container, v
 		errs = errs.Also(apis.CheckDisallowedFields(*container.ReadinessProbe,
 			*ProbeMask(&corev1.Probe{})).ViaField("readinessProbe"))
 	}
+	if container.StartupProbe != nil {
+		errs = errs.Also(apis.CheckDisallowedFields(*container.StartupProbe,
+			*ProbeMask(&corev1.Probe{})).ViaField("startupProbe"))
+	}
 	return errs.Also(validate(ctx, container, volumes))
 }
 
@@ -379,6 +444,8 @@ func ValidateContainer(ctx context.Context, container corev1.Container, volumes
 	errs = errs.Also(validateProbe(container.LivenessProbe).ViaField("livenessProbe"))
 	// Readiness Probes
 	errs = errs.Also(validateReadinessProbe(container.ReadinessProbe).ViaField("readinessProbe"))
+	// Startup Probes
+	errs = errs.Also(validateProbe(container.StartupProbe).ViaField("startupProbe"))
 	return errs.Also(validate(ctx, container, volumes))
 }
 
@@ -444,7 +511,31 @@ func validateResources(resources *corev1.ResourceRequirements) *apis.FieldError
 	if resources == nil {
 		return nil
 	}
-	return apis.CheckDisallowedFields(*resources, *ResourceRequirementsMask(resources))
+	errs := apis.CheckDisallowedFields(*resources, *ResourceRequirementsMask(resources))
+	errs = errs.Also(validateExtendedResources("limits", resources.Limits))
+	errs = errs.Also(validateExtendedResources("requests", resources.Requests))
+	return errs
+}
+
+// validateExtendedResources rejects fractional quantities of extended resources
+// (like nvidia.com/gpu), which K8s only allows to be allocated in whole units.
+func validateExtendedResources(field string, list corev1.ResourceList) *apis.FieldError {
+	var errs *apis.FieldError
+	for name, q := range list {
+		if isExtendedResourceName(name) && q.MilliValue()%1000 != 0 {
+			errs = errs.Also(apis.ErrInvalidValue(q.String(), apis.CurrentField).ViaFieldKey(field, string(name)))
+		}
+	}
+	return errs
+}
+
+// isExtendedResourceName returns whether the given resource is an extended
+// resource, i.e. a fully-qualified name outside of the kubernetes.io domain.
+func isExtendedResourceName(name corev1.ResourceName) bool {
+	s := string(name)
+	return strings.Contains(s, "/") &&
+		!strings.Contains(s, corev1.ResourceDefaultNamespacePrefix) &&
+		!strings.HasPrefix(s, corev1.DefaultResourceRequestsPrefix)
 }
 
 func validateCapabilities(cap *corev1.Capabilities) *apis.FieldError {
@@ -638,6 +729,23 @@ func validateProbe(p *corev1.Probe) *apis.FieldError {
 	return errs
 }
 
+// ValidatePreStopHook validates a user-provided preStop hook. Only httpGet
+// handlers are supported, as the hook is run by the queue-proxy once it
+// drained. The hook is called on the user port, so it must not be specified.
+func ValidatePreStopHook(h *corev1.Handler) *apis.FieldError {
+	errs := apis.CheckDisallowedFields(*h, *HandlerMask(h))
+	if h.Exec != nil {
+		errs = errs.Also(apis.ErrDisallowedFields("exec"))
+	}
+	if h.TCPSocket != nil {
+		errs = errs.Also(apis.ErrDisallowedFields("tcpSocket"))
+	}
+	if h.HTTPGet == nil {
+		return errs.Also(apis.ErrMissingField("httpGet"))
+	}
+	return errs.Also(apis.CheckDisallowedFields(*h.HTTPGet, *HTTPGetActionMask(h.HTTPGet)).ViaField("httpGet"))
+}
+
 // ValidateNamespacedObjectReference validates an ObjectReference which may not contain a namespace.
 func ValidateNamespacedObjectReference(p *corev1.ObjectReference) *apis.FieldError {
 	if p == nil {
@@ -730,3 +838,20 @@ func WithinSidecarContainer(ctx context.Context) context.Context {
 func IsInSidecarContainer(ctx context.Context) bool {
 	return ctx.Value(sidecarContainer{}) != nil
 }
+
+// This is attached to contexts to carry the operator's allow-list of taint keys
+// revisions may tolerate.
+type allowedTolerationKeys struct{}
+
+// WithAllowedTolerationKeys notes on the context the taint keys tolerations are
+// validated against. An empty set allows any key.
+func WithAllowedTolerationKeys(ctx context.Context, keys sets.String) context.Context {
+	return context.WithValue(ctx, allowedTolerationKeys{}, keys)
+}
+
+// allowedTolerationKeysFromContext returns the allow-list of taint keys noted
+// on the context, if any.
+func allowedTolerationKeysFromContext(ctx context.Context) sets.String {
+	keys, _ := ctx.Value(allowedTolerationKeys{}).(sets.String)
+	return keys
+}
@@ -95,6 +95,7 @@ func TestPodSpecValidation(t *testing.T) {
 		name    string
 		ps      corev1.PodSpec
 		cfgOpts []configOption
+		allowed sets.String
 		want    *apis.FieldError
 	}{{
 		name: "valid",
@@ -241,6 +242,121 @@ func TestPodSpecValidation(t *testing.T) {
 			ServiceAccountName: "foo@bar.baz",
 		},
 		want: apis.ErrInvalidValue("serviceAccountName", "foo@bar.baz"),
+	}, {
+		name: "valid tolerations",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:      "dedicated",
+				Operator: corev1.TolerationOpEqual,
+				Value:    "gpu",
+				Effect:   corev1.TaintEffectNoSchedule,
+			}, {
+				Operator:          corev1.TolerationOpExists,
+				Effect:            corev1.TaintEffectNoExecute,
+				TolerationSeconds: ptr.Int64(30),
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+	}, {
+		name: "toleration with empty key and Equal operator",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Operator: corev1.TolerationOpEqual,
+				Value:    "gpu",
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+		want: (&apis.FieldError{
+			Message: "operator must be Exists when key is empty",
+			Paths:   []string{"operator"},
+		}).ViaFieldIndex("tolerations", 0),
+	}, {
+		name: "toleration with value and Exists operator",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:      "dedicated",
+				Operator: corev1.TolerationOpExists,
+				Value:    "gpu",
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+		want: (&apis.FieldError{
+			Message: "value must be empty when operator is Exists",
+			Paths:   []string{"value"},
+		}).ViaFieldIndex("tolerations", 0),
+	}, {
+		name: "toleration with bad operator and effect",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:      "dedicated",
+				Operator: "Matches",
+				Effect:   "NoEntry",
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+		want: apis.ErrInvalidValue("Matches", "operator").
+			Also(apis.ErrInvalidValue("NoEntry", "effect")).
+			ViaFieldIndex("tolerations", 0),
+	}, {
+		name: "toleration seconds without NoExecute",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:               "dedicated",
+				Operator:          corev1.TolerationOpExists,
+				Effect:            corev1.TaintEffectNoSchedule,
+				TolerationSeconds: ptr.Int64(30),
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+		want: (&apis.FieldError{
+			Message: "tolerationSeconds may only be set when effect is NoExecute",
+			Paths:   []string{"tolerationSeconds"},
+		}).ViaFieldIndex("tolerations", 0),
+	}, {
+		name: "allowed toleration key",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:      "dedicated",
+				Operator: corev1.TolerationOpExists,
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+		allowed: sets.NewString("dedicated"),
+	}, {
+		name: "disallowed toleration key",
+		ps: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Image: "busybox",
+			}},
+			Tolerations: []corev1.Toleration{{
+				Key:      "nvidia.com/gpu",
+				Operator: corev1.TolerationOpExists,
+			}},
+		},
+		cfgOpts: []configOption{withPodSpecTolerationsEnabled()},
+		allowed: sets.NewString("dedicated"),
+		want: (&apis.FieldError{
+			Message: `toleration for taint key "nvidia.com/gpu" is not allowed`,
+			Paths:   []string{"key"},
+		}).ViaFieldIndex("tolerations", 0),
 	}}
 
 	for _, test := range tests {
@@ -253,6 +369,9 @@ func TestPodSpecValidation(t *testing.T) {
 				}
 				ctx = config.ToContext(ctx, cfg)
 			}
+			if test.allowed != nil {
+				ctx = WithAllowedTolerationKeys(ctx, test.allowed)
+			}
 			got := ValidatePodSpec(ctx, test.ps)
 			if diff := cmp.Diff(test.want.Error(), got.Error()); diff != "" {
 				t.Errorf("ValidatePodSpec (-want, +got): \n%s", diff)
@@ -874,6 +993,37 @@ func TestContainerValidation(t *testing.T) {
 			},
 		},
 		want: nil,
+	}, {
+		name: "has extended resources",
+		c: corev1.Container{
+			Image: "foo",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					"nvidia.com/gpu": resource.MustParse("2"),
+				},
+				Requests: corev1.ResourceList{
+					"nvidia.com/gpu": resource.MustParse("2"),
+				},
+			},
+		},
+		want: nil,
+	}, {
+		name: "has fractional extended resources",
+		c: corev1.Container{
+			Image: "foo",
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					"nvidia.com/gpu": resource.MustParse("500m"),
+				},
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse("500m"),
+					"nvidia.com/gpu":   resource.MustParse("1.5"),
+				},
+			},
+		},
+		want: apis.ErrInvalidValue("500m", apis.CurrentField).ViaFieldKey("limits", "nvidia.com/gpu").Also(
+			apis.ErrInvalidValue("1500m", apis.CurrentField).ViaFieldKey("requests", "nvidia.com/gpu")).
+			ViaField("resources"),
 	}, {
 		name: "has no container ports set",
 		c: corev1.Container{
@@ -1161,6 +1311,30 @@ func TestContainerValidation(t *testing.T) {
 			},
 		},
 		want: nil,
+	}, {
+		name: "valid with startup probe",
+		c: corev1.Container{
+			Image: "foo",
+			StartupProbe: &corev1.Probe{
+				PeriodSeconds:    10,
+				FailureThreshold: 30,
+				Handler: corev1.Handler{
+					HTTPGet: &corev1.HTTPGetAction{
+						Path: "/started",
+					},
+				},
+			},
+		},
+		want: nil,
+	}, {
+		name: "invalid startup probe with no handler",
+		c: corev1.Container{
+			Image: "foo",
+			StartupProbe: &corev1.Probe{
+				PeriodSeconds: 10,
+			},
+		},
+		want: apis.ErrMissingOneOf("startupProbe.httpGet", "startupProbe.tcpSocket", "startupProbe.exec"),
 	}, {
 		name: "invalid with no handler",
 		c: corev1.Container{
@@ -73,6 +73,13 @@ const (
 	// which Revision triggered their creation.
 	RevisionLabelKey = GroupName + "/revision"
 
+	// RevisionReferenceLabelKey is the label key that marks the ConfigMaps and
+	// Secrets revisions take their environment from or use as image pull
+	// secrets. The revision reconciler only watches those carrying it, rather
+	// than all ConfigMaps and Secrets of the cluster, and considers the others
+	// missing. Its value is ignored.
+	RevisionReferenceLabelKey = GroupName + "/revisionReference"
+
 	// RevisionUID is the label key attached to a revision to indicate
 	// its unique identifier
 	RevisionUID = GroupName + "/revisionUID"
@@ -115,6 +122,71 @@ const (
 	// It has to be in [0.1,100]
 	QueueSideCarResourcePercentageAnnotation = "queue.sidecar." + GroupName + "/resourcePercentage"
 
+	// QueueSideCarReadinessFailureThresholdAnnotation is the number of consecutive
+	// failures of the queue-proxy readiness probe before the pod is marked unready.
+	// It has to be in [1,100]
+	QueueSideCarReadinessFailureThresholdAnnotation = "queue.sidecar." + GroupName + "/readinessFailureThreshold"
+
+	// QueueSideCarReadinessPeriodSecondsAnnotation is how often, in seconds, the
+	// queue-proxy readiness probe is performed.
+	// It has to be in [1,3600]
+	QueueSideCarReadinessPeriodSecondsAnnotation = "queue.sidecar." + GroupName + "/readinessPeriodSeconds"
+
+	// QueueSideCarMaxRequestBodySizeAnnotation is the maximum size of a request
+	// body the queue-proxy lets through to the user container, as a quantity,
+	// e.g. "10Mi". Larger requests are rejected with a 413. Unlimited if unset.
+	QueueSideCarMaxRequestBodySizeAnnotation = "queue.sidecar." + GroupName + "/maxRequestBodySize"
+
+	// QueueSideCarEnforceRequestTimeoutAnnotation opts a revision into failing
+	// requests that run longer than its timeoutSeconds in total with a 504, e.g.
+	//   queue.sidecar.serving.knative.dev/enforceRequestTimeout: "true"
+	// By default timeoutSeconds only limits the time to the first byte of the
+	// response. If enforced, streaming and websocket requests are cut off too.
+	QueueSideCarEnforceRequestTimeoutAnnotation = "queue.sidecar." + GroupName + "/enforceRequestTimeout"
+
+	// SidecarsFirstAnnotation controls whether the sidecar containers of a
+	// revision are started before its serving container, e.g.
+	//   serving.knative.dev/sidecarsFirst: "true"
+	// Sidecars with an HTTP or TCP readiness probe block in a postStart hook
+	// until that probe passes, and the kubelet only starts the next container
+	// once that hook finished. Other sidecars are merely declared first.
+	SidecarsFirstAnnotation = GroupName + "/sidecarsFirst"
+
+	// SidecarInjectAnnotation opts the pods of a revision out of automatic
+	// sidecar injection by a service mesh, e.g.
+	//   serving.knative.dev/sidecarInject: "false"
+	// It's translated to the mesh's own annotation configured as
+	// sidecarInjectAnnotation in config-deployment.
+	SidecarInjectAnnotation = GroupName + "/sidecarInject"
+
+	// LoggingURLTemplateAnnotation selects the logging URL template used for
+	// the revision's LogURL instead of the cluster-wide one. The template must
+	// be one of the allowedLoggingURLTemplates of config-deployment, otherwise
+	// it's ignored.
+	LoggingURLTemplateAnnotation = GroupName + "/loggingURLTemplate"
+
+	// PreStopHookAnnotation is a JSON encoded httpGet handler run as the preStop
+	// hook of the serving container, e.g.
+	//   serving.knative.dev/preStopHook: '{"httpGet":{"path":"/drain"}}'
+	// The queue-proxy calls it on the serving container's port once it drained
+	// all requests, so the port must not be specified. The hook may take up to
+	// the revision's timeoutSeconds, by which the termination grace period is
+	// extended.
+	PreStopHookAnnotation = GroupName + "/preStopHook"
+
+	// TopologyKeyAnnotation is the node label across which the pods of a revision
+	// are spread, overriding the cluster-wide default, e.g.
+	//   serving.knative.dev/topologyKey: kubernetes.io/hostname
+	// An empty value opts the revision out of spreading.
+	TopologyKeyAnnotation = GroupName + "/topologyKey"
+
+	// PublishNotReadyAddressesAnnotation opts the headless Service of a
+	// revision into publishing the DNS records of its pods before they're
+	// ready, e.g. for peers that need to discover each other while starting:
+	//   serving.knative.dev/publishNotReadyAddresses: "true"
+	// By default only ready pods are published.
+	PublishNotReadyAddressesAnnotation = GroupName + "/publishNotReadyAddresses"
+
 	// VisibilityClusterLocal is the label value for VisibilityLabelKey
 	// that will result to the Route/KService getting a cluster local
 	// domain suffix.
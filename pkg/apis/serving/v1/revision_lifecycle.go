@@ -46,6 +46,43 @@ const (
 	// false due to resource ownership issues.
 	ReasonNotOwned = "NotOwned"
 
+	// ReasonSelectorMismatch defines the reason for marking revision availability
+	// status as false if the revision's pods aren't matched by its deployment's selector.
+	ReasonSelectorMismatch = "SelectorMismatch"
+
+	// ReasonTolerationNotAllowed defines the reason for marking revision availability
+	// status as false if the revision tolerates a taint key the operator didn't allow.
+	ReasonTolerationNotAllowed = "TolerationNotAllowed"
+
+	// ReasonImagePullBackOff defines the reason for marking container healthiness
+	// status as false if the revision's container image cannot be pulled.
+	ReasonImagePullBackOff = "ImagePullBackOff"
+
+	// ReasonProbeFailed defines the reason for marking container healthiness status
+	// as false if the revision's pods keep failing their readiness probe.
+	ReasonProbeFailed = "ProbeFailed"
+
+	// ReasonRestartLoop defines the reason for marking container healthiness
+	// status as false if a container with a liveness probe keeps being restarted.
+	// The restarts aren't necessarily caused by the liveness probe, the container
+	// may as well keep exiting by itself.
+	ReasonRestartLoop = "RestartLoop"
+
+	// ReasonSidecarNotReady defines the reason for marking container healthiness
+	// status as false if a sidecar the serving container waits for doesn't
+	// become ready in time.
+	ReasonSidecarNotReady = "SidecarNotReady"
+
+	// ReasonMissingConfiguration defines the reason for marking container healthiness
+	// status as false if a ConfigMap or Secret referenced by the revision's
+	// environment doesn't exist.
+	ReasonMissingConfiguration = "MissingConfiguration"
+
+	// ReasonMissingPullSecret defines the reason for marking container healthiness
+	// status as false if an image pull secret referenced by the revision doesn't
+	// exist.
+	ReasonMissingPullSecret = "MissingPullSecret"
+
 	// ReasonProgressDeadlineExceeded defines the reason for marking revision availability
 	// status as false if progress has exceeded the deadline.
 	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
@@ -116,6 +153,23 @@ func (rs *RevisionStatus) MarkActiveUnknown(reason, message string) {
 	revisionCondSet.Manage(rs).MarkUnknown(RevisionConditionActive, reason, message)
 }
 
+// MarkImageCachedTrue marks ImageCached status on revision as True
+func (rs *RevisionStatus) MarkImageCachedTrue() {
+	revisionCondSet.Manage(rs).MarkTrue(RevisionConditionImageCached)
+}
+
+// MarkImageCachedFalse marks ImageCached status on revision as False. As the
+// condition is non-terminal, this doesn't affect the revision's readiness.
+func (rs *RevisionStatus) MarkImageCachedFalse(reason, message string) {
+	revisionCondSet.Manage(rs).MarkFalse(RevisionConditionImageCached, reason, "%s", message)
+}
+
+// ClearImageCached removes the ImageCached status from the revision.
+func (rs *RevisionStatus) ClearImageCached() {
+	// Clearing a non-terminal condition never fails.
+	_ = revisionCondSet.Manage(rs).ClearCondition(RevisionConditionImageCached)
+}
+
 // MarkContainerHealthyTrue marks ContainerHealthy status on revision as True
 func (rs *RevisionStatus) MarkContainerHealthyTrue() {
 	revisionCondSet.Manage(rs).MarkTrue(RevisionConditionContainerHealthy)
@@ -250,6 +304,40 @@ func RevisionContainerExitingMessage(message string) string {
 	return fmt.Sprint("Container failed with: ", message)
 }
 
+// RevisionContainerProbeFailedMessage constructs the status message if a
+// container keeps failing its readiness probe.
+func RevisionContainerProbeFailedMessage(message string) string {
+	return fmt.Sprint("Container failed readiness probe: ", message)
+}
+
+// RevisionContainerRestartingMessage constructs the status message if a
+// container with a liveness probe keeps being restarted.
+func RevisionContainerRestartingMessage(container string, restarts int32) string {
+	return fmt.Sprintf("Container %q with a liveness probe was restarted %d times", container, restarts)
+}
+
+// RevisionSidecarNotReadyMessage constructs the status message if a sidecar
+// the serving container waits for doesn't become ready in time.
+func RevisionSidecarNotReadyMessage(container, message string) string {
+	return fmt.Sprintf("Sidecar %q did not become ready before the serving container started: %s", container, message)
+}
+
+// RevisionConfigurationMissingMessage constructs the status message if a
+// ConfigMap or Secret referenced by the revision's environment doesn't exist
+// or isn't labeled with serving.RevisionReferenceLabelKey.
+func RevisionConfigurationMissingMessage(kind, name string) string {
+	return fmt.Sprintf("%s %q referenced by the container's environment does not exist or is not labeled %q",
+		kind, name, serving.RevisionReferenceLabelKey)
+}
+
+// RevisionPullSecretMissingMessage constructs the status message if an image
+// pull secret referenced by the revision doesn't exist or isn't labeled with
+// serving.RevisionReferenceLabelKey.
+func RevisionPullSecretMissingMessage(name string) string {
+	return fmt.Sprintf("image pull secret %q does not exist or is not labeled %q",
+		name, serving.RevisionReferenceLabelKey)
+}
+
 // RevisionContainerMissingMessage constructs the status message if a given image
 // cannot be pulled correctly.
 func RevisionContainerMissingMessage(image string, message string) string {
@@ -382,6 +382,35 @@ func TestTypicalFlowWithSuspendResume(t *testing.T) {
 	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
 }
 
+func TestImageCached(t *testing.T) {
+	r := &RevisionStatus{}
+	r.InitializeConditions()
+	r.MarkActiveTrue()
+	r.MarkContainerHealthyTrue()
+	r.MarkResourcesAvailableTrue()
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+
+	r.MarkImageCachedTrue()
+	apistest.CheckConditionSucceeded(r, RevisionConditionImageCached, t)
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+
+	// A failing image cache is surfaced but doesn't affect readiness.
+	const want = "PullFailed"
+	r.MarkImageCachedFalse(want, "no such image")
+	if got := r.GetCondition(RevisionConditionImageCached); got == nil || !got.IsFalse() || got.Reason != want {
+		t.Errorf("MarkImageCachedFalse = %v, want reason %q", got, want)
+	} else if got.Severity != apis.ConditionSeverityInfo {
+		t.Errorf("Severity = %q, want: %q", got.Severity, apis.ConditionSeverityInfo)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+
+	r.ClearImageCached()
+	if got := r.GetCondition(RevisionConditionImageCached); got != nil {
+		t.Errorf("ClearImageCached = %v, want nil", got)
+	}
+	apistest.CheckConditionSucceeded(r, RevisionConditionReady, t)
+}
+
 func TestRevisionNotOwnedStuff(t *testing.T) {
 	r := &RevisionStatus{}
 	r.InitializeConditions()
@@ -104,6 +104,11 @@ const (
 
 	// RevisionConditionActive is set when the revision is receiving traffic.
 	RevisionConditionActive apis.ConditionType = "Active"
+
+	// RevisionConditionImageCached is set when the caching.Images pinning the
+	// revision's images report their status. It is informational only and
+	// does not affect readiness.
+	RevisionConditionImageCached apis.ConditionType = "ImageCached"
 )
 
 // IsRevisionCondition returns true if the ConditionType is a revision condition type
@@ -113,7 +118,8 @@ func IsRevisionCondition(t apis.ConditionType) bool {
 		RevisionConditionReady,
 		RevisionConditionResourcesAvailable,
 		RevisionConditionContainerHealthy,
-		RevisionConditionActive:
+		RevisionConditionActive,
+		RevisionConditionImageCached:
 		return true
 	}
 	return false
@@ -165,6 +171,29 @@ type RevisionStatus struct {
 	// DesiredReplicas reflects the desired amount of pods running this revision.
 	// +optional
 	DesiredReplicas *int32 `json:"desiredReplicas,omitempty"`
+
+	// QueueProxyImage is the queue-proxy sidecar image the revision's
+	// deployment is currently configured with.
+	// +optional
+	QueueProxyImage string `json:"queueProxyImage,omitempty"`
+
+	// CurrentTarget is the per-pod target of the revision's scaling metric
+	// (concurrency or requests-per-second) the autoscaler is currently aiming
+	// for, after applying config defaults and annotation overrides.
+	// +optional
+	CurrentTarget string `json:"currentTarget,omitempty"`
+
+	// ScaleDownDelay is the effective time the autoscaler waits at reduced
+	// load before scaling the revision down. It's empty if scaling down isn't
+	// delayed.
+	// +optional
+	ScaleDownDelay string `json:"scaleDownDelay,omitempty"`
+
+	// MinReplicas is the effective minimum amount of pods the autoscaler keeps
+	// running this revision, after applying the minScale and scaleToZero
+	// annotations. It's unset if the revision may scale to zero.
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
 }
 
 // ContainerStatus holds the information of container name and image digest value
@@ -18,11 +18,15 @@ package v1
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/api/validation"
+	k8svalidation "k8s.io/apimachinery/pkg/util/validation"
 	"knative.dev/pkg/apis"
 	"knative.dev/pkg/kmp"
 	"knative.dev/serving/pkg/apis/autoscaling"
@@ -68,6 +72,14 @@ func (rts *RevisionTemplateSpec) Validate(ctx context.Context) *apis.FieldError
 	// it follows the requirements on the name.
 	errs = errs.Also(validateRevisionName(ctx, rts.Name, rts.GenerateName))
 	errs = errs.Also(validateQueueSidecarAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateTopologyKeyAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateQueueSidecarReadinessAnnotations(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateMaxRequestBodySizeAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validatePreStopHookAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateSidecarsFirstAnnotation(rts.Annotations, rts.Spec.Containers).ViaField("metadata.annotations"))
+	errs = errs.Also(validateSidecarInjectAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validateEnforceRequestTimeoutAnnotation(rts.Annotations).ViaField("metadata.annotations"))
+	errs = errs.Also(validatePublishNotReadyAddressesAnnotation(rts.Annotations).ViaField("metadata.annotations"))
 	return errs
 }
 
@@ -197,3 +209,127 @@ func validateQueueSidecarAnnotation(annotations map[string]string) *apis.FieldEr
 	}
 	return nil
 }
+
+// validateQueueSidecarReadinessAnnotations validates the queue-proxy readiness
+// probe tuning annotations, if present.
+func validateQueueSidecarReadinessAnnotations(annotations map[string]string) *apis.FieldError {
+	return validateIntAnnotation(annotations, serving.QueueSideCarReadinessFailureThresholdAnnotation, 1, 100).Also(
+		validateIntAnnotation(annotations, serving.QueueSideCarReadinessPeriodSecondsAnnotation, 1, 3600))
+}
+
+func validateIntAnnotation(annotations map[string]string, key string, min, max int64) *apis.FieldError {
+	v, ok := annotations[key]
+	if !ok {
+		return nil
+	}
+	value, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return apis.ErrInvalidValue(v, apis.CurrentField).ViaKey(key)
+	}
+	if value < min || value > max {
+		return apis.ErrOutOfBoundsValue(value, min, max, apis.CurrentField).ViaKey(key)
+	}
+	return nil
+}
+
+// validateMaxRequestBodySizeAnnotation validates that the max request body size
+// annotation, if present, is a positive quantity.
+func validateMaxRequestBodySizeAnnotation(annotations map[string]string) *apis.FieldError {
+	v, ok := annotations[serving.QueueSideCarMaxRequestBodySizeAnnotation]
+	if !ok {
+		return nil
+	}
+	q, err := resource.ParseQuantity(v)
+	if err != nil || q.Sign() <= 0 {
+		return apis.ErrInvalidValue(v, apis.CurrentField).
+			ViaKey(serving.QueueSideCarMaxRequestBodySizeAnnotation)
+	}
+	return nil
+}
+
+// validatePreStopHookAnnotation validates that the preStop hook annotation, if
+// present, holds a valid JSON encoded handler.
+func validatePreStopHookAnnotation(annotations map[string]string) *apis.FieldError {
+	v, ok := annotations[serving.PreStopHookAnnotation]
+	if !ok {
+		return nil
+	}
+	h := &corev1.Handler{}
+	if err := json.Unmarshal([]byte(v), h); err != nil {
+		return apis.ErrInvalidValue(v, apis.CurrentField).ViaKey(serving.PreStopHookAnnotation)
+	}
+	return serving.ValidatePreStopHook(h).ViaKey(serving.PreStopHookAnnotation)
+}
+
+// validateSidecarsFirstAnnotation validates that the sidecars first annotation,
+// if present, is a boolean and that there are sidecars to start first.
+func validateSidecarsFirstAnnotation(annotations map[string]string, containers []corev1.Container) *apis.FieldError {
+	v, ok := annotations[serving.SidecarsFirstAnnotation]
+	if !ok {
+		return nil
+	}
+	first, err := strconv.ParseBool(v)
+	if err != nil {
+		return apis.ErrInvalidValue(v, apis.CurrentField).ViaKey(serving.SidecarsFirstAnnotation)
+	}
+	if first && len(containers) < 2 {
+		return (&apis.FieldError{
+			Message: "sidecars cannot be started first without sidecar containers",
+			Paths:   []string{apis.CurrentField},
+		}).ViaKey(serving.SidecarsFirstAnnotation)
+	}
+	return nil
+}
+
+// validateSidecarInjectAnnotation validates that the sidecar inject
+// annotation, if present, is a boolean.
+func validateSidecarInjectAnnotation(annotations map[string]string) *apis.FieldError {
+	v, ok := annotations[serving.SidecarInjectAnnotation]
+	if !ok {
+		return nil
+	}
+	if _, err := strconv.ParseBool(v); err != nil {
+		return apis.ErrInvalidValue(v, apis.CurrentField).ViaKey(serving.SidecarInjectAnnotation)
+	}
+	return nil
+}
+
+// validateEnforceRequestTimeoutAnnotation validates that the enforce request
+// timeout annotation, if present, is a boolean.
+func validateEnforceRequestTimeoutAnnotation(annotations map[string]string) *apis.FieldError {
+	v, ok := annotations[serving.QueueSideCarEnforceRequestTimeoutAnnotation]
+	if !ok {
+		return nil
+	}
+	if _, err := strconv.ParseBool(v); err != nil {
+		return apis.ErrInvalidValue(v, apis.CurrentField).ViaKey(serving.QueueSideCarEnforceRequestTimeoutAnnotation)
+	}
+	return nil
+}
+
+// validatePublishNotReadyAddressesAnnotation validates that the publish not
+// ready addresses annotation, if present, is a boolean.
+func validatePublishNotReadyAddressesAnnotation(annotations map[string]string) *apis.FieldError {
+	v, ok := annotations[serving.PublishNotReadyAddressesAnnotation]
+	if !ok {
+		return nil
+	}
+	if _, err := strconv.ParseBool(v); err != nil {
+		return apis.ErrInvalidValue(v, apis.CurrentField).ViaKey(serving.PublishNotReadyAddressesAnnotation)
+	}
+	return nil
+}
+
+// validateTopologyKeyAnnotation validates that the topology key annotation, if
+// present, is a valid label key. An empty value opts out of spreading.
+func validateTopologyKeyAnnotation(annotations map[string]string) *apis.FieldError {
+	v, ok := annotations[serving.TopologyKeyAnnotation]
+	if !ok || v == "" {
+		return nil
+	}
+	if verrs := k8svalidation.IsQualifiedName(v); len(verrs) != 0 {
+		return apis.ErrInvalidValue(strings.Join(verrs, ", "), apis.CurrentField).
+			ViaKey(serving.TopologyKeyAnnotation)
+	}
+	return nil
+}
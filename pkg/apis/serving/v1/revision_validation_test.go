@@ -1054,6 +1054,371 @@ func TestValidateQueueSidecarAnnotation(t *testing.T) {
 	}
 }
 
+func TestValidateQueueSidecarReadinessAnnotations(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "valid values",
+		annotation: map[string]string{
+			serving.QueueSideCarReadinessFailureThresholdAnnotation: "5",
+			serving.QueueSideCarReadinessPeriodSecondsAnnotation:    "10",
+		},
+	}, {
+		name: "failure threshold too small",
+		annotation: map[string]string{
+			serving.QueueSideCarReadinessFailureThresholdAnnotation: "0",
+		},
+		expectErr: &apis.FieldError{
+			Message: "expected 1 <= 0 <= 100",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.QueueSideCarReadinessFailureThresholdAnnotation)},
+		},
+	}, {
+		name: "period too big",
+		annotation: map[string]string{
+			serving.QueueSideCarReadinessPeriodSecondsAnnotation: "3601",
+		},
+		expectErr: &apis.FieldError{
+			Message: "expected 1 <= 3601 <= 3600",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.QueueSideCarReadinessPeriodSecondsAnnotation)},
+		},
+	}, {
+		name: "invalid period",
+		annotation: map[string]string{
+			serving.QueueSideCarReadinessPeriodSecondsAnnotation: "1s",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: 1s",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.QueueSideCarReadinessPeriodSecondsAnnotation)},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateQueueSidecarReadinessAnnotations(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateMaxRequestBodySizeAnnotation(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "valid size",
+		annotation: map[string]string{
+			serving.QueueSideCarMaxRequestBodySizeAnnotation: "10Mi",
+		},
+	}, {
+		name: "invalid size",
+		annotation: map[string]string{
+			serving.QueueSideCarMaxRequestBodySizeAnnotation: "ten megs",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: ten megs",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.QueueSideCarMaxRequestBodySizeAnnotation)},
+		},
+	}, {
+		name: "zero size",
+		annotation: map[string]string{
+			serving.QueueSideCarMaxRequestBodySizeAnnotation: "0",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: 0",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.QueueSideCarMaxRequestBodySizeAnnotation)},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateMaxRequestBodySizeAnnotation(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateTopologyKeyAnnotation(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "valid topology key",
+		annotation: map[string]string{
+			serving.TopologyKeyAnnotation: "topology.kubernetes.io/zone",
+		},
+	}, {
+		name: "opt out of spreading",
+		annotation: map[string]string{
+			serving.TopologyKeyAnnotation: "",
+		},
+	}, {
+		name: "invalid topology key",
+		annotation: map[string]string{
+			serving.TopologyKeyAnnotation: "not a/valid/key",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: a qualified name must consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyName',  or 'my.name',  or '123-abc', regex used for validation is '([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]') with an optional DNS subdomain prefix and '/' (e.g. 'example.com/MyName')",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.TopologyKeyAnnotation)},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateTopologyKeyAnnotation(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateSidecarInjectAnnotation(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "opt out",
+		annotation: map[string]string{
+			serving.SidecarInjectAnnotation: "false",
+		},
+	}, {
+		name: "not a boolean",
+		annotation: map[string]string{
+			serving.SidecarInjectAnnotation: "nope",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: nope",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.SidecarInjectAnnotation)},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateSidecarInjectAnnotation(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateEnforceRequestTimeoutAnnotation(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "enforced",
+		annotation: map[string]string{
+			serving.QueueSideCarEnforceRequestTimeoutAnnotation: "true",
+		},
+	}, {
+		name: "not a boolean",
+		annotation: map[string]string{
+			serving.QueueSideCarEnforceRequestTimeoutAnnotation: "always",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: always",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.QueueSideCarEnforceRequestTimeoutAnnotation)},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateEnforceRequestTimeoutAnnotation(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidatePublishNotReadyAddressesAnnotation(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "published",
+		annotation: map[string]string{
+			serving.PublishNotReadyAddressesAnnotation: "true",
+		},
+	}, {
+		name: "not a boolean",
+		annotation: map[string]string{
+			serving.PublishNotReadyAddressesAnnotation: "sometimes",
+		},
+		expectErr: &apis.FieldError{
+			Message: "invalid value: sometimes",
+			Paths:   []string{fmt.Sprintf("[%s]", serving.PublishNotReadyAddressesAnnotation)},
+		},
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validatePublishNotReadyAddressesAnnotation(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidatePreStopHookAnnotation(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+	}, {
+		name: "httpGet hook",
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{"httpGet":{"path":"/drain"}}`,
+		},
+	}, {
+		name: "malformed hook",
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{"exec":`,
+		},
+		expectErr: apis.ErrInvalidValue(`{"exec":`, apis.CurrentField).
+			ViaKey(serving.PreStopHookAnnotation),
+	}, {
+		name: "no handler",
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{}`,
+		},
+		expectErr: apis.ErrMissingField("httpGet").
+			ViaKey(serving.PreStopHookAnnotation),
+	}, {
+		name: "exec hook",
+		// The queue-proxy can't run commands in the serving container.
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{"exec":{"command":["/drain"]}}`,
+		},
+		expectErr: apis.ErrDisallowedFields("exec").
+			Also(apis.ErrMissingField("httpGet")).
+			ViaKey(serving.PreStopHookAnnotation),
+	}, {
+		name: "exec and httpGet",
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{"exec":{"command":["/drain"]},"httpGet":{"path":"/drain"}}`,
+		},
+		expectErr: apis.ErrDisallowedFields("exec").
+			ViaKey(serving.PreStopHookAnnotation),
+	}, {
+		name: "tcpSocket hook",
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{"tcpSocket":{"port":8080}}`,
+		},
+		expectErr: apis.ErrDisallowedFields("tcpSocket").
+			Also(apis.ErrMissingField("httpGet")).
+			ViaKey(serving.PreStopHookAnnotation),
+	}, {
+		name: "httpGet with port",
+		annotation: map[string]string{
+			serving.PreStopHookAnnotation: `{"httpGet":{"path":"/drain","port":8080}}`,
+		},
+		expectErr: apis.ErrDisallowedFields("httpGet.port").
+			ViaKey(serving.PreStopHookAnnotation),
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validatePreStopHookAnnotation(c.annotation)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateSidecarsFirstAnnotation(t *testing.T) {
+	sidecars := []corev1.Container{{
+		Image: "busybox",
+		Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+	}, {
+		Image: "ubuntu",
+	}}
+	cases := []struct {
+		name       string
+		annotation map[string]string
+		containers []corev1.Container
+		expectErr  *apis.FieldError
+	}{{
+		name:       "empty annotation",
+		annotation: map[string]string{},
+		containers: sidecars[:1],
+	}, {
+		name: "sidecars first",
+		annotation: map[string]string{
+			serving.SidecarsFirstAnnotation: "true",
+		},
+		containers: sidecars,
+	}, {
+		name: "sidecars not first without sidecars",
+		annotation: map[string]string{
+			serving.SidecarsFirstAnnotation: "false",
+		},
+		containers: sidecars[:1],
+	}, {
+		name: "invalid value",
+		annotation: map[string]string{
+			serving.SidecarsFirstAnnotation: "yes please",
+		},
+		containers: sidecars,
+		expectErr: apis.ErrInvalidValue("yes please", apis.CurrentField).
+			ViaKey(serving.SidecarsFirstAnnotation),
+	}, {
+		name: "sidecars first without sidecars",
+		annotation: map[string]string{
+			serving.SidecarsFirstAnnotation: "true",
+		},
+		containers: sidecars[:1],
+		expectErr: (&apis.FieldError{
+			Message: "sidecars cannot be started first without sidecar containers",
+			Paths:   []string{apis.CurrentField},
+		}).ViaKey(serving.SidecarsFirstAnnotation),
+	}}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateSidecarsFirstAnnotation(c.annotation, c.containers)
+			if got, want := err.Error(), c.expectErr.Error(); got != want {
+				t.Errorf("Got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
 func TestValidateTimeoutSecond(t *testing.T) {
 	cases := []struct {
 		name      string
@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake registers a fake PodDisruptionBudget informer for tests.
+package fake
+
+import (
+	context "context"
+
+	fake "knative.dev/pkg/client/injection/kube/informers/factory/fake"
+	controller "knative.dev/pkg/controller"
+	injection "knative.dev/pkg/injection"
+	poddisruptionbudget "knative.dev/serving/pkg/client/injection/kube/informers/policy/v1beta1/poddisruptionbudget"
+)
+
+var Get = poddisruptionbudget.Get
+
+func init() {
+	injection.Fake.RegisterInformer(withInformer)
+}
+
+func withInformer(ctx context.Context) (context.Context, controller.Informer) {
+	f := fake.Get(ctx)
+	inf := f.Policy().V1beta1().PodDisruptionBudgets()
+	return context.WithValue(ctx, poddisruptionbudget.Key{}, inf), inf.Informer()
+}
@@ -19,6 +19,7 @@ package deployment
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -52,6 +53,51 @@ const (
 	// (e.g. ko.local) where tags should not be resolved to digests.
 	registriesSkippingTagResolvingKey = "registriesSkippingTagResolving"
 
+	// allowedTolerationKeysKey is the config map key for the set of taint keys
+	// revisions are allowed to tolerate.
+	allowedTolerationKeysKey = "allowedTolerationKeys"
+
+	// allowedLoggingURLTemplatesKey is the config map key for the set of
+	// logging URL templates revisions may select via annotation.
+	allowedLoggingURLTemplatesKey = "allowedLoggingURLTemplates"
+
+	// disableImageCacheKey is the config map key to stop creating
+	// caching.knative.dev Images for revisions.
+	disableImageCacheKey = "disableImageCache"
+
+	// enableNetworkPolicyKey is the config map key to isolate revision pods
+	// with a NetworkPolicy.
+	enableNetworkPolicyKey = "enableNetworkPolicy"
+
+	// networkPolicyIngressNamespacesKey is the config map key for the set of
+	// namespaces, besides Knative's own, allowed to reach revision pods.
+	networkPolicyIngressNamespacesKey = "networkPolicyIngressNamespaces"
+
+	// networkPolicyNamespaceLabelKey is the config map key for the label
+	// carrying a namespace's name, which NetworkPolicies select namespaces by.
+	networkPolicyNamespaceLabelKey = "networkPolicyNamespaceLabel"
+
+	// networkPolicyNamespaceLabelDefault is the label Kubernetes sets on
+	// every namespace to its name, starting with v1.21.
+	networkPolicyNamespaceLabelDefault = "kubernetes.io/metadata.name"
+
+	// enableHeadlessServiceKey is the config map key to give revision pods
+	// per-pod DNS records through a headless Service.
+	enableHeadlessServiceKey = "enableHeadlessService"
+
+	// sidecarInjectAnnotationKey is the config map key for the service mesh
+	// annotation that revisions opting out of sidecar injection get.
+	sidecarInjectAnnotationKey = "sidecarInjectAnnotation"
+
+	// livenessProbeMaxRestartsKey is the config map key for the number of
+	// restarts of a container with a liveness probe after which the revision
+	// is marked as failing.
+	livenessProbeMaxRestartsKey = "livenessProbeMaxRestarts"
+
+	// defaultTopologyKeyKey is the config map key for the node label across
+	// which revision pods are spread by default.
+	defaultTopologyKeyKey = "defaultTopologyKey"
+
 	// queueSidecar resource request keys.
 	queueSidecarCPURequestKey              = "queueSidecarCPURequest"
 	queueSidecarMemoryRequestKey           = "queueSidecarMemoryRequest"
@@ -76,6 +122,23 @@ func defaultConfig() *Config {
 		DigestResolutionTimeout:        digestResolutionTimeoutDefault,
 		RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
 		QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+		NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+	}
+}
+
+// asOptionalStringSet is like cm.AsStringSet, but ignores empty elements, so
+// that an empty value leaves the target unset rather than holding "".
+func asOptionalStringSet(key string, target *sets.String) cm.ParseFunc {
+	return func(data map[string]string) error {
+		if raw, ok := data[key]; ok {
+			set := sets.NewString(strings.Split(raw, ",")...)
+			set.Delete("")
+			if set.Len() == 0 {
+				set = nil
+			}
+			*target = set
+		}
+		return nil
 	}
 }
 
@@ -88,6 +151,16 @@ func NewConfigFromMap(configMap map[string]string) (*Config, error) {
 		cm.AsDuration(ProgressDeadlineKey, &nc.ProgressDeadline),
 		cm.AsDuration(digestResolutionTimeoutKey, &nc.DigestResolutionTimeout),
 		cm.AsStringSet(registriesSkippingTagResolvingKey, &nc.RegistriesSkippingTagResolving),
+		asOptionalStringSet(allowedTolerationKeysKey, &nc.AllowedTolerationKeys),
+		cm.AsString(defaultTopologyKeyKey, &nc.DefaultTopologyKey),
+		cm.AsString(sidecarInjectAnnotationKey, &nc.SidecarInjectAnnotation),
+		asOptionalStringSet(allowedLoggingURLTemplatesKey, &nc.AllowedLoggingURLTemplates),
+		cm.AsInt(livenessProbeMaxRestartsKey, &nc.LivenessProbeMaxRestarts),
+		cm.AsBool(disableImageCacheKey, &nc.DisableImageCache),
+		cm.AsBool(enableNetworkPolicyKey, &nc.EnableNetworkPolicy),
+		asOptionalStringSet(networkPolicyIngressNamespacesKey, &nc.NetworkPolicyIngressNamespaces),
+		cm.AsString(networkPolicyNamespaceLabelKey, &nc.NetworkPolicyNamespaceLabel),
+		cm.AsBool(enableHeadlessServiceKey, &nc.EnableHeadlessService),
 
 		cm.AsQuantity(queueSidecarCPURequestKey, &nc.QueueSidecarCPURequest),
 		cm.AsQuantity(queueSidecarMemoryRequestKey, &nc.QueueSidecarMemoryRequest),
@@ -111,6 +184,14 @@ func NewConfigFromMap(configMap map[string]string) (*Config, error) {
 		return nil, fmt.Errorf("ProgressDeadline must be rounded to a whole second, was: %v", nc.ProgressDeadline)
 	}
 
+	if nc.LivenessProbeMaxRestarts < 0 {
+		return nil, fmt.Errorf("livenessProbeMaxRestarts cannot be negative, was %d", nc.LivenessProbeMaxRestarts)
+	}
+
+	if nc.EnableNetworkPolicy && nc.NetworkPolicyNamespaceLabel == "" {
+		return nil, errors.New("networkPolicyNamespaceLabel cannot be empty if enableNetworkPolicy is set")
+	}
+
 	if nc.DigestResolutionTimeout <= 0 {
 		return nil, fmt.Errorf("digestResolutionTimeout cannot be a non-positive duration, was %v", nc.DigestResolutionTimeout)
 	}
@@ -132,6 +213,54 @@ type Config struct {
 	// Repositories for which tag to digest resolving should be skipped.
 	RegistriesSkippingTagResolving sets.String
 
+	// AllowedTolerationKeys is the set of taint keys revisions may tolerate.
+	// If empty, tolerations for any taint key are allowed.
+	AllowedTolerationKeys sets.String
+
+	// DefaultTopologyKey is the node label across which revision pods are
+	// spread, unless overridden per revision. If empty, pods are not spread.
+	DefaultTopologyKey string
+
+	// SidecarInjectAnnotation is the service mesh's pod annotation, e.g.
+	// sidecar.istio.io/inject, set to "false" on the pods of revisions opting
+	// out of sidecar injection. If empty, the opt-out is ignored.
+	SidecarInjectAnnotation string
+
+	// AllowedLoggingURLTemplates is the set of logging URL templates
+	// revisions may use instead of the cluster-wide one.
+	AllowedLoggingURLTemplates sets.String
+
+	// LivenessProbeMaxRestarts is the number of restarts of a container with a
+	// liveness probe beyond which the revision's containers are marked as
+	// unhealthy, while none of its pods is available. If 0, restarts are not
+	// counted.
+	LivenessProbeMaxRestarts int
+
+	// DisableImageCache stops the creation of caching.knative.dev Images for
+	// revisions, e.g. on clusters that don't run knative/caching.
+	DisableImageCache bool
+
+	// EnableNetworkPolicy makes revisions create a NetworkPolicy, which only
+	// admits traffic to their pods from Knative's own namespace and the
+	// NetworkPolicyIngressNamespaces.
+	EnableNetworkPolicy bool
+
+	// NetworkPolicyIngressNamespaces is the set of namespaces, e.g. the one of
+	// the ingress gateway, allowed to reach revision pods in addition to
+	// Knative's own namespace, if EnableNetworkPolicy is set.
+	NetworkPolicyIngressNamespaces sets.String
+
+	// NetworkPolicyNamespaceLabel is the namespace label, set to the
+	// namespace's name, that NetworkPolicies select the allowed namespaces
+	// by. Kubernetes only sets the default one from v1.21 on, so older
+	// clusters have to label namespaces themselves or pick another label.
+	NetworkPolicyNamespaceLabel string
+
+	// EnableHeadlessService makes revisions create a headless Service
+	// selecting their pods, so that individual replicas can be addressed,
+	// e.g. by metric scrapers.
+	EnableHeadlessService bool
+
 	// DigestResolutionTimeout is the maximum time allowed for image digest resolution.
 	DigestResolutionTimeout time.Duration
 
@@ -86,6 +86,7 @@ func TestControllerConfiguration(t *testing.T) {
 			RegistriesSkippingTagResolving: sets.NewString("ko.local", ""),
 			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
 			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
 			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
 			ProgressDeadline:               ProgressDeadlineDefault,
 		},
@@ -99,6 +100,7 @@ func TestControllerConfiguration(t *testing.T) {
 			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
 			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
 			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
 			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
 			ProgressDeadline:               444 * time.Second,
 		},
@@ -112,6 +114,7 @@ func TestControllerConfiguration(t *testing.T) {
 			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
 			DigestResolutionTimeout:        60 * time.Second,
 			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
 			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
 			ProgressDeadline:               ProgressDeadlineDefault,
 		},
@@ -125,6 +128,7 @@ func TestControllerConfiguration(t *testing.T) {
 			RegistriesSkippingTagResolving: sets.NewString("ko.local", "ko.dev"),
 			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
 			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
 			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
 			ProgressDeadline:               ProgressDeadlineDefault,
 		},
@@ -132,12 +136,165 @@ func TestControllerConfiguration(t *testing.T) {
 			QueueSidecarImageKey:              defaultSidecarImage,
 			registriesSkippingTagResolvingKey: "ko.local,ko.dev",
 		},
+	}, {
+		name: "controller configuration with allowed toleration keys",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			AllowedTolerationKeys:          sets.NewString("dedicated", "nvidia.com/gpu"),
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			allowedTolerationKeysKey: "dedicated,nvidia.com/gpu",
+		},
+	}, {
+		name: "controller configuration with empty allowed toleration keys",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			allowedTolerationKeysKey: "",
+		},
+	}, {
+		name: "controller configuration with default topology key",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			DefaultTopologyKey:             "topology.kubernetes.io/zone",
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:  defaultSidecarImage,
+			defaultTopologyKeyKey: "topology.kubernetes.io/zone",
+		},
+	}, {
+		name: "controller configuration with sidecar inject annotation",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			SidecarInjectAnnotation:        "sidecar.istio.io/inject",
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:       defaultSidecarImage,
+			sidecarInjectAnnotationKey: "sidecar.istio.io/inject",
+		},
+	}, {
+		name: "controller configuration with allowed logging url templates",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			AllowedLoggingURLTemplates:     sets.NewString("https://a.example.com/${REVISION_UID}", "https://b.example.com/${REVISION_UID}"),
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:          defaultSidecarImage,
+			allowedLoggingURLTemplatesKey: "https://a.example.com/${REVISION_UID},https://b.example.com/${REVISION_UID}",
+		},
+	}, {
+		name: "controller configuration with liveness probe max restarts",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			LivenessProbeMaxRestarts:       5,
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			livenessProbeMaxRestartsKey: "5",
+		},
+	}, {
+		name:    "controller configuration negative liveness probe max restarts",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:        defaultSidecarImage,
+			livenessProbeMaxRestartsKey: "-1",
+		},
+	}, {
+		name: "controller configuration with image cache disabled",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			DisableImageCache:              true,
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey: defaultSidecarImage,
+			disableImageCacheKey: "true",
+		},
+	}, {
+		name: "controller configuration with network policy",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			EnableNetworkPolicy:            true,
+			NetworkPolicyIngressNamespaces: sets.NewString("kourier-system", "monitoring"),
+			NetworkPolicyNamespaceLabel:    "name",
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:              defaultSidecarImage,
+			enableNetworkPolicyKey:            "true",
+			networkPolicyIngressNamespacesKey: "kourier-system,monitoring",
+			networkPolicyNamespaceLabelKey:    "name",
+		},
+	}, {
+		name:    "controller configuration with network policy and no namespace label",
+		wantErr: true,
+		data: map[string]string{
+			QueueSidecarImageKey:           defaultSidecarImage,
+			enableNetworkPolicyKey:         "true",
+			networkPolicyNamespaceLabelKey: "",
+		},
+	}, {
+		name: "controller configuration with headless service",
+		wantConfig: &Config{
+			RegistriesSkippingTagResolving: sets.NewString("kind.local", "ko.local", "dev.local"),
+			EnableHeadlessService:          true,
+			DigestResolutionTimeout:        digestResolutionTimeoutDefault,
+			QueueSidecarImage:              defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:    networkPolicyNamespaceLabelDefault,
+			QueueSidecarCPURequest:         &QueueSidecarCPURequestDefault,
+			ProgressDeadline:               ProgressDeadlineDefault,
+		},
+		data: map[string]string{
+			QueueSidecarImageKey:     defaultSidecarImage,
+			enableHeadlessServiceKey: "true",
+		},
 	}, {
 		name: "controller configuration with custom queue sidecar resource request/limits",
 		wantConfig: &Config{
 			RegistriesSkippingTagResolving:      sets.NewString("kind.local", "ko.local", "dev.local"),
 			DigestResolutionTimeout:             digestResolutionTimeoutDefault,
 			QueueSidecarImage:                   defaultSidecarImage,
+			NetworkPolicyNamespaceLabel:         networkPolicyNamespaceLabelDefault,
 			ProgressDeadline:                    ProgressDeadlineDefault,
 			QueueSidecarCPURequest:              resourcePtr(resource.MustParse("123m")),
 			QueueSidecarMemoryRequest:           resourcePtr(resource.MustParse("456M")),
@@ -0,0 +1,51 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"knative.dev/pkg/configmap"
+)
+
+// Store is a typed wrapper around configmap.Untyped store to handle the
+// deployment config map.
+// +k8s:deepcopy-gen=false
+type Store struct {
+	*configmap.UntypedStore
+}
+
+// NewStore creates a new store of Configs and optionally calls functions when ConfigMaps are updated.
+func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value interface{})) *Store {
+	return &Store{
+		UntypedStore: configmap.NewUntypedStore(
+			"deployment",
+			logger,
+			configmap.Constructors{
+				ConfigName: NewConfigFromConfigMap,
+			},
+			onAfterStore...,
+		),
+	}
+}
+
+// Load creates a Config from the current config state of the Store. It
+// returns nil if the config map wasn't loaded yet.
+func (s *Store) Load() *Config {
+	if cfg, ok := s.UntypedLoad(ConfigName).(*Config); ok {
+		return cfg.DeepCopy()
+	}
+	return nil
+}
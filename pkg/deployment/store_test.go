@@ -0,0 +1,42 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	logtesting "knative.dev/pkg/logging/testing"
+
+	. "knative.dev/pkg/configmap/testing"
+)
+
+func TestStoreLoad(t *testing.T) {
+	store := NewStore(logtesting.TestLogger(t))
+
+	if got := store.Load(); got != nil {
+		t.Errorf("Load() = %v, want nil before the config map is loaded", got)
+	}
+
+	cm := ConfigMapFromTestFile(t, ConfigName, QueueSidecarImageKey)
+	store.OnConfigChanged(cm)
+
+	want, _ := NewConfigFromConfigMap(cm)
+	if got := store.Load(); !cmp.Equal(got, want) {
+		t.Error("Unexpected deployment config (-want, +got):", cmp.Diff(want, got))
+	}
+}
@@ -34,6 +34,27 @@ func (in *Config) DeepCopyInto(out *Config) {
 			(*out)[key] = val
 		}
 	}
+	if in.AllowedTolerationKeys != nil {
+		in, out := &in.AllowedTolerationKeys, &out.AllowedTolerationKeys
+		*out = make(sets.String, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.AllowedLoggingURLTemplates != nil {
+		in, out := &in.AllowedLoggingURLTemplates, &out.AllowedLoggingURLTemplates
+		*out = make(sets.String, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.NetworkPolicyIngressNamespaces != nil {
+		in, out := &in.NetworkPolicyIngressNamespaces, &out.NetworkPolicyIngressNamespaces
+		*out = make(sets.String, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.QueueSidecarCPURequest != nil {
 		in, out := &in.QueueSidecarCPURequest, &out.QueueSidecarCPURequest
 		x := (*in).DeepCopy()
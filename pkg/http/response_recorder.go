@@ -80,6 +80,12 @@ func (rr *ResponseRecorder) Write(p []byte) (int, error) {
 	return rr.writer.Write(p)
 }
 
+// Written returns whether the response header or any of its body was already
+// sent, after which the response code can't be changed anymore.
+func (rr *ResponseRecorder) Written() bool {
+	return rr.wroteHeader || rr.ResponseSize > 0
+}
+
 // WriteHeader sends an HTTP response header with the provided status code.
 func (rr *ResponseRecorder) WriteHeader(code int) {
 	if rr.wroteHeader || rr.hijacked.Load() {
@@ -17,12 +17,17 @@ limitations under the License.
 package queue
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"fmt"
 	"math"
+	"math/rand"
+	"sync"
+	"time"
 
 	"go.uber.org/atomic"
+	"go.uber.org/zap"
 )
 
 var (
@@ -30,17 +35,129 @@ var (
 	ErrRelease = errors.New("semaphore release error: returned tokens must be <= acquired tokens")
 	// ErrRequestQueueFull indicates the breaker queue depth was exceeded.
 	ErrRequestQueueFull = errors.New("pending request queue full")
+	// ErrWeightExceedsCapacity indicates the weight of a request exceeds the
+	// maximum concurrency of the breaker, so it could never be executed.
+	ErrWeightExceedsCapacity = errors.New("request weight exceeds maximum concurrency")
+	// ErrUnhealthy indicates the breaker has been marked unhealthy and sheds load.
+	ErrUnhealthy = errors.New("breaker is unhealthy")
+	// ErrDraining indicates the breaker is draining and admits no new requests.
+	ErrDraining = errors.New("breaker is draining")
+	// ErrTokenLeak indicates tokens were held by callers for longer than
+	// expected, which most likely means they're never released.
+	ErrTokenLeak = errors.New("semaphore tokens held for longer than expected")
+	// ErrRequestTimeout indicates the thunk exceeded the breaker's timeout.
+	ErrRequestTimeout = errors.New("request exceeded its timeout")
 )
 
+// CapacityError wraps a semaphore error with the capacity numbers of the
+// semaphore that produced it. It matches its wrapped error via errors.Is.
+type CapacityError struct {
+	// Err is the wrapped error, e.g. ErrRelease.
+	Err error
+	// MaxConcurrency is the maximum capacity of the semaphore.
+	MaxConcurrency int
+	// Capacity is the capacity of the semaphore when the error occurred.
+	Capacity int
+	// InFlight is the number of acquired tokens when the error occurred.
+	InFlight int
+	// Leaked is the number of tokens held for longer than expected and
+	// OldestHold the time the longest held of them was held for. They're only
+	// set for ErrTokenLeak.
+	Leaked     int
+	OldestHold time.Duration
+}
+
+// Error implements error.
+func (e *CapacityError) Error() string {
+	if errors.Is(e.Err, ErrTokenLeak) {
+		return fmt.Sprintf("%v (maxConcurrency: %d, capacity: %d, inFlight: %d, leaked: %d, oldestHold: %v)",
+			e.Err, e.MaxConcurrency, e.Capacity, e.InFlight, e.Leaked, e.OldestHold)
+	}
+	return fmt.Sprintf("%v (maxConcurrency: %d, capacity: %d, inFlight: %d)",
+		e.Err, e.MaxConcurrency, e.Capacity, e.InFlight)
+}
+
+// Unwrap returns the wrapped error.
+func (e *CapacityError) Unwrap() error {
+	return e.Err
+}
+
+// UnlimitedCapacity is reported as the capacity of a breaker created with
+// BreakerParams.Unlimited.
+const UnlimitedCapacity = -1
+
 // MaxBreakerCapacity is the largest valid value for the MaxConcurrency value of BreakerParams.
 // This is limited by the maximum size of a chan struct{} in the current implementation.
 const MaxBreakerCapacity = math.MaxInt32
 
+// drainPollInterval is the interval in which DrainAndWait checks whether all
+// requests have finished.
+const drainPollInterval = 10 * time.Millisecond
+
+// waitPollMin and waitPollMax bound the exponentially growing interval in which
+// WaitForCapacity checks for capacity. The interval is additionally jittered,
+// so that callers waiting on many breakers don't wake up in lockstep.
+const (
+	waitPollMin = 5 * time.Millisecond
+	waitPollMax = 100 * time.Millisecond
+)
+
+// durationSmoothingFactor is the weight of the most recent sample when updating
+// the rolling average of thunk execution times.
+const durationSmoothingFactor = 0.2
+
 // BreakerParams defines the parameters of the breaker.
 type BreakerParams struct {
 	QueueDepth      int
 	MaxConcurrency  int
 	InitialCapacity int
+
+	// OnWait, if set, is called with the time a request waited for capacity
+	// before its thunk was executed. It's not called for rejected requests.
+	OnWait func(time.Duration)
+
+	// Logger, if set, is used to log changes to the breaker's capacity at
+	// debug level.
+	Logger *zap.SugaredLogger
+
+	// Unlimited makes the breaker pass all requests through without gating
+	// them, e.g. for revisions with unbounded container concurrency. Requests
+	// are still counted as in-flight. QueueDepth, MaxConcurrency and
+	// InitialCapacity are ignored.
+	Unlimited bool
+
+	// FIFO makes requests waiting for capacity acquire it in the order they
+	// arrived in, so none of them starves under sustained overload. This
+	// comes at the cost of a mutex on the semaphore's hot path.
+	FIFO bool
+
+	// Timeout, if positive, limits the time a thunk executed via MaybeCtx may
+	// hold capacity. The thunk's context is cancelled once it's exceeded, which
+	// also cuts off long running streaming responses.
+	Timeout time.Duration
+
+	// SoftLimit, if positive, is a number of executing requests above which
+	// OnSoftLimitExceeded is called, e.g. to signal the autoscaler before the
+	// capacity is exhausted. Requests keep being admitted up to the capacity.
+	SoftLimit int
+
+	// OnSoftLimitExceeded, if set, is called with the number of executing
+	// requests whenever a request admitted by Maybe crosses SoftLimit. It's
+	// only called again once the number dropped back to SoftLimit or below.
+	// It's called synchronously, so it must not block.
+	OnSoftLimitExceeded func(active int)
+
+	// TrackHolds makes the breaker track when each request acquired its
+	// capacity, so that Audit can report capacity held for too long or
+	// released twice. This costs a mutex and an allocation per request, so
+	// it's meant for the queue-proxy rather than the activator.
+	TrackHolds bool
+
+	// EstimateWait makes the breaker keep a rolling average of the thunks'
+	// execution times, which EstimatedWait is based on. This costs two
+	// time.Now calls and a CAS loop per request, so it's off by default, in
+	// which case EstimatedWait always returns 0.
+	EstimateWait bool
 }
 
 // Breaker is a component that enforces a concurrency limit on the
@@ -48,47 +165,197 @@ type BreakerParams struct {
 // executions in excess of the concurrency limit. Function call attempts
 // beyond the limit of the queue are failed immediately.
 type Breaker struct {
-	inFlight   atomic.Int64
-	totalSlots int64
-	sem        *semaphore
+	inFlight       atomic.Int64
+	totalSlots     atomic.Int64
+	maxConcurrency int
+	sem            *semaphore
+	onWait         func(time.Duration)
+	logger         *zap.SugaredLogger
+	unlimited      bool
+	timeout        time.Duration
+
+	// softLimit and onSoftLimitExceeded are the parameters of the same name.
+	// softLimitExceeded is set while the soft limit is exceeded, so that
+	// onSoftLimitExceeded is only called when crossing it.
+	softLimit           int
+	onSoftLimitExceeded func(int)
+	softLimitExceeded   atomic.Bool
+
+	// onCapacityChange is called with the old and the new capacity whenever
+	// UpdateConcurrency changes the capacity.
+	onCapacityChange func(old, new int)
+
+	// unhealthy is set by an external health signal via SetHealthy. While
+	// set, all requests are rejected.
+	unhealthy atomic.Bool
+
+	// draining is set by Drain. While set, all new requests are rejected.
+	draining atomic.Bool
+
+	// rejected counts the requests Maybe shed since the breaker was created.
+	rejected atomic.Uint64
+
+	// timedOut counts the thunks that exceeded timeout since the breaker
+	// was created.
+	timedOut atomic.Uint64
 
-	// release is the callback function returned to callers by Reserve to
-	// allow the reservation made by Reserve to be released.
-	release func()
+	// avgDuration is the rolling average of the thunk execution time in
+	// nanoseconds, used to estimate wait times.
+	avgDuration atomic.Int64
+
+	// holds tracks the tokens acquired by callers until they release them,
+	// if trackHolds is set. active counts the requests holding them, which
+	// differs from the number of tokens held for weighted requests.
+	trackHolds bool
+	holds      holds
+	active     atomic.Int64
+
+	// estimateWait is the parameter of the same name.
+	estimateWait bool
+}
+
+// queueDepthFactor is the factor of the container concurrency used as
+// the queue depth, to allow the autoscaler time to react.
+const queueDepthFactor = 10
+
+// NewBreakerParams derives the BreakerParams for a revision with the given
+// container concurrency. The initial capacity is the container concurrency
+// itself: nothing raises the capacity later on, so seeding it lower (e.g. from
+// the autoscaler's target) would cap the revision below its container
+// concurrency for the whole life of the pod. A container concurrency of 0,
+// i.e. unbounded concurrency, translates to MaxBreakerCapacity. Panics if the
+// resulting params are invalid.
+func NewBreakerParams(containerConcurrency int) BreakerParams {
+	maxConcurrency, queueDepth := containerConcurrency, queueDepthFactor*containerConcurrency
+	if containerConcurrency == 0 {
+		maxConcurrency, queueDepth = MaxBreakerCapacity, MaxBreakerCapacity
+	}
+
+	params := BreakerParams{
+		QueueDepth:      queueDepth,
+		MaxConcurrency:  maxConcurrency,
+		InitialCapacity: maxConcurrency,
+	}
+	if err := params.validate(); err != nil {
+		panic(err.Error())
+	}
+	return params
+}
+
+// RestoreCapacity seeds InitialCapacity with the capacity of a previous
+// breaker, as returned by its Capacity, e.g. persisted across a restart of the
+// queue-proxy so it doesn't start cold. It returns an error and leaves the
+// params unchanged if capacity isn't between 0 and MaxConcurrency. For
+// unlimited params, it's a no-op.
+func (p *BreakerParams) RestoreCapacity(capacity int) error {
+	if p.Unlimited {
+		return nil
+	}
+	if capacity < 0 || capacity > p.MaxConcurrency {
+		return fmt.Errorf("Restored capacity must be between 0 and max concurrency %d. Got %d.", p.MaxConcurrency, capacity)
+	}
+	p.InitialCapacity = capacity
+	return nil
+}
+
+// validate returns an error if the params can't be used to construct a Breaker.
+func (p BreakerParams) validate() error {
+	if p.QueueDepth < 0 {
+		return fmt.Errorf("Queue depth must be 0 or greater. Got %v.", p.QueueDepth)
+	}
+	if p.MaxConcurrency < 0 {
+		return fmt.Errorf("Max concurrency must be 0 or greater. Got %v.", p.MaxConcurrency)
+	}
+	if p.InitialCapacity < 0 || p.InitialCapacity > p.MaxConcurrency {
+		return fmt.Errorf("Initial capacity must be between 0 and max concurrency. Got %v.", p.InitialCapacity)
+	}
+	if p.SoftLimit < 0 || p.SoftLimit > p.MaxConcurrency {
+		return fmt.Errorf("Soft limit must be between 0 and max concurrency. Got %v.", p.SoftLimit)
+	}
+	return nil
 }
 
 // NewBreaker creates a Breaker with the desired queue depth,
-// concurrency limit and initial capacity.
+// concurrency limit and initial capacity. Panics if the params are invalid.
 func NewBreaker(params BreakerParams) *Breaker {
-	if params.QueueDepth <= 0 {
-		panic(fmt.Sprintf("Queue depth must be greater than 0. Got %v.", params.QueueDepth))
+	b, err := NewBreakerWithError(params)
+	if err != nil {
+		panic(err.Error())
+	}
+	return b
+}
+
+// NewBreakerWithError is like NewBreaker but returns an error instead of
+// panicking if the params are invalid, e.g. because they stem from a
+// configuration reloaded at runtime.
+func NewBreakerWithError(params BreakerParams) (*Breaker, error) {
+	if params.Unlimited {
+		return newUnlimitedBreaker(params), nil
 	}
-	if params.MaxConcurrency < 0 {
-		panic(fmt.Sprintf("Max concurrency must be 0 or greater. Got %v.", params.MaxConcurrency))
+	if err := params.validate(); err != nil {
+		return nil, err
 	}
-	if params.InitialCapacity < 0 || params.InitialCapacity > params.MaxConcurrency {
-		panic(fmt.Sprintf("Initial capacity must be between 0 and max concurrency. Got %v.", params.InitialCapacity))
+
+	b := &Breaker{
+		maxConcurrency: params.MaxConcurrency,
+		sem:            newSemaphore(params.MaxConcurrency, params.InitialCapacity, params.FIFO),
+		onWait:         params.OnWait,
+		logger:         params.Logger,
+		timeout:        params.Timeout,
+		trackHolds:     params.TrackHolds,
+		estimateWait:   params.EstimateWait,
 	}
+	b.setSoftLimit(params)
+	b.totalSlots.Store(int64(params.QueueDepth + params.MaxConcurrency))
+	return b, nil
+}
 
+// newUnlimitedBreaker creates a Breaker that passes all requests through.
+func newUnlimitedBreaker(params BreakerParams) *Breaker {
 	b := &Breaker{
-		totalSlots: int64(params.QueueDepth + params.MaxConcurrency),
-		sem:        newSemaphore(params.MaxConcurrency, params.InitialCapacity),
+		sem:       newSemaphore(0, 0, false),
+		onWait:    params.OnWait,
+		logger:    params.Logger,
+		timeout:   params.Timeout,
+		unlimited: true,
 	}
+	b.setSoftLimit(params)
+	return b
+}
 
-	// Allocating the closure returned by Reserve here avoids an allocation in Reserve.
-	b.release = func() {
-		b.sem.release()
-		b.releasePending()
+// setSoftLimit sets up the soft limit from the given params, if both the limit
+// and the callback are set.
+func (b *Breaker) setSoftLimit(params BreakerParams) {
+	if params.SoftLimit > 0 && params.OnSoftLimitExceeded != nil {
+		b.softLimit = params.SoftLimit
+		b.onSoftLimitExceeded = params.OnSoftLimitExceeded
 	}
+}
 
-	return b
+// softLimitAcquired is called after a request acquired capacity and notifies
+// about it crossing the soft limit.
+func (b *Breaker) softLimitAcquired() {
+	if b.softLimit == 0 {
+		return
+	}
+	if active := b.Active(); active > b.softLimit && b.softLimitExceeded.CAS(false, true) {
+		b.onSoftLimitExceeded(active)
+	}
+}
+
+// softLimitReleased is called after a request released its capacity and
+// rearms the soft limit once it's no longer exceeded.
+func (b *Breaker) softLimitReleased() {
+	if b.softLimit != 0 && b.Active() <= b.softLimit {
+		b.softLimitExceeded.Store(false)
+	}
 }
 
 // tryAcquirePending tries to acquire a slot on the pending "queue".
 func (b *Breaker) tryAcquirePending() bool {
 	// This is an atomic version of:
 	//
-	// if inFlight == totalSlots {
+	// if inFlight >= totalSlots {
 	//   return false
 	// } else {
 	//   inFlight++
@@ -102,7 +369,9 @@ func (b *Breaker) tryAcquirePending() bool {
 	// anymore.
 	for {
 		cur := b.inFlight.Load()
-		if cur == b.totalSlots {
+		// The queue depth might have been reduced below the current number
+		// of requests, hence >= rather than ==.
+		if cur >= b.totalSlots.Load() {
 			return false
 		}
 		if b.inFlight.CAS(cur, cur+1) {
@@ -118,8 +387,17 @@ func (b *Breaker) releasePending() {
 
 // Reserve reserves an execution slot in the breaker, to permit
 // richer semantics in the caller.
-// The caller on success must execute the callback when done with work.
+// The caller on success must execute the callback when done with work. Calling
+// it more than once doesn't release the slot again. If the breaker tracks
+// holds, it's reported by Audit.
 func (b *Breaker) Reserve(ctx context.Context) (func(), bool) {
+	if b.unhealthy.Load() || b.draining.Load() {
+		return nil, false
+	}
+	if b.unlimited {
+		b.inFlight.Inc()
+		return releaseOnce(b.releasePending), true
+	}
 	if !b.tryAcquirePending() {
 		return nil, false
 	}
@@ -129,55 +407,484 @@ func (b *Breaker) Reserve(ctx context.Context) (func(), bool) {
 		return nil, false
 	}
 
-	return b.release, true
+	h := b.hold(1)
+	if h == nil {
+		return releaseOnce(func() {
+			b.releaseHold(nil, 1)
+			b.releasePending()
+		}), true
+	}
+	return func() {
+		if b.releaseHold(h, 1) {
+			b.releasePending()
+		}
+	}, true
+}
+
+// releaseOnce wraps release so that calling the returned function more than
+// once doesn't give back tokens held by other callers.
+func releaseOnce(release func()) func() {
+	var released atomic.Bool
+	return func() {
+		if released.CAS(false, true) {
+			release()
+		}
+	}
 }
 
 // Maybe conditionally executes thunk based on the Breaker concurrency
 // and queue parameters. If the concurrency limit and queue capacity are
 // already consumed, Maybe returns immediately without calling thunk. If
 // the thunk was executed, Maybe returns true, else false.
+// If the breaker has been marked unhealthy, Maybe returns ErrUnhealthy.
 func (b *Breaker) Maybe(ctx context.Context, thunk func()) error {
+	return b.maybe(ctx, 1, thunk)
+}
+
+// MaybeCtx is like Maybe, but passes ctx on to thunk, so that the work it does,
+// e.g. the call to the user container, observes the same deadline and is
+// cancelled along with the request. As time spent waiting for capacity counts
+// against ctx's deadline, the thunk only gets the remaining budget. If ctx is
+// done by the time capacity was acquired, the thunk isn't executed at all and
+// ctx's error is returned.
+//
+// If the breaker has a timeout, the thunk's context is additionally cancelled
+// once the thunk ran for longer than that, so that a hanging thunk gives up its
+// capacity. MaybeCtx then returns ErrRequestTimeout.
+func (b *Breaker) MaybeCtx(ctx context.Context, thunk func(context.Context)) error {
+	var err error
+	if mErr := b.maybe(ctx, 1, func() {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if b.timeout <= 0 {
+			thunk(ctx)
+			return
+		}
+		tctx, cancel := context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+		thunk(tctx)
+		if ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+			b.timedOut.Inc()
+			err = ErrRequestTimeout
+		}
+	}); mErr != nil {
+		return mErr
+	}
+	return err
+}
+
+// MaybeWeighted is like Maybe, but the thunk consumes weight units of the
+// breaker's concurrency rather than one, e.g. for particularly expensive
+// requests. The thunk is only executed once all of them are acquired. A
+// weight exceeding the breaker's maximum concurrency is rejected with
+// ErrWeightExceedsCapacity right away.
+func (b *Breaker) MaybeWeighted(ctx context.Context, weight int, thunk func()) error {
+	if !b.unlimited && weight > b.maxConcurrency {
+		b.rejected.Inc()
+		return ErrWeightExceedsCapacity
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	return b.maybe(ctx, weight, thunk)
+}
+
+func (b *Breaker) maybe(ctx context.Context, weight int, thunk func()) error {
+	if b.draining.Load() {
+		b.rejected.Inc()
+		return ErrDraining
+	}
+	if b.unhealthy.Load() {
+		b.rejected.Inc()
+		return ErrUnhealthy
+	}
+	if b.unlimited {
+		b.inFlight.Inc()
+		defer b.softLimitReleased()
+		defer b.releasePending()
+		if b.onWait != nil {
+			b.onWait(0)
+		}
+		b.softLimitAcquired()
+		b.execute(thunk)
+		return nil
+	}
 	if !b.tryAcquirePending() {
+		b.rejected.Inc()
 		return ErrRequestQueueFull
 	}
 
 	defer b.releasePending()
 
 	// Wait for capacity in the active queue.
-	if err := b.sem.acquire(ctx); err != nil {
+	var waitStart time.Time
+	if b.onWait != nil {
+		waitStart = time.Now()
+	}
+	if b.queueless() {
+		// Without a queue, only execute if capacity is available right away.
+		if !b.sem.tryAcquireN(weight) {
+			b.rejected.Inc()
+			return ErrRequestQueueFull
+		}
+	} else if err := b.sem.acquireN(ctx, weight); err != nil {
 		return err
 	}
+	if b.onWait != nil {
+		b.onWait(time.Since(waitStart))
+	}
 	// Defer releasing capacity in the active.
 	// It's safe to ignore the error returned by release since we
 	// make sure the semaphore is only manipulated here and acquire
 	// + release calls are equally paired.
-	defer b.sem.release()
+	defer b.softLimitReleased()
+	defer b.releaseHold(b.hold(weight), weight)
+	b.softLimitAcquired()
 
 	// Do the thing.
-	thunk()
+	b.execute(thunk)
 	// Report success
 	return nil
 }
 
+// hold counts a request that acquired weight tokens until it releases them
+// via releaseHold. If the breaker tracks holds, it returns the hold to pass to
+// releaseHold, otherwise nil.
+func (b *Breaker) hold(weight int) *hold {
+	b.active.Inc()
+	if !b.trackHolds {
+		return nil
+	}
+	return b.holds.add(weight)
+}
+
+// releaseHold releases weight tokens acquired by a request. If the given hold
+// is tracked, they're only released if they weren't already. It returns
+// whether they were released.
+func (b *Breaker) releaseHold(h *hold, weight int) bool {
+	if h != nil && !b.holds.remove(h) {
+		return false
+	}
+	b.active.Dec()
+	b.sem.releaseN(weight)
+	return true
+}
+
+// queueless returns whether the breaker was configured without a queue, in
+// which case requests are rejected rather than waiting for capacity.
+func (b *Breaker) queueless() bool {
+	return b.totalSlots.Load() == int64(b.maxConcurrency)
+}
+
+// execute calls thunk, recording its execution time if the breaker estimates
+// wait times.
+func (b *Breaker) execute(thunk func()) {
+	if !b.estimateWait {
+		thunk()
+		return
+	}
+	start := time.Now()
+	thunk()
+	b.recordDuration(time.Since(start))
+}
+
+// recordDuration folds the given thunk execution time into the rolling average.
+func (b *Breaker) recordDuration(d time.Duration) {
+	for {
+		old := b.avgDuration.Load()
+		avg := int64(d)
+		if old != 0 {
+			avg = old + int64(durationSmoothingFactor*float64(int64(d)-old))
+		}
+		if b.avgDuration.CAS(old, avg) {
+			return
+		}
+	}
+}
+
+// EstimatedWait returns an approximation of how long a request would have to
+// wait for capacity if it was enqueued now. It's computed from the rolling
+// average of the execution time of the thunks passed to Maybe and the number
+// of requests that are queued ahead. The estimate is meant as a hint for
+// retry and backoff decisions and is zero if capacity is available or the
+// breaker wasn't created with BreakerParams.EstimateWait.
+func (b *Breaker) EstimatedWait() time.Duration {
+	if b.unlimited {
+		return 0
+	}
+	capacity := b.Capacity()
+	queued := b.InFlight() - capacity
+	if queued < 0 {
+		return 0
+	}
+	if capacity == 0 {
+		// No capacity at all, assume requests will be processed one by one
+		// once capacity is added.
+		capacity = 1
+	}
+	return time.Duration(b.avgDuration.Load()) * time.Duration(queued/capacity+1)
+}
+
+// SetHealthy allows an external health signal to drive load shedding. While
+// the breaker is marked unhealthy, all new requests are rejected regardless
+// of the available capacity. Requests that were already admitted are not
+// affected.
+func (b *Breaker) SetHealthy(healthy bool) {
+	b.unhealthy.Store(!healthy)
+}
+
 // InFlight returns the number of requests currently in flight in this breaker.
 func (b *Breaker) InFlight() int {
 	return int(b.inFlight.Load())
 }
 
+// Drain stops the breaker from admitting new requests. Requests that are
+// already executing or waiting for capacity are allowed to finish. Draining
+// can't be undone.
+func (b *Breaker) Drain() {
+	b.draining.Store(true)
+}
+
+// DrainAndWait drains the breaker and blocks until all requests that were
+// executing or waiting for capacity have finished, or ctx is done.
+func (b *Breaker) DrainAndWait(ctx context.Context) error {
+	b.Drain()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for b.InFlight() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// WaitForCapacity blocks until the breaker likely has capacity to execute a
+// request right away, so that callers can await capacity rather than retrying
+// rejected requests. As other callers might take the capacity in between, a
+// subsequent Maybe can still have to wait. Returns ErrDraining if the breaker
+// is draining and ctx's error if ctx is done before capacity became available.
+func (b *Breaker) WaitForCapacity(ctx context.Context) error {
+	interval := waitPollMin
+	for {
+		if b.draining.Load() {
+			return ErrDraining
+		}
+		if b.unlimited || (!b.unhealthy.Load() && b.sem.available() > 0) {
+			return nil
+		}
+
+		// Jitter the interval by ±50%.
+		timer := time.NewTimer(interval/2 + time.Duration(rand.Int63n(int64(interval))))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if interval *= 2; interval > waitPollMax {
+			interval = waitPollMax
+		}
+	}
+}
+
+// RejectedCount returns the number of requests Maybe shed, because the queue
+// was full or the breaker was marked unhealthy or is draining. The counter is cumulative for
+// the lifetime of the breaker.
+func (b *Breaker) RejectedCount() uint64 {
+	return b.rejected.Load()
+}
+
+// TimedOutCount returns the number of thunks that exceeded the breaker's
+// timeout. The counter is cumulative for the lifetime of the breaker.
+func (b *Breaker) TimedOutCount() uint64 {
+	return b.timedOut.Load()
+}
+
+// Active returns the number of requests currently holding capacity in this
+// breaker, i.e. the requests executing their thunk. A weighted request counts
+// once, no matter how much capacity it holds.
+func (b *Breaker) Active() int {
+	if b.unlimited {
+		return b.InFlight()
+	}
+	return int(b.active.Load())
+}
+
+// Saturation returns how saturated the breaker's capacity is, as the ratio of
+// executing requests to the capacity, clamped to [0, 1]. A breaker without any
+// capacity is fully saturated, an unlimited breaker is never saturated. Unlike
+// the absolute numbers, the ratio can be compared across breakers with
+// different capacities.
+func (b *Breaker) Saturation() float64 {
+	if b.unlimited {
+		return 0
+	}
+	return b.sem.saturation()
+}
+
+// Pending returns the number of requests currently waiting for capacity in
+// this breaker.
+func (b *Breaker) Pending() int {
+	// Both values are loaded separately, so clamp to avoid reporting a
+	// negative value while racing with acquires and releases.
+	if pending := b.InFlight() - b.Active(); pending > 0 {
+		return pending
+	}
+	return 0
+}
+
+// CanAdmit returns whether a request arriving now would be admitted by Maybe,
+// either executing right away or waiting in the queue. Nothing is acquired,
+// so the answer is a racy hint: concurrent requests may take the last slot
+// before the caller gets to call Maybe, or free one right after.
+func (b *Breaker) CanAdmit() bool {
+	if b.draining.Load() || b.unhealthy.Load() {
+		return false
+	}
+	if b.unlimited {
+		return true
+	}
+	if b.queueless() && b.sem.available() <= 0 {
+		return false
+	}
+	return b.inFlight.Load() < b.totalSlots.Load()
+}
+
+// HasCapacity returns whether a request arriving now would execute right away
+// rather than waiting for capacity. Like CanAdmit it acquires nothing and the
+// answer may be stale by the time the caller acts on it.
+func (b *Breaker) HasCapacity() bool {
+	if b.draining.Load() || b.unhealthy.Load() {
+		return false
+	}
+	return b.unlimited || b.sem.available() > 0
+}
+
+// UpdateQueueDepth updates the number of requests that may wait for capacity.
+// Requests already waiting are not affected, even if the new depth is lower
+// than their number. A depth of 0 disables queueing altogether.
+func (b *Breaker) UpdateQueueDepth(depth int) error {
+	if depth < 0 {
+		return fmt.Errorf("queue depth must be 0 or greater, got %d", depth)
+	}
+	b.totalSlots.Store(int64(depth + b.maxConcurrency))
+	return nil
+}
+
 // UpdateConcurrency updates the maximum number of in-flight requests.
+// It's a no-op for unlimited breakers.
 func (b *Breaker) UpdateConcurrency(size int) {
-	b.sem.updateCapacity(size)
+	if b.unlimited {
+		return
+	}
+	old, changed := b.sem.updateCapacity(size)
+	if !changed {
+		return
+	}
+	if b.logger != nil {
+		b.logger.Debugf("Updated breaker capacity from %d to %d", old, size)
+	}
+	if b.onCapacityChange != nil {
+		b.onCapacityChange(old, size)
+	}
+}
+
+// UpdateConcurrencyBlocking is like UpdateConcurrency, but when reducing the
+// concurrency it blocks until the requests in excess of the new limit have
+// finished, so that the limit is actually enforced when it returns, e.g. to
+// firmly cap concurrency under memory pressure. If ctx is done before, ctx's
+// error is returned; the limit is reduced nonetheless.
+func (b *Breaker) UpdateConcurrencyBlocking(ctx context.Context, size int) error {
+	if b.unlimited {
+		return nil
+	}
+	b.UpdateConcurrency(size)
+	return b.sem.waitForCapacity(ctx)
+}
+
+// Audit returns the number of tokens of the breaker's semaphore acquired by
+// callers and the number of available ones. It returns a *CapacityError
+// wrapping ErrTokenLeak if callers held tokens for longer than maxAge, which
+// most likely means they never release them, and one wrapping ErrRelease if
+// a callback returned by Reserve was called more than once since the last
+// audit. Both are only detected if the breaker tracks holds, otherwise only
+// the counts are returned. It's safe to call concurrently with requests.
+func (b *Breaker) Audit(maxAge time.Duration) (acquired, available int, err error) {
+	capacity, maxCapacity, inFlight, available := b.sem.stats()
+	if !b.trackHolds {
+		return inFlight, available, nil
+	}
+	acquired, leaked, oldest, doubleReleases := b.holds.audit(time.Now(), maxAge)
+	switch {
+	case doubleReleases > 0:
+		err = &CapacityError{
+			Err:            ErrRelease,
+			MaxConcurrency: maxCapacity,
+			Capacity:       capacity,
+			InFlight:       inFlight,
+		}
+	case leaked > 0:
+		err = &CapacityError{
+			Err:            ErrTokenLeak,
+			MaxConcurrency: maxCapacity,
+			Capacity:       capacity,
+			InFlight:       inFlight,
+			Leaked:         leaked,
+			OldestHold:     oldest,
+		}
+	}
+	return acquired, available, err
+}
+
+// Stats returns the capacity, the maximum capacity, the acquired capacity and
+// the available capacity of the breaker's semaphore as a consistent snapshot.
+// The acquired capacity only matches Active if no weighted requests execute.
+// It never blocks. For unlimited breakers, all but the active requests are
+// reported as UnlimitedCapacity.
+func (b *Breaker) Stats() (capacity, maxCapacity, acquired, available int) {
+	if b.unlimited {
+		return UnlimitedCapacity, UnlimitedCapacity, b.InFlight(), UnlimitedCapacity
+	}
+	return b.sem.stats()
+}
+
+// String formats the breaker's state for debug dumps, e.g. alongside a
+// goroutine dump when hunting deadlocks.
+func (b *Breaker) String() string {
+	if b.unlimited {
+		return fmt.Sprintf("unlimited inFlight=%d", b.InFlight())
+	}
+	return fmt.Sprintf("%s inFlight=%d pending=%d draining=%t healthy=%t",
+		b.sem, b.InFlight(), b.Pending(), b.draining.Load(), !b.unhealthy.Load())
+}
+
+// OnCapacityChange registers a hook that is called with the old and the new
+// capacity whenever UpdateConcurrency changes the capacity, e.g. to record
+// metrics. It's not called if the capacity stays the same. The hook must be
+// registered before the breaker is used concurrently.
+func (b *Breaker) OnCapacityChange(f func(old, new int)) {
+	b.onCapacityChange = f
 }
 
 // Capacity returns the number of allowed in-flight requests on this breaker.
+// For unlimited breakers, it returns UnlimitedCapacity. It can be passed to
+// BreakerParams.RestoreCapacity to seed a new breaker with it.
 func (b *Breaker) Capacity() int {
+	if b.unlimited {
+		return UnlimitedCapacity
+	}
 	return b.sem.Capacity()
 }
 
 // newSemaphore creates a semaphore with the desired initial capacity.
-func newSemaphore(maxCapacity, initialCapacity int) *semaphore {
+func newSemaphore(maxCapacity, initialCapacity int, fifo bool) *semaphore {
 	queue := make(chan struct{}, maxCapacity)
-	sem := &semaphore{queue: queue}
+	sem := &semaphore{queue: queue, fifo: fifo}
 	sem.updateCapacity(initialCapacity)
 	return sem
 }
@@ -195,18 +902,51 @@ func newSemaphore(maxCapacity, initialCapacity int) *semaphore {
 type semaphore struct {
 	state atomic.Uint64
 	queue chan struct{}
+
+	// fifo makes the semaphore hand out tokens in the order they were asked
+	// for. In that mode, all modifications of state happen while holding mu
+	// and waiters holds a *waiter per waiting acquire, whose ready channel
+	// is closed once its tokens were handed over to it. queue is unused.
+	fifo    bool
+	mu      sync.Mutex
+	waiters list.List
+}
+
+// waiter is an acquire waiting for n tokens in fifo mode.
+type waiter struct {
+	n     uint64
+	ready chan struct{}
 }
 
 // tryAcquire receives a token from the semaphore if there is one otherwise returns false.
 func (s *semaphore) tryAcquire() bool {
+	return s.tryAcquireN(1)
+}
+
+// tryAcquireN tries to acquire n tokens without blocking. Either all or none
+// of them are acquired.
+func (s *semaphore) tryAcquireN(n int) bool {
+	if s.fifo {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.waiters.Len() > 0 {
+			// Don't jump the queue.
+			return false
+		}
+	}
+	return s.tryAcquireState(uint64(n))
+}
+
+// tryAcquireState receives n tokens at once by updating the state if there is
+// enough capacity for all of them.
+func (s *semaphore) tryAcquireState(n uint64) bool {
 	for {
 		old := s.state.Load()
 		capacity, in := unpack(old)
-		if in >= capacity {
+		if in+n > capacity {
 			return false
 		}
-		in++
-		if s.state.CAS(old, pack(capacity, in)) {
+		if s.state.CAS(old, pack(capacity, in+n)) {
 			return true
 		}
 	}
@@ -214,42 +954,104 @@ func (s *semaphore) tryAcquire() bool {
 
 // acquire acquires capacity from the semaphore.
 func (s *semaphore) acquire(ctx context.Context) error {
+	return s.acquireN(ctx, 1)
+}
+
+// acquireN acquires n tokens from the semaphore. All of them are acquired at
+// once, so a caller never holds a part of them while waiting for the rest,
+// which could otherwise deadlock concurrent callers.
+// Outside of fifo mode, callers asking for more than one token poll for
+// capacity rather than waiting to be woken up, so they never swallow a wakeup
+// that a caller asking for fewer tokens could have used.
+func (s *semaphore) acquireN(ctx context.Context, n int) error {
+	if s.fifo {
+		return s.acquireFIFO(ctx, uint64(n))
+	}
+
+	var poll <-chan time.Time
+	wakeup := s.queue
+	if n > 1 {
+		ticker := time.NewTicker(drainPollInterval)
+		defer ticker.Stop()
+		poll, wakeup = ticker.C, nil
+	}
 	for {
 		old := s.state.Load()
 		capacity, in := unpack(old)
 
-		if in >= capacity {
+		if in+uint64(n) > capacity {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case <-s.queue:
+			case <-wakeup:
+			case <-poll:
 			}
 			// Force reload state.
 			continue
 		}
 
-		in++
-		if s.state.CAS(old, pack(capacity, in)) {
+		if s.state.CAS(old, pack(capacity, in+uint64(n))) {
 			return nil
 		}
 	}
 }
 
+// acquireFIFO acquires n tokens from the semaphore after all the requests
+// that were already waiting.
+func (s *semaphore) acquireFIFO(ctx context.Context, n uint64) error {
+	s.mu.Lock()
+	if s.waiters.Len() == 0 && s.tryAcquireState(n) {
+		s.mu.Unlock()
+		return nil
+	}
+	w := &waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// The tokens were handed over concurrently, pass them on.
+			s.mu.Unlock()
+			s.releaseN(int(n))
+		default:
+			s.waiters.Remove(elem)
+			// A waiter asking for fewer tokens may fit now.
+			s.handOverLocked()
+			s.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
 // release releases capacity in the semaphore.
+func (s *semaphore) release() {
+	s.releaseN(1)
+}
+
+// releaseN releases n tokens acquired via acquireN.
 // If the semaphore capacity was reduced in between and as a result inFlight is greater
 // than capacity, we don't wake up goroutines as they'd not get any capacity anyway.
-func (s *semaphore) release() {
+func (s *semaphore) releaseN(n int) {
+	if s.fifo {
+		s.releaseFIFO(uint64(n))
+		return
+	}
 	for {
 		old := s.state.Load()
 		capacity, in := unpack(old)
 
-		if in == 0 {
-			panic("release and acquire are not paired")
+		if in < uint64(n) {
+			s.panicRelease(capacity, in)
 		}
 
-		in--
+		in -= uint64(n)
 		if s.state.CAS(old, pack(capacity, in)) {
-			if in < capacity {
+			for i := 0; i < n && in+uint64(i) < capacity; i++ {
 				select {
 				case s.queue <- struct{}{}:
 				default:
@@ -265,8 +1067,46 @@ func (s *semaphore) release() {
 	}
 }
 
+// releaseFIFO releases n tokens and hands them over to the longest waiting
+// requests, if any and if capacity wasn't reduced in between.
+func (s *semaphore) releaseFIFO(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		old := s.state.Load()
+		capacity, in := unpack(old)
+
+		if in < n {
+			s.panicRelease(capacity, in)
+		}
+
+		if s.state.CAS(old, pack(capacity, in-n)) {
+			s.handOverLocked()
+			return
+		}
+	}
+}
+
+// panicRelease panics because release and acquire are not paired. This is a
+// programming error, but carry the capacity numbers to ease debugging.
+func (s *semaphore) panicRelease(capacity, in uint64) {
+	panic(&CapacityError{
+		Err:            ErrRelease,
+		MaxConcurrency: cap(s.queue),
+		Capacity:       int(capacity),
+		InFlight:       int(in),
+	})
+}
+
 // updateCapacity updates the capacity of the semaphore to the desired size.
-func (s *semaphore) updateCapacity(size int) {
+// It returns the previous capacity and whether it was changed.
+func (s *semaphore) updateCapacity(size int) (int, bool) {
+	if s.fifo {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		defer s.handOverLocked()
+	}
+
 	s64 := uint64(size)
 	for {
 		old := s.state.Load()
@@ -274,7 +1114,7 @@ func (s *semaphore) updateCapacity(size int) {
 
 		if capacity == s64 {
 			// Nothing to do, exit early.
-			return
+			return int(capacity), false
 		}
 
 		if s.state.CAS(old, pack(s64, in)) {
@@ -287,9 +1127,83 @@ func (s *semaphore) updateCapacity(size int) {
 					}
 				}
 			}
+			return int(capacity), true
+		}
+	}
+}
+
+// handOverLocked hands tokens over to the waiting requests in order, as long
+// as there is capacity for all the tokens the first of them waits for. Must be
+// called with mu held.
+func (s *semaphore) handOverLocked() {
+	for s.waiters.Len() > 0 {
+		w := s.waiters.Front().Value.(*waiter)
+		old := s.state.Load()
+		capacity, in := unpack(old)
+		if in+w.n > capacity {
 			return
 		}
+		if s.state.CAS(old, pack(capacity, in+w.n)) {
+			s.waiters.Remove(s.waiters.Front())
+			close(w.ready)
+		}
+	}
+}
+
+// waitForCapacity blocks until no more tokens are acquired than the semaphore's
+// capacity allows, or ctx is done.
+func (s *semaphore) waitForCapacity(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if capacity, in := unpack(s.state.Load()); in <= capacity {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// available returns the number of tokens that can currently be acquired.
+func (s *semaphore) available() int {
+	capacity, in := unpack(s.state.Load())
+	if capacity > in {
+		return int(capacity - in)
+	}
+	return 0
+}
+
+// stats returns the capacity, the maximum capacity, the acquired and the
+// available tokens of the semaphore. They stem from a single snapshot of its
+// state, so they're consistent with each other. No lock is taken, which makes
+// it safe to call even while acquires or releases are stuck.
+func (s *semaphore) stats() (capacity, maxCapacity, inFlight, available int) {
+	c, in := unpack(s.state.Load())
+	if c > in {
+		available = int(c - in)
+	}
+	return int(c), cap(s.queue), int(in), available
+}
+
+// String formats the semaphore's stats for debug dumps.
+func (s *semaphore) String() string {
+	capacity, maxCapacity, inFlight, available := s.stats()
+	return fmt.Sprintf("capacity=%d maxCapacity=%d acquired=%d available=%d",
+		capacity, maxCapacity, inFlight, available)
+}
+
+// saturation returns the ratio of acquired tokens to the capacity of a single
+// snapshot of the semaphore's state, clamped to [0, 1].
+func (s *semaphore) saturation() float64 {
+	capacity, in := unpack(s.state.Load())
+	if in >= capacity {
+		// Also covers capacity == 0.
+		return 1
 	}
+	return float64(in) / float64(capacity)
 }
 
 // Capacity is the capacity of the semaphore.
@@ -298,6 +1212,12 @@ func (s *semaphore) Capacity() int {
 	return int(capacity)
 }
 
+// inFlight returns the number of tokens currently acquired from the semaphore.
+func (s *semaphore) inFlight() int {
+	_, in := unpack(s.state.Load())
+	return int(in)
+}
+
 // unpack takes an uint64 and returns two uint32 (as uint64) comprised of the leftmost
 // and the rightmost bits respectively.
 func unpack(in uint64) (uint64, uint64) {
@@ -310,3 +1230,64 @@ func unpack(in uint64) (uint64, uint64) {
 func pack(left, right uint64) uint64 {
 	return left<<32 | right
 }
+
+// holds tracks the tokens callers acquired from a semaphore, in the order they
+// acquired them, until they release them.
+type holds struct {
+	mu   sync.Mutex
+	list list.List
+
+	// doubleReleases counts the releases of holds that were released
+	// already, since the last audit.
+	doubleReleases int
+}
+
+// hold is the handle of the tokens a single caller acquired.
+type hold struct {
+	weight int
+	since  time.Time
+	elem   *list.Element
+}
+
+// add starts tracking weight tokens acquired just now.
+func (h *holds) add(weight int) *hold {
+	hd := &hold{weight: weight, since: time.Now()}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hd.elem = h.list.PushBack(hd)
+	return hd
+}
+
+// remove stops tracking the given hold. It returns false and counts a double
+// release if it was removed already.
+func (h *holds) remove(hd *hold) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hd.elem == nil {
+		h.doubleReleases++
+		return false
+	}
+	h.list.Remove(hd.elem)
+	hd.elem = nil
+	return true
+}
+
+// audit returns the number of tokens held, the number of them held for longer
+// than maxAge as of now, how long the oldest hold was held for and the double
+// releases since the last audit.
+func (h *holds) audit(now time.Time, maxAge time.Duration) (held, leaked int, oldest time.Duration, doubleReleases int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if front := h.list.Front(); front != nil {
+		oldest = now.Sub(front.Value.(*hold).since)
+	}
+	for e := h.list.Front(); e != nil; e = e.Next() {
+		hd := e.Value.(*hold)
+		held += hd.weight
+		if now.Sub(hd.since) > maxAge {
+			leaked += hd.weight
+		}
+	}
+	doubleReleases, h.doubleReleases = h.doubleReleases, 0
+	return held, leaked, oldest, doubleReleases
+}
@@ -18,9 +18,18 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.uber.org/atomic"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	logtesting "knative.dev/pkg/logging/testing"
 )
 
 const (
@@ -37,25 +46,42 @@ func TestBreakerInvalidConstructor(t *testing.T) {
 	tests := []struct {
 		name    string
 		options BreakerParams
+		want    string
 	}{{
-		name:    "QueueDepth = 0",
-		options: BreakerParams{QueueDepth: 0, MaxConcurrency: 1, InitialCapacity: 1},
+		name:    "QueueDepth negative",
+		options: BreakerParams{QueueDepth: -1, MaxConcurrency: 1, InitialCapacity: 1},
+		want:    "Queue depth must be 0 or greater. Got -1.",
 	}, {
 		name:    "MaxConcurrency negative",
 		options: BreakerParams{QueueDepth: 1, MaxConcurrency: -1, InitialCapacity: 1},
+		want:    "Max concurrency must be 0 or greater. Got -1.",
 	}, {
 		name:    "InitialCapacity negative",
 		options: BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: -1},
+		want:    "Initial capacity must be between 0 and max concurrency. Got -1.",
 	}, {
 		name:    "InitialCapacity out-of-bounds",
 		options: BreakerParams{QueueDepth: 1, MaxConcurrency: 5, InitialCapacity: 6},
+		want:    "Initial capacity must be between 0 and max concurrency. Got 6.",
+	}, {
+		name:    "SoftLimit out-of-bounds",
+		options: BreakerParams{QueueDepth: 1, MaxConcurrency: 5, InitialCapacity: 5, SoftLimit: 6},
+		want:    "Soft limit must be between 0 and max concurrency. Got 6.",
 	}}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			b, err := NewBreakerWithError(test.options)
+			if b != nil {
+				t.Error("NewBreakerWithError() returned a Breaker for invalid params")
+			}
+			if err == nil || err.Error() != test.want {
+				t.Errorf("NewBreakerWithError() = %v, want %q", err, test.want)
+			}
+
 			defer func() {
-				if r := recover(); r == nil {
-					t.Error("Expected a panic but the code didn't panic.")
+				if r := recover(); r != test.want {
+					t.Errorf("Panic = %v, want %q", r, test.want)
 				}
 			}()
 
@@ -64,6 +90,71 @@ func TestBreakerInvalidConstructor(t *testing.T) {
 	}
 }
 
+func TestNewBreakerParams(t *testing.T) {
+	tests := []struct {
+		name string
+		cc   int
+		want BreakerParams
+	}{{
+		name: "bounded",
+		cc:   10,
+		want: BreakerParams{QueueDepth: 100, MaxConcurrency: 10, InitialCapacity: 10},
+	}, {
+		name: "unbounded",
+		cc:   0,
+		want: BreakerParams{QueueDepth: MaxBreakerCapacity, MaxConcurrency: MaxBreakerCapacity, InitialCapacity: MaxBreakerCapacity},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NewBreakerParams(test.cc)
+			if !cmp.Equal(got, test.want) {
+				t.Errorf("NewBreakerParams() = %+v, want: %+v", got, test.want)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("Expected a panic but the code didn't panic.")
+			}
+		}()
+		NewBreakerParams(-1)
+	})
+}
+
+func TestBreakerRestoreCapacity(t *testing.T) {
+	params := BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 10}
+	b := NewBreaker(params)
+	b.UpdateConcurrency(4)
+
+	// Round trip the capacity to a new breaker.
+	restored := params
+	if err := restored.RestoreCapacity(b.Capacity()); err != nil {
+		t.Fatal("RestoreCapacity() =", err)
+	}
+	if got, want := NewBreaker(restored).Capacity(), 4; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+
+	for _, capacity := range []int{-1, 11} {
+		p := params
+		if err := p.RestoreCapacity(capacity); err == nil {
+			t.Errorf("RestoreCapacity(%d) = nil, want an error", capacity)
+		}
+		if !cmp.Equal(p, params) {
+			t.Errorf("RestoreCapacity(%d) changed the params to %+v", capacity, p)
+		}
+	}
+
+	// Unlimited breakers have nothing to restore.
+	unlimited := BreakerParams{Unlimited: true}
+	if err := unlimited.RestoreCapacity(NewBreaker(unlimited).Capacity()); err != nil {
+		t.Error("RestoreCapacity(unlimited) =", err)
+	}
+}
+
 func TestBreakerReserveOverload(t *testing.T) {
 	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
 	b := NewBreaker(params) // Breaker capacity = 2
@@ -82,130 +173,1088 @@ func TestBreakerReserveOverload(t *testing.T) {
 	if !rr {
 		t.Fatal("Reserve2 failed")
 	}
-	cb2()
+	cb2()
+}
+
+func TestBreakerOverloadMixed(t *testing.T) {
+	// This tests when reservation and maybe are intermised.
+	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
+	b := NewBreaker(params) // Breaker capacity = 2
+	reqs := newRequestor(b)
+
+	// Bring breaker to capacity.
+	reqs.request()
+	// This happens in go-routine, so spin.
+	for _, in := unpack(b.sem.state.Load()); in != 1; _, in = unpack(b.sem.state.Load()) {
+		time.Sleep(time.Millisecond * 2)
+	}
+	_, rr := b.Reserve(context.Background())
+	if rr {
+		t.Fatal("Reserve was an unexpected success.")
+	}
+	// Open a slot.
+	reqs.processSuccessfully(t)
+	// Now reservation should work.
+	cb, rr := b.Reserve(context.Background())
+	if !rr {
+		t.Fatal("Reserve unexpectedly failed")
+	}
+	// Process the reservation.
+	cb()
+}
+
+func TestBreakerOverload(t *testing.T) {
+	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
+	b := NewBreaker(params) // Breaker capacity = 2
+	reqs := newRequestor(b)
+
+	// Bring breaker to capacity.
+	reqs.request()
+	reqs.request()
+
+	// Overshoot by one.
+	reqs.request()
+	reqs.expectFailure(t)
+
+	// The remainer should succeed.
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerQueueing(t *testing.T) {
+	params := BreakerParams{QueueDepth: 2, MaxConcurrency: 1, InitialCapacity: 0}
+	b := NewBreaker(params) // Breaker capacity = 2
+	reqs := newRequestor(b)
+
+	// Bring breaker to capacity. Doesn't error because queue subsumes these requests.
+	reqs.request()
+	reqs.request()
+
+	// Update concurrency to allow the requests to be processed.
+	b.UpdateConcurrency(1)
+
+	// They should pass just fine.
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerNoOverload(t *testing.T) {
+	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
+	b := NewBreaker(params) // Breaker capacity = 2
+	reqs := newRequestor(b)
+
+	// Bring request to capacity.
+	reqs.request()
+	reqs.request()
+
+	// Process one, send a new one in, at capacity again.
+	reqs.processSuccessfully(t)
+	reqs.request()
+
+	// Process one, send a new one in, at capacity again.
+	reqs.processSuccessfully(t)
+	reqs.request()
+
+	// Process the remainder successfully.
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerCancel(t *testing.T) {
+	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 0}
+	b := NewBreaker(params)
+	reqs := newRequestor(b)
+
+	// Cancel a request which cannot get capacity.
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	reqs.requestWithContext(ctx1)
+	cancel1()
+	reqs.expectFailure(t)
+
+	// This request cannot get capacity either. This reproduced a bug we had when
+	// freeing slots on the pendingRequests channel.
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	reqs.requestWithContext(ctx2)
+	cancel2()
+	reqs.expectFailure(t)
+
+	// Let through a request with capacity then timeout following request
+	b.UpdateConcurrency(1)
+	reqs.request()
+
+	// Exceed capacity and assert one failure. This makes sure the Breaker is consistently
+	// at capacity.
+	reqs.request()
+	reqs.request()
+	reqs.expectFailure(t)
+
+	// This request cannot get capacity.
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	reqs.requestWithContext(ctx3)
+	cancel3()
+	reqs.expectFailure(t)
+
+	// The requests that were put in earlier should succeed.
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerActivePending(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 2, MaxConcurrency: 1, InitialCapacity: 1})
+	reqs := newRequestor(b)
+
+	if got, want := b.Active(), 0; got != want {
+		t.Errorf("Active() = %d, want: %d", got, want)
+	}
+	if got, want := b.Pending(), 0; got != want {
+		t.Errorf("Pending() = %d, want: %d", got, want)
+	}
+
+	// One request executes, the other one has to wait.
+	reqs.request()
+	reqs.request()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.Active() == 1 && b.Pending() == 1, nil
+	}); err != nil {
+		t.Errorf("Active() = %d, Pending() = %d, want: 1, 1", b.Active(), b.Pending())
+	}
+
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	if got, want := b.Active(), 0; got != want {
+		t.Errorf("Active() = %d, want: %d", got, want)
+	}
+	if got, want := b.Pending(), 0; got != want {
+		t.Errorf("Pending() = %d, want: %d", got, want)
+	}
+}
+
+func TestBreakerRejectedCount(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	reqs := newRequestor(b)
+
+	// Fill the breaker (one executing, one queued) and shed two more requests.
+	reqs.request()
+	reqs.request()
+	reqs.request()
+	reqs.expectFailure(t)
+	reqs.request()
+	reqs.expectFailure(t)
+	if got, want := b.RejectedCount(), uint64(2); got != want {
+		t.Errorf("RejectedCount() = %d, want: %d", got, want)
+	}
+
+	// Requests shed due to being unhealthy are counted as well.
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	b.SetHealthy(false)
+	reqs.request()
+	reqs.expectFailure(t)
+	if got, want := b.RejectedCount(), uint64(3); got != want {
+		t.Errorf("RejectedCount() = %d, want: %d", got, want)
+	}
+}
+
+func TestBreakerOnWait(t *testing.T) {
+	waits := make(chan time.Duration, 2)
+	b := NewBreaker(BreakerParams{
+		QueueDepth:      1,
+		MaxConcurrency:  1,
+		InitialCapacity: 1,
+		OnWait:          func(d time.Duration) { waits <- d },
+	})
+	reqs := newRequestor(b)
+
+	// The first request gets capacity right away.
+	reqs.request()
+	<-waits
+
+	// The second one has to wait for the first one to finish and the third one
+	// is rejected without reporting a wait time.
+	reqs.request()
+	reqs.request()
+	reqs.expectFailure(t)
+	const delay = 50 * time.Millisecond
+	time.Sleep(delay)
+	reqs.processSuccessfully(t)
+	if got := <-waits; got < delay {
+		t.Errorf("Wait time = %v, want >= %v", got, delay)
+	}
+	reqs.processSuccessfully(t)
+
+	select {
+	case d := <-waits:
+		t.Error("Got unexpected wait time:", d)
+	default:
+	}
+}
+
+func TestBreakerSoftLimit(t *testing.T) {
+	exceeded := make(chan int, 3)
+	b := NewBreaker(BreakerParams{
+		QueueDepth:          0,
+		MaxConcurrency:      3,
+		InitialCapacity:     3,
+		SoftLimit:           1,
+		OnSoftLimitExceeded: func(active int) { exceeded <- active },
+	})
+	reqs := newRequestor(b)
+	admit := func(want int) {
+		t.Helper()
+		reqs.request()
+		if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+			return b.Active() == want, nil
+		}); err != nil {
+			t.Fatalf("Active() = %d, want: %d", b.Active(), want)
+		}
+	}
+	expectExceeded := func(want ...int) {
+		t.Helper()
+		for _, w := range want {
+			if got := <-exceeded; got != w {
+				t.Errorf("OnSoftLimitExceeded(%d), want: %d", got, w)
+			}
+		}
+		select {
+		case got := <-exceeded:
+			t.Errorf("Unexpected OnSoftLimitExceeded(%d)", got)
+		default:
+		}
+	}
+
+	// The first request stays within the soft limit.
+	admit(1)
+	expectExceeded()
+
+	// The second one crosses it, but is admitted nonetheless, as is the third.
+	admit(2)
+	admit(3)
+	expectExceeded(2)
+
+	// The fourth one hits the hard limit.
+	reqs.request()
+	reqs.expectFailure(t)
+	expectExceeded()
+
+	// Dropping back to the soft limit rearms the callback.
+	reqs.processSuccessfully(t)
+	admit(3)
+	expectExceeded()
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	admit(2)
+	expectExceeded(2)
+
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerUpdateQueueDepth(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	reqs := newRequestor(b)
+
+	if err := b.UpdateQueueDepth(-1); err == nil {
+		t.Error("UpdateQueueDepth(-1) = nil, want an error")
+	}
+
+	// One request executing and one waiting fill the breaker.
+	reqs.request()
+	reqs.request()
+	reqs.request()
+	reqs.expectFailure(t)
+
+	// Growing the queue makes room for another waiting request.
+	if err := b.UpdateQueueDepth(2); err != nil {
+		t.Fatal("UpdateQueueDepth(2) =", err)
+	}
+	reqs.request()
+	reqs.request()
+	reqs.expectFailure(t)
+
+	// Shrinking the queue keeps the waiting requests, but sheds new ones.
+	if err := b.UpdateQueueDepth(1); err != nil {
+		t.Fatal("UpdateQueueDepth(1) =", err)
+	}
+	reqs.request()
+	reqs.expectFailure(t)
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerNoQueue(t *testing.T) {
+	// Capacity is below the maximum concurrency to make sure requests are
+	// rejected right away rather than waiting for capacity to be added.
+	b := NewBreaker(BreakerParams{QueueDepth: 0, MaxConcurrency: 3, InitialCapacity: 2})
+	reqs := newRequestor(b)
+	waitForActive := func(want int) {
+		t.Helper()
+		if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+			return b.Active() == want, nil
+		}); err != nil {
+			t.Fatalf("Active() = %d, want: %d", b.Active(), want)
+		}
+	}
+
+	reqs.request()
+	reqs.request()
+	waitForActive(2)
+	reqs.request()
+	reqs.expectFailure(t)
+
+	// Freeing capacity admits requests again.
+	reqs.processSuccessfully(t)
+	reqs.request()
+	waitForActive(2)
+	reqs.request()
+	reqs.expectFailure(t)
+
+	// Weighted requests need all of their capacity to be available.
+	if err := b.MaybeWeighted(context.Background(), 2, func() {}); !errors.Is(err, ErrRequestQueueFull) {
+		t.Errorf("MaybeWeighted() = %v, want: %v", err, ErrRequestQueueFull)
+	}
+	if got, want := b.Active(), 2; got != want {
+		t.Errorf("Active() = %d, want: %d", got, want)
+	}
+
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerNoQueueConcurrent(t *testing.T) {
+	const capacity, requests = 5, 50
+	b := NewBreaker(BreakerParams{QueueDepth: 0, MaxConcurrency: capacity, InitialCapacity: capacity})
+
+	block := make(chan struct{})
+	var (
+		wg       sync.WaitGroup
+		admitted atomic.Int64
+		rejected atomic.Int64
+	)
+	wg.Add(requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			defer wg.Done()
+			if err := b.Maybe(context.Background(), func() {
+				admitted.Inc()
+				<-block
+			}); err != nil {
+				rejected.Inc()
+			}
+		}()
+	}
+
+	// All requests beyond the capacity must fail right away, without
+	// any request finishing.
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return admitted.Load()+rejected.Load() == requests, nil
+	}); err != nil {
+		t.Fatalf("admitted = %d, rejected = %d, want a total of %d", admitted.Load(), rejected.Load(), requests)
+	}
+	if got, want := admitted.Load(), int64(capacity); got != want {
+		t.Errorf("admitted = %d, want: %d", got, want)
+	}
+	close(block)
+	wg.Wait()
+}
+
+func TestBreakerOnCapacityChange(t *testing.T) {
+	b := NewBreaker(BreakerParams{
+		QueueDepth:      1,
+		MaxConcurrency:  10,
+		InitialCapacity: 1,
+		Logger:          logtesting.TestLogger(t),
+	})
+
+	type change struct{ old, new int }
+	var got []change
+	b.OnCapacityChange(func(old, new int) {
+		got = append(got, change{old, new})
+	})
+
+	b.UpdateConcurrency(5)
+	b.UpdateConcurrency(5) // Unchanged, no call.
+	b.UpdateConcurrency(2)
+
+	want := []change{{1, 5}, {5, 2}}
+	if !cmp.Equal(got, want, cmp.AllowUnexported(change{})) {
+		t.Errorf("Capacity changes = %v, want: %v", got, want)
+	}
+}
+
+func TestBreakerUpdateConcurrencyBlocking(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 3, MaxConcurrency: 3, InitialCapacity: 3})
+	for i := 0; i < 3; i++ {
+		if !b.sem.tryAcquire() {
+			t.Fatal("Failed to acquire a token")
+		}
+	}
+
+	// Increasing the concurrency doesn't block.
+	if err := b.UpdateConcurrencyBlocking(context.Background(), 3); err != nil {
+		t.Fatal("UpdateConcurrencyBlocking() =", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- b.UpdateConcurrencyBlocking(context.Background(), 1)
+	}()
+
+	// One of the two requests in excess of the new limit is still in flight.
+	b.sem.release()
+	select {
+	case err := <-done:
+		t.Fatal("UpdateConcurrencyBlocking() returned before the excess requests drained:", err)
+	case <-time.After(semNoChangeTimeout):
+	}
+
+	b.sem.release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("UpdateConcurrencyBlocking() =", err)
+		}
+	case <-time.After(semAcquireTimeout):
+		t.Fatal("UpdateConcurrencyBlocking() didn't return after the excess requests drained")
+	}
+	if got, want := b.Capacity(), 1; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+
+	// Without anything draining, ctx bounds the wait.
+	ctx, cancel := context.WithTimeout(context.Background(), semNoChangeTimeout)
+	defer cancel()
+	if err := b.UpdateConcurrencyBlocking(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UpdateConcurrencyBlocking() = %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if got, want := b.Capacity(), 0; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+}
+
+func TestBreakerAudit(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 3, InitialCapacity: 2, TrackHolds: true})
+	reqs := newRequestor(b)
+
+	if acquired, available, err := b.Audit(time.Hour); acquired != 0 || available != 2 || err != nil {
+		t.Errorf("Audit() = %d, %d, %v, want: 0, 2, <nil>", acquired, available, err)
+	}
+
+	reqs.request()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.Active() == 1, nil
+	}); err != nil {
+		t.Fatal("Timed out waiting for the request to be admitted")
+	}
+	if acquired, available, err := b.Audit(time.Hour); acquired != 1 || available != 1 || err != nil {
+		t.Errorf("Audit() = %d, %d, %v, want: 1, 1, <nil>", acquired, available, err)
+	}
+
+	// Reducing capacity below the acquired tokens is no violation.
+	b.UpdateConcurrency(0)
+	if acquired, available, err := b.Audit(time.Hour); acquired != 1 || available != 0 || err != nil {
+		t.Errorf("Audit() = %d, %d, %v, want: 1, 0, <nil>", acquired, available, err)
+	}
+
+	// A request holding its token for longer than the max age is reported.
+	time.Sleep(10 * time.Millisecond)
+	acquired, available, err := b.Audit(time.Millisecond)
+	var capErr *CapacityError
+	if !errors.As(err, &capErr) || !errors.Is(err, ErrTokenLeak) {
+		t.Fatalf("Audit() = %v, want a CapacityError wrapping %v", err, ErrTokenLeak)
+	}
+	if acquired != 1 || available != 0 {
+		t.Errorf("Audit() = %d, %d, want: 1, 0", acquired, available)
+	}
+	if capErr.Leaked != 1 || capErr.OldestHold < 10*time.Millisecond {
+		t.Errorf("CapacityError = %+v, want 1 token leaked for at least 10ms", capErr)
+	}
+
+	reqs.processSuccessfully(t)
+	if acquired, available, err := b.Audit(time.Millisecond); acquired != 0 || available != 0 || err != nil {
+		t.Errorf("Audit() = %d, %d, %v, want: 0, 0, <nil>", acquired, available, err)
+	}
+}
+
+func TestBreakerAuditDoubleRelease(t *testing.T) {
+	for _, trackHolds := range []bool{false, true} {
+		t.Run(fmt.Sprint("trackHolds-", trackHolds), func(t *testing.T) {
+			b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 2, InitialCapacity: 2, TrackHolds: trackHolds})
+			release, ok := b.Reserve(context.Background())
+			if !ok {
+				t.Fatal("Reserve() = false, want true")
+			}
+			other, ok := b.Reserve(context.Background())
+			if !ok {
+				t.Fatal("Reserve() = false, want true")
+			}
+			defer other()
+
+			// Releasing twice doesn't give back the other caller's token, but
+			// is reported by the next audit only, if holds are tracked.
+			release()
+			release()
+			if got, want := b.InFlight(), 1; got != want {
+				t.Errorf("InFlight() = %d, want: %d", got, want)
+			}
+			if got, want := b.Active(), 1; got != want {
+				t.Errorf("Active() = %d, want: %d", got, want)
+			}
+			if _, _, err := b.Audit(time.Hour); trackHolds != errors.Is(err, ErrRelease) {
+				t.Errorf("Audit() = %v, want ErrRelease: %t", err, trackHolds)
+			}
+			if acquired, available, err := b.Audit(time.Hour); acquired != 1 || available != 1 || err != nil {
+				t.Errorf("Audit() = %d, %d, %v, want: 1, 1, <nil>", acquired, available, err)
+			}
+		})
+	}
+}
+
+func TestBreakerAuditConcurrent(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 5, InitialCapacity: 5, TrackHolds: true})
+
+	// Requests acquiring and releasing tokens while auditing aren't reported.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					b.Maybe(context.Background(), func() {})
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if _, _, err := b.Audit(time.Minute); err != nil {
+			t.Error("Audit() =", err)
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if acquired, available, err := b.Audit(time.Minute); acquired != 0 || available != 5 || err != nil {
+		t.Errorf("Audit() = %d, %d, %v, want: 0, 5, <nil>", acquired, available, err)
+	}
+}
+
+func TestBreakerStats(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 3, InitialCapacity: 2})
+	reqs := newRequestor(b)
+
+	reqs.request()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.Active() == 1, nil
+	}); err != nil {
+		t.Fatal("Timed out waiting for the request to be admitted")
+	}
+	if capacity, maxCapacity, active, available := b.Stats(); capacity != 2 || maxCapacity != 3 || active != 1 || available != 1 {
+		t.Errorf("Stats() = %d, %d, %d, %d, want: 2, 3, 1, 1", capacity, maxCapacity, active, available)
+	}
+	if got, want := b.String(), "capacity=2 maxCapacity=3 acquired=1 available=1 inFlight=1 pending=0 draining=false healthy=true"; got != want {
+		t.Errorf("String() = %q, want: %q", got, want)
+	}
+	reqs.processSuccessfully(t)
+
+	unlimited := NewBreaker(BreakerParams{Unlimited: true})
+	if capacity, maxCapacity, active, available := unlimited.Stats(); capacity != UnlimitedCapacity ||
+		maxCapacity != UnlimitedCapacity || active != 0 || available != UnlimitedCapacity {
+		t.Errorf("Stats() = %d, %d, %d, %d, want: %d, %d, 0, %d", capacity, maxCapacity, active, available,
+			UnlimitedCapacity, UnlimitedCapacity, UnlimitedCapacity)
+	}
+}
+
+func TestBreakerCanAdmit(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	if !b.CanAdmit() || !b.HasCapacity() {
+		t.Errorf("CanAdmit() = %t, HasCapacity() = %t, want: true, true", b.CanAdmit(), b.HasCapacity())
+	}
+
+	reqs := newRequestor(b)
+	reqs.request()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.Active() == 1, nil
+	}); err != nil {
+		t.Fatal("Timed out waiting for the request to be admitted")
+	}
+	if !b.CanAdmit() || b.HasCapacity() {
+		t.Errorf("CanAdmit() = %t, HasCapacity() = %t, want: true, false", b.CanAdmit(), b.HasCapacity())
+	}
+
+	reqs.request()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.Pending() == 1, nil
+	}); err != nil {
+		t.Fatal("Timed out waiting for the request to be queued")
+	}
+	if b.CanAdmit() || b.HasCapacity() {
+		t.Errorf("CanAdmit() = %t, HasCapacity() = %t, want: false, false", b.CanAdmit(), b.HasCapacity())
+	}
+
+	// Querying must not consume anything.
+	if got, want := b.InFlight(), 2; got != want {
+		t.Errorf("InFlight() = %d, want: %d", got, want)
+	}
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	if !b.CanAdmit() || !b.HasCapacity() {
+		t.Errorf("CanAdmit() = %t, HasCapacity() = %t, want: true, true", b.CanAdmit(), b.HasCapacity())
+	}
+
+	b.SetHealthy(false)
+	if b.CanAdmit() || b.HasCapacity() {
+		t.Error("Unhealthy breaker must not admit")
+	}
+
+	unlimited := NewBreaker(BreakerParams{Unlimited: true})
+	if !unlimited.CanAdmit() || !unlimited.HasCapacity() {
+		t.Error("Unlimited breaker must always admit")
+	}
+	unlimited.Drain()
+	if unlimited.CanAdmit() || unlimited.HasCapacity() {
+		t.Error("Draining breaker must not admit")
+	}
+
+	queueless := NewBreaker(BreakerParams{MaxConcurrency: 1, InitialCapacity: 0})
+	if queueless.CanAdmit() || queueless.HasCapacity() {
+		t.Error("Queueless breaker without capacity must not admit")
+	}
+}
+
+func TestBreakerStatsConcurrent(t *testing.T) {
+	const maxConcurrency = 10
+	b := NewBreaker(BreakerParams{QueueDepth: 100, MaxConcurrency: maxConcurrency, InitialCapacity: 5})
+
+	// Hammer the breaker with requests and capacity changes, while reading
+	// the stats. Each snapshot must be consistent in itself.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					b.Maybe(context.Background(), func() {})
+				}
+			}
+		}()
+	}
+	updaterDone := make(chan struct{})
+	go func() {
+		defer close(updaterDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				b.UpdateConcurrency(i % (maxConcurrency + 1))
+			}
+		}
+	}()
+
+	for i := 0; i < 10000; i++ {
+		capacity, maxCapacity, active, available := b.Stats()
+		if maxCapacity != maxConcurrency || capacity > maxCapacity || active > maxCapacity {
+			t.Fatalf("Stats() = %d, %d, %d, %d exceed the max capacity", capacity, maxCapacity, active, available)
+		}
+		if want := capacity - active; (want > 0 && available != want) || (want <= 0 && available != 0) {
+			t.Fatalf("Stats() = %d, %d, %d, %d, want available: %d", capacity, maxCapacity, active, available, want)
+		}
+		_ = b.String()
+	}
+
+	close(stop)
+	<-updaterDone
+	// Give the requests stuck at zero capacity a way out.
+	b.UpdateConcurrency(maxConcurrency)
+	wg.Wait()
+}
+
+func TestBreakerUnlimited(t *testing.T) {
+	const requests = 1000
+	b := NewBreaker(BreakerParams{Unlimited: true})
+
+	if got, want := b.Capacity(), UnlimitedCapacity; got != want {
+		t.Errorf("Capacity() = %d, want: %d", got, want)
+	}
+	b.UpdateConcurrency(10)
+	if got, want := b.Capacity(), UnlimitedCapacity; got != want {
+		t.Errorf("Capacity() after UpdateConcurrency = %d, want: %d", got, want)
+	}
+
+	// All requests execute at the same time, none of them is blocked.
+	block := make(chan struct{})
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			errs <- b.Maybe(context.Background(), func() { <-block })
+		}()
+	}
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.InFlight() == requests, nil
+	}); err != nil {
+		t.Fatalf("InFlight() = %d, want: %d", b.InFlight(), requests)
+	}
+	if got, want := b.Active(), requests; got != want {
+		t.Errorf("Active() = %d, want: %d", got, want)
+	}
+	if got := b.Pending(); got != 0 {
+		t.Errorf("Pending() = %d, want: 0", got)
+	}
+
+	// Reservations are always granted, too, and only released once.
+	release, ok := b.Reserve(context.Background())
+	if !ok {
+		t.Fatal("Reserve() = false, want: true")
+	}
+	release()
+	release()
+	if got, want := b.InFlight(), requests; got != want {
+		t.Errorf("InFlight() after double release = %d, want: %d", got, want)
+	}
+
+	close(block)
+	for i := 0; i < requests; i++ {
+		if err := <-errs; err != nil {
+			t.Error("Maybe() =", err)
+		}
+	}
+	if got := b.InFlight(); got != 0 {
+		t.Errorf("InFlight() = %d, want: 0", got)
+	}
+}
+
+func TestBreakerMaybeCtx(t *testing.T) {
+	type key struct{}
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "value"), semAcquireTimeout)
+	defer cancel()
+	var got context.Context
+	if err := b.MaybeCtx(ctx, func(ctx context.Context) { got = ctx }); err != nil {
+		t.Fatal("MaybeCtx() =", err)
+	}
+	if got == nil || got.Value(key{}) != "value" {
+		t.Error("The thunk didn't get the request's context")
+	}
+	if want, _ := ctx.Deadline(); got != nil {
+		if d, ok := got.Deadline(); !ok || !d.Equal(want) {
+			t.Errorf("Deadline = %v, want: %v", d, want)
+		}
+	}
+
+	// A context that is done by the time capacity is acquired doesn't execute
+	// the thunk.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	called := false
+	if err := b.MaybeCtx(ctx, func(context.Context) { called = true }); !errors.Is(err, context.Canceled) {
+		t.Errorf("MaybeCtx() = %v, want: %v", err, context.Canceled)
+	}
+	if called {
+		t.Error("The thunk was executed with a done context")
+	}
+}
+
+func TestBreakerMaybeCtxTimeout(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1, Timeout: 20 * time.Millisecond})
+
+	// A thunk exceeding the timeout is cancelled and gives its capacity back.
+	if err := b.MaybeCtx(context.Background(), func(ctx context.Context) { <-ctx.Done() }); !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("MaybeCtx() = %v, want: %v", err, ErrRequestTimeout)
+	}
+	if got, want := b.TimedOutCount(), uint64(1); got != want {
+		t.Errorf("TimedOutCount() = %d, want: %d", got, want)
+	}
+	if acquired, available, err := b.Audit(time.Minute); err != nil || acquired != 0 || available != 1 {
+		t.Errorf("Audit() = %d, %d, %v, want: 0, 1, nil", acquired, available, err)
+	}
+
+	// A thunk finishing in time is unaffected.
+	if err := b.MaybeCtx(context.Background(), func(context.Context) {}); err != nil {
+		t.Error("MaybeCtx() =", err)
+	}
+
+	// A request cancelled by its caller doesn't count as timed out.
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := b.MaybeCtx(ctx, func(ctx context.Context) { cancel() }); err != nil {
+		t.Error("MaybeCtx() =", err)
+	}
+	if got, want := b.TimedOutCount(), uint64(1); got != want {
+		t.Errorf("TimedOutCount() = %d, want: %d", got, want)
+	}
+	if got, want := b.RejectedCount(), uint64(0); got != want {
+		t.Errorf("RejectedCount() = %d, want: %d", got, want)
+	}
+}
+
+func TestBreakerWaitForCapacity(t *testing.T) {
+	const waiters = 50
+	b := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 10, InitialCapacity: 0})
+
+	errs := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			errs <- b.WaitForCapacity(context.Background())
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		t.Fatal("WaitForCapacity() returned without capacity:", err)
+	case <-time.After(semNoChangeTimeout):
+	}
+
+	b.UpdateConcurrency(5)
+	for i := 0; i < waiters; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Error("WaitForCapacity() =", err)
+			}
+		case <-time.After(semAcquireTimeout):
+			t.Fatalf("Only %d of %d waiters woke up", i, waiters)
+		}
+	}
+
+	// Capacity is there already.
+	if err := b.WaitForCapacity(context.Background()); err != nil {
+		t.Error("WaitForCapacity() =", err)
+	}
+}
+
+func TestBreakerWaitForCapacityCancel(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 0})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := b.WaitForCapacity(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForCapacity() = %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > waitPollMax+semNoChangeTimeout {
+		t.Errorf("WaitForCapacity() took %v to return after cancellation", d)
+	}
+
+	b.Drain()
+	if err := b.WaitForCapacity(context.Background()); !errors.Is(err, ErrDraining) {
+		t.Errorf("WaitForCapacity() = %v, want: %v", err, ErrDraining)
+	}
 }
 
-func TestBreakerOverloadMixed(t *testing.T) {
-	// This tests when reservation and maybe are intermised.
-	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
-	b := NewBreaker(params) // Breaker capacity = 2
-	reqs := newRequestor(b)
+func TestBreakerSaturation(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		inFlight int
+		want     float64
+	}{{
+		name:     "idle",
+		capacity: 4,
+		want:     0,
+	}, {
+		name:     "partially saturated",
+		capacity: 4,
+		inFlight: 1,
+		want:     0.25,
+	}, {
+		name:     "saturated",
+		capacity: 4,
+		inFlight: 4,
+		want:     1,
+	}, {
+		name:     "over-subscribed",
+		capacity: 2,
+		inFlight: 4,
+		want:     1,
+	}, {
+		name: "zero capacity",
+		want: 1,
+	}}
 
-	// Bring breaker to capacity.
-	reqs.request()
-	// This happens in go-routine, so spin.
-	for _, in := unpack(b.sem.state.Load()); in != 1; _, in = unpack(b.sem.state.Load()) {
-		time.Sleep(time.Millisecond * 2)
-	}
-	_, rr := b.Reserve(context.Background())
-	if rr {
-		t.Fatal("Reserve was an unexpected success.")
-	}
-	// Open a slot.
-	reqs.processSuccessfully(t)
-	// Now reservation should work.
-	cb, rr := b.Reserve(context.Background())
-	if !rr {
-		t.Fatal("Reserve unexpectedly failed")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 10, InitialCapacity: 10})
+			b.sem.state.Store(pack(uint64(test.capacity), uint64(test.inFlight)))
+			if got := b.Saturation(); got != test.want {
+				t.Errorf("Saturation() = %v, want: %v", got, test.want)
+			}
+		})
 	}
-	// Process the reservation.
-	cb()
+
+	t.Run("unlimited", func(t *testing.T) {
+		if got := NewBreaker(BreakerParams{Unlimited: true}).Saturation(); got != 0 {
+			t.Errorf("Saturation() = %v, want: 0", got)
+		}
+	})
 }
 
-func TestBreakerOverload(t *testing.T) {
-	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
-	b := NewBreaker(params) // Breaker capacity = 2
+func TestBreakerMaybeWeighted(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 3, InitialCapacity: 3})
 	reqs := newRequestor(b)
 
-	// Bring breaker to capacity.
-	reqs.request()
-	reqs.request()
+	if err := b.MaybeWeighted(context.Background(), 4, func() {
+		t.Error("Thunk was executed for a request exceeding the maximum concurrency")
+	}); err != ErrWeightExceedsCapacity {
+		t.Errorf("MaybeWeighted() = %v, want: %v", err, ErrWeightExceedsCapacity)
+	}
 
-	// Overshoot by one.
+	// Active counts requests, while the capacity they hold depends on their
+	// weight.
+	waitFor := func(active, acquired int) {
+		t.Helper()
+		if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+			return b.Active() == active && b.sem.inFlight() == acquired, nil
+		}); err != nil {
+			t.Fatalf("Active(), acquired = %d, %d, want: %d, %d", b.Active(), b.sem.inFlight(), active, acquired)
+		}
+	}
+
+	// A heavy request takes two units of capacity.
+	reqs.requestWeighted(context.Background(), 2)
+	waitFor(1, 2)
+
+	// Another heavy request has to wait, but doesn't hold a part of what it
+	// needs meanwhile: a light request still fits next to the first one.
+	ctx, cancel := context.WithCancel(context.Background())
+	reqs.requestWeighted(ctx, 2)
 	reqs.request()
+	waitFor(2, 3)
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.Pending() == 1, nil
+	}); err != nil {
+		t.Fatalf("Pending() = %d, want: 1", b.Pending())
+	}
+	cancel()
 	reqs.expectFailure(t)
 
-	// The remainer should succeed.
 	reqs.processSuccessfully(t)
 	reqs.processSuccessfully(t)
+	waitFor(0, 0)
 }
 
-func TestBreakerQueueing(t *testing.T) {
-	params := BreakerParams{QueueDepth: 2, MaxConcurrency: 1, InitialCapacity: 0}
-	b := NewBreaker(params) // Breaker capacity = 2
-	reqs := newRequestor(b)
-
-	// Bring breaker to capacity. Doesn't error because queue subsumes these requests.
-	reqs.request()
-	reqs.request()
+func TestBreakerMaybeWeightedConcurrent(t *testing.T) {
+	const (
+		capacity = 2
+		rounds   = 100
+	)
+	for _, fifo := range []bool{false, true} {
+		t.Run(fmt.Sprint("fifo=", fifo), func(t *testing.T) {
+			b := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: capacity, InitialCapacity: capacity, FIFO: fifo})
+			ctx, cancel := context.WithTimeout(context.Background(), semAcquireTimeout)
+			defer cancel()
 
-	// Update concurrency to allow the requests to be processed.
-	b.UpdateConcurrency(1)
+			// Two requests each asking for the whole capacity must take turns
+			// rather than each holding a part of it and waiting for the other.
+			var wg sync.WaitGroup
+			wg.Add(2)
+			for i := 0; i < 2; i++ {
+				go func() {
+					defer wg.Done()
+					for j := 0; j < rounds; j++ {
+						if err := b.MaybeWeighted(ctx, capacity, func() {
+							if got := b.sem.inFlight(); got != capacity {
+								t.Errorf("inFlight() = %d, want: %d", got, capacity)
+							}
+						}); err != nil {
+							t.Error("MaybeWeighted() =", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
 
-	// They should pass just fine.
-	reqs.processSuccessfully(t)
-	reqs.processSuccessfully(t)
+			if got := b.sem.inFlight(); got != 0 {
+				t.Errorf("inFlight() = %d, want: 0", got)
+			}
+		})
+	}
 }
 
-func TestBreakerNoOverload(t *testing.T) {
-	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1}
-	b := NewBreaker(params) // Breaker capacity = 2
+func TestBreakerDrain(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
 	reqs := newRequestor(b)
 
-	// Bring request to capacity.
+	// One request executing and one waiting.
 	reqs.request()
 	reqs.request()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return b.InFlight() == 2, nil
+	}); err != nil {
+		t.Fatalf("InFlight() = %d, want: 2", b.InFlight())
+	}
 
-	// Process one, send a new one in, at capacity again.
-	reqs.processSuccessfully(t)
-	reqs.request()
+	// Waiting times out, as the requests are still running.
+	ctx, cancel := context.WithTimeout(context.Background(), semNoChangeTimeout)
+	defer cancel()
+	if err := b.DrainAndWait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("DrainAndWait() = %v, want: %v", err, context.DeadlineExceeded)
+	}
 
-	// Process one, send a new one in, at capacity again.
-	reqs.processSuccessfully(t)
-	reqs.request()
+	// New requests are rejected.
+	if err := b.Maybe(context.Background(), func() {
+		t.Error("Thunk was executed on a draining breaker")
+	}); err != ErrDraining {
+		t.Errorf("Maybe() = %v, want: %v", err, ErrDraining)
+	}
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() succeeded on a draining breaker")
+	}
 
-	// Process the remainder successfully.
+	// The admitted requests finish and waiting returns.
+	done := make(chan error)
+	go func() {
+		done <- b.DrainAndWait(context.Background())
+	}()
 	reqs.processSuccessfully(t)
 	reqs.processSuccessfully(t)
+	if err := <-done; err != nil {
+		t.Error("DrainAndWait() =", err)
+	}
 }
 
-func TestBreakerCancel(t *testing.T) {
-	params := BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 0}
-	b := NewBreaker(params)
-	reqs := newRequestor(b)
-
-	// Cancel a request which cannot get capacity.
-	ctx1, cancel1 := context.WithCancel(context.Background())
-	reqs.requestWithContext(ctx1)
-	cancel1()
-	reqs.expectFailure(t)
-
-	// This request cannot get capacity either. This reproduced a bug we had when
-	// freeing slots on the pendingRequests channel.
-	ctx2, cancel2 := context.WithCancel(context.Background())
-	reqs.requestWithContext(ctx2)
-	cancel2()
-	reqs.expectFailure(t)
-
-	// Let through a request with capacity then timeout following request
-	b.UpdateConcurrency(1)
-	reqs.request()
-
-	// Exceed capacity and assert one failure. This makes sure the Breaker is consistently
-	// at capacity.
-	reqs.request()
-	reqs.request()
-	reqs.expectFailure(t)
+func TestBreakerSetHealthy(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
 
-	// This request cannot get capacity.
-	ctx3, cancel3 := context.WithCancel(context.Background())
-	reqs.requestWithContext(ctx3)
-	cancel3()
-	reqs.expectFailure(t)
+	b.SetHealthy(false)
+	if err := b.Maybe(context.Background(), func() {
+		t.Error("Thunk was executed on an unhealthy breaker")
+	}); err != ErrUnhealthy {
+		t.Errorf("Maybe() = %v, want: %v", err, ErrUnhealthy)
+	}
+	if _, ok := b.Reserve(context.Background()); ok {
+		t.Error("Reserve() succeeded on an unhealthy breaker")
+	}
+	if got := b.InFlight(); got != 0 {
+		t.Errorf("InFlight() = %d, want: 0", got)
+	}
 
-	// The requests that were put in earlier should succeed.
-	reqs.processSuccessfully(t)
-	reqs.processSuccessfully(t)
+	b.SetHealthy(true)
+	executed := false
+	if err := b.Maybe(context.Background(), func() {
+		executed = true
+	}); err != nil {
+		t.Errorf("Maybe() = %v, want: nil", err)
+	}
+	if !executed {
+		t.Error("Thunk was not executed on a healthy breaker")
+	}
+	release, ok := b.Reserve(context.Background())
+	if !ok {
+		t.Fatal("Reserve() failed on a healthy breaker")
+	}
+	release()
 }
 
 func TestBreakerUpdateConcurrency(t *testing.T) {
@@ -223,11 +1272,74 @@ func TestBreakerUpdateConcurrency(t *testing.T) {
 
 }
 
+func TestBreakerEstimatedWait(t *testing.T) {
+	const thunkDuration = 20 * time.Millisecond
+
+	params := BreakerParams{QueueDepth: 10, MaxConcurrency: 1, InitialCapacity: 1, EstimateWait: true}
+	b := NewBreaker(params)
+
+	if got := b.EstimatedWait(); got != 0 {
+		t.Errorf("EstimatedWait() = %v without any requests, want: 0", got)
+	}
+
+	// Seed the rolling average with a couple of requests of known duration.
+	for i := 0; i < 3; i++ {
+		b.Maybe(context.Background(), func() {
+			time.Sleep(thunkDuration)
+		})
+	}
+
+	// Capacity is available, so no waiting is expected.
+	if got := b.EstimatedWait(); got != 0 {
+		t.Errorf("EstimatedWait() = %v with free capacity, want: 0", got)
+	}
+
+	// Occupy the only slot and queue two requests behind it.
+	reqs := newRequestor(b)
+	reqs.request()
+	reqs.request()
+	reqs.request()
+	for b.InFlight() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Two requests are queued, so a new one has to wait for roughly three
+	// thunk executions.
+	if got, min, max := b.EstimatedWait(), 3*thunkDuration, 6*thunkDuration; got < min || got > max {
+		t.Errorf("EstimatedWait() = %v, want between %v and %v", got, min, max)
+	}
+
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
+func TestBreakerEstimatedWaitDisabled(t *testing.T) {
+	b := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 1, InitialCapacity: 1})
+	b.Maybe(context.Background(), func() {
+		time.Sleep(time.Millisecond)
+	})
+
+	// Without estimating wait times, no durations are recorded.
+	reqs := newRequestor(b)
+	reqs.request()
+	reqs.request()
+	for b.InFlight() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := b.EstimatedWait(); got != 0 {
+		t.Errorf("EstimatedWait() = %v, want: 0", got)
+	}
+
+	reqs.processSuccessfully(t)
+	reqs.processSuccessfully(t)
+}
+
 // Test empty semaphore, token cannot be acquired
 func TestSemaphoreAcquireHasNoCapacity(t *testing.T) {
 	gotChan := make(chan struct{}, 1)
 
-	sem := newSemaphore(1, 0)
+	sem := newSemaphore(1, 0, false)
 	tryAcquire(sem, gotChan)
 
 	select {
@@ -239,7 +1351,7 @@ func TestSemaphoreAcquireHasNoCapacity(t *testing.T) {
 }
 
 func TestSemaphoreAcquireNonBlockingHasNoCapacity(t *testing.T) {
-	sem := newSemaphore(1, 0)
+	sem := newSemaphore(1, 0, false)
 	if sem.tryAcquire() {
 		t.Error("Should have failed immediately")
 	}
@@ -250,7 +1362,7 @@ func TestSemaphoreAcquireHasCapacity(t *testing.T) {
 	gotChan := make(chan struct{}, 1)
 	want := 1
 
-	sem := newSemaphore(1, 0)
+	sem := newSemaphore(1, 0, false)
 	tryAcquire(sem, gotChan)
 	sem.updateCapacity(1) // Allows 1 acquire
 
@@ -272,7 +1384,7 @@ func TestSemaphoreAcquireHasCapacity(t *testing.T) {
 }
 
 func TestSemaphoreRelease(t *testing.T) {
-	sem := newSemaphore(1, 1)
+	sem := newSemaphore(1, 1, false)
 	sem.acquire(context.Background())
 	func() {
 		defer func() {
@@ -284,8 +1396,21 @@ func TestSemaphoreRelease(t *testing.T) {
 	}()
 	func() {
 		defer func() {
-			if e := recover(); e == nil {
-				t.Error("Expected panic, but got none")
+			e := recover()
+			if e == nil {
+				t.Fatal("Expected panic, but got none")
+			}
+			err, ok := e.(error)
+			if !ok || !errors.Is(err, ErrRelease) {
+				t.Fatalf("Panic = %v, want an error wrapping %v", e, ErrRelease)
+			}
+			var capErr *CapacityError
+			if !errors.As(err, &capErr) {
+				t.Fatalf("Panic = %v, want a *CapacityError", e)
+			}
+			want := CapacityError{Err: ErrRelease, MaxConcurrency: 1, Capacity: 1}
+			if !cmp.Equal(*capErr, want, cmpopts.EquateErrors()) {
+				t.Error("CapacityError (-want, +got) =", cmp.Diff(want, *capErr, cmpopts.EquateErrors()))
 			}
 		}()
 		sem.release()
@@ -294,7 +1419,7 @@ func TestSemaphoreRelease(t *testing.T) {
 
 func TestSemaphoreUpdateCapacity(t *testing.T) {
 	const initialCapacity = 1
-	sem := newSemaphore(3, initialCapacity)
+	sem := newSemaphore(3, initialCapacity, false)
 	if got, want := sem.Capacity(), 1; got != want {
 		t.Errorf("Capacity = %d, want: %d", got, want)
 	}
@@ -305,6 +1430,121 @@ func TestSemaphoreUpdateCapacity(t *testing.T) {
 	}
 }
 
+func TestSemaphoreFIFO(t *testing.T) {
+	const waiters = 10
+	sem := newSemaphore(1, 1, true)
+	if err := sem.acquire(context.Background()); err != nil {
+		t.Fatal("acquire() =", err)
+	}
+
+	order := make(chan int, waiters)
+	for i := 0; i < waiters; i++ {
+		i := i
+		go func() {
+			if err := sem.acquire(context.Background()); err != nil {
+				t.Error("acquire() =", err)
+				return
+			}
+			order <- i
+			sem.release()
+		}()
+		// Wait for the goroutine to be queued up before starting the next one.
+		if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+			sem.mu.Lock()
+			defer sem.mu.Unlock()
+			return sem.waiters.Len() == i+1, nil
+		}); err != nil {
+			t.Fatal("Waiter was never queued:", err)
+		}
+	}
+
+	if sem.tryAcquire() {
+		t.Error("tryAcquire() = true, want false while others are waiting")
+	}
+
+	sem.release()
+	for want := 0; want < waiters; want++ {
+		select {
+		case got := <-order:
+			if got != want {
+				t.Errorf("Waiter %d acquired before waiter %d", got, want)
+			}
+		case <-time.After(semAcquireTimeout):
+			t.Fatalf("Waiter %d never acquired a token", want)
+		}
+	}
+	if got := sem.inFlight(); got != 0 {
+		t.Errorf("inFlight() = %d, want 0", got)
+	}
+}
+
+func TestSemaphoreFIFOCancel(t *testing.T) {
+	sem := newSemaphore(1, 1, true)
+	sem.acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() { errCh <- sem.acquire(ctx) }()
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		sem.mu.Lock()
+		defer sem.mu.Unlock()
+		return sem.waiters.Len() == 1, nil
+	}); err != nil {
+		t.Fatal("Waiter was never queued:", err)
+	}
+	cancel()
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("acquire() = %v, want %v", err, context.Canceled)
+	}
+
+	sem.release()
+	if !sem.tryAcquire() {
+		t.Error("tryAcquire() = false, want the token back after the waiter gave up")
+	}
+}
+
+func TestSemaphoreFIFOWeightedCancel(t *testing.T) {
+	sem := newSemaphore(2, 2, true)
+	sem.acquire(context.Background())
+
+	waitForWaiters := func(want int) {
+		t.Helper()
+		if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+			sem.mu.Lock()
+			defer sem.mu.Unlock()
+			return sem.waiters.Len() == want, nil
+		}); err != nil {
+			t.Fatal("Waiter was never queued:", err)
+		}
+	}
+
+	// The heavy waiter doesn't fit and the light one queues up behind it.
+	ctx, cancel := context.WithCancel(context.Background())
+	heavyCh := make(chan error)
+	go func() { heavyCh <- sem.acquireN(ctx, 2) }()
+	waitForWaiters(1)
+	lightCh := make(chan error)
+	go func() { lightCh <- sem.acquire(context.Background()) }()
+	waitForWaiters(2)
+
+	// Once the heavy waiter gives up, the light one gets the free token.
+	cancel()
+	if err := <-heavyCh; err != context.Canceled {
+		t.Errorf("acquireN() = %v, want %v", err, context.Canceled)
+	}
+	select {
+	case err := <-lightCh:
+		if err != nil {
+			t.Error("acquire() =", err)
+		}
+	case <-time.After(semAcquireTimeout):
+		t.Fatal("The light waiter never acquired a token")
+	}
+	if got := sem.inFlight(); got != 2 {
+		t.Errorf("inFlight() = %d, want 2", got)
+	}
+}
+
 func TestPackUnpack(t *testing.T) {
 	wantL := uint64(256)
 	wantR := uint64(513)
@@ -356,6 +1596,17 @@ func (r *requestor) requestWithContext(ctx context.Context) {
 	}()
 }
 
+// requestWeighted is like requestWithContext, but requests the given weight
+// of capacity.
+func (r *requestor) requestWeighted(ctx context.Context, weight int) {
+	go func() {
+		err := r.breaker.MaybeWeighted(ctx, weight, func() {
+			<-r.barrierCh
+		})
+		r.acceptedCh <- err == nil
+	}()
+}
+
 // expectFailure waits for a request to finish and asserts it to be failed.
 func (r *requestor) expectFailure(t *testing.T) {
 	t.Helper()
@@ -422,3 +1673,109 @@ func BenchmarkBreakerReserve(b *testing.B) {
 		})
 	})
 }
+
+// benchmarkBreakerOptions are the optional breaker features that cost
+// something per request, to benchmark them separately and combined as the
+// queue-proxy sets them.
+var benchmarkBreakerOptions = []struct {
+	name   string
+	params func(BreakerParams) BreakerParams
+}{{
+	name:   "default",
+	params: func(p BreakerParams) BreakerParams { return p },
+}, {
+	name: "fifo",
+	params: func(p BreakerParams) BreakerParams {
+		p.FIFO = true
+		return p
+	},
+}, {
+	name: "track-holds",
+	params: func(p BreakerParams) BreakerParams {
+		p.TrackHolds = true
+		return p
+	},
+}, {
+	name: "estimate-wait",
+	params: func(p BreakerParams) BreakerParams {
+		p.EstimateWait = true
+		return p
+	},
+}, {
+	name: "queue-proxy",
+	params: func(p BreakerParams) BreakerParams {
+		p.TrackHolds = true
+		p.EstimateWait = true
+		return p
+	},
+}}
+
+func BenchmarkBreakerMaybeOptions(b *testing.B) {
+	op := func() {}
+
+	for _, opt := range benchmarkBreakerOptions {
+		breaker := NewBreaker(opt.params(BreakerParams{QueueDepth: 10000000, MaxConcurrency: 100, InitialCapacity: 100}))
+
+		b.Run(opt.name+"-sequential", func(b *testing.B) {
+			for j := 0; j < b.N; j++ {
+				breaker.Maybe(context.Background(), op)
+			}
+		})
+
+		b.Run(opt.name+"-parallel", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					breaker.Maybe(context.Background(), op)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkBreakerReserveOptions(b *testing.B) {
+	for _, opt := range benchmarkBreakerOptions {
+		breaker := NewBreaker(opt.params(BreakerParams{QueueDepth: 1, MaxConcurrency: 10000000, InitialCapacity: 10000000}))
+
+		b.Run(opt.name+"-sequential", func(b *testing.B) {
+			for j := 0; j < b.N; j++ {
+				if free, got := breaker.Reserve(context.Background()); got {
+					free()
+				}
+			}
+		})
+
+		b.Run(opt.name+"-parallel", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if free, got := breaker.Reserve(context.Background()); got {
+						free()
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkSemaphoreAcquireRelease(b *testing.B) {
+	for _, fifo := range []bool{false, true} {
+		for _, c := range []int{1, 10, 100, 1000, 10000} {
+			sem := newSemaphore(c, c, fifo)
+
+			b.Run(fmt.Sprintf("%d-fifo-%t-sequential", c, fifo), func(b *testing.B) {
+				for j := 0; j < b.N; j++ {
+					sem.acquire(context.Background())
+					sem.release()
+				}
+			})
+
+			b.Run(fmt.Sprintf("%d-fifo-%t-parallel", c, fifo), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						sem.acquire(context.Background())
+						sem.release()
+					}
+				})
+			})
+		}
+	}
+}
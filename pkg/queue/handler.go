@@ -19,17 +19,26 @@ package queue
 import (
 	"context"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"go.opencensus.io/trace"
 	network "knative.dev/networking/pkg"
 	"knative.dev/serving/pkg/activator"
+	pkghttp "knative.dev/serving/pkg/http"
 )
 
+// statusClientClosedRequest is the non-standard status, borrowed from nginx,
+// of requests the client cancelled before they were answered. The client
+// never sees it, but it keeps those requests apart in logs and metrics.
+const statusClientClosedRequest = 499
+
 // ProxyHandler sends requests to the `next` handler at a rate controlled by
-// the passed `breaker`, while recording stats to `stats`.
-func ProxyHandler(breaker *Breaker, stats *network.RequestStats, tracingEnabled bool, next http.Handler) http.HandlerFunc {
+// the passed `breaker`, while recording stats to `stats`. If set, `onReject`
+// is called for every request the breaker sheds.
+func ProxyHandler(breaker *Breaker, stats *network.RequestStats, tracingEnabled bool, onReject func(), next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if network.IsKubeletProbe(r) {
 			next.ServeHTTP(w, r)
@@ -59,14 +68,35 @@ func ProxyHandler(breaker *Breaker, stats *network.RequestStats, tracingEnabled
 			if tracingEnabled {
 				_, waitSpan = trace.StartSpan(r.Context(), "queue_wait")
 			}
-			if err := breaker.Maybe(r.Context(), func() {
+			if err := breaker.MaybeCtx(r.Context(), func(ctx context.Context) {
 				waitSpan.End()
-				next.ServeHTTP(w, r)
+				rw := w
+				if breaker.timeout > 0 {
+					// Let TimeoutErrorHandler know whether the response was started.
+					rw = pkghttp.NewResponseRecorder(w, http.StatusOK)
+				}
+				next.ServeHTTP(rw, r.WithContext(ctx))
 			}); err != nil {
+				if errors.Is(err, ErrRequestTimeout) {
+					// The response was already written by next, see TimeoutErrorHandler.
+					return
+				}
 				waitSpan.End()
-				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRequestQueueFull) {
+				switch {
+				case errors.Is(err, context.Canceled):
+					// The client went away while the request was queued or right
+					// after it got capacity, nobody is left to retry.
+					w.WriteHeader(statusClientClosedRequest)
+				case errors.Is(err, ErrRequestQueueFull) || errors.Is(err, ErrUnhealthy) || errors.Is(err, ErrDraining):
+					// The request was shed, hint the client when to retry.
+					if onReject != nil {
+						onReject()
+					}
+					w.Header().Set("Retry-After", retryAfter(breaker, err))
+					http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				case errors.Is(err, context.DeadlineExceeded):
 					http.Error(w, err.Error(), http.StatusServiceUnavailable)
-				} else {
+				default:
 					// This line is most likely untestable :-).
 					w.WriteHeader(http.StatusInternalServerError)
 				}
@@ -76,3 +106,43 @@ func ProxyHandler(breaker *Breaker, stats *network.RequestStats, tracingEnabled
 		}
 	}
 }
+
+// retryAfter returns the value of the Retry-After header for a request that was
+// shed by the breaker with err, in seconds. A full queue is retried once the
+// breaker estimates the queue to have drained, an unhealthy or draining breaker
+// right away, as the retry is likely routed elsewhere.
+func retryAfter(breaker *Breaker, err error) string {
+	if errors.Is(err, ErrRequestQueueFull) {
+		if wait := breaker.EstimatedWait(); wait > time.Second {
+			return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+		}
+	}
+	return "1"
+}
+
+// TimeoutErrorHandler wraps the error handler of a reverse proxy to fail requests
+// that were cancelled because they exceeded the breaker's timeout with a 504,
+// and requests cancelled by their client with a 499, rather than reporting
+// either as a failure of the user container. If the response was already
+// started, as recorded by ProxyHandler, it's left alone, as its status can't be
+// changed anymore. All other errors are passed on to next.
+func TimeoutErrorHandler(next func(http.ResponseWriter, *http.Request, error)) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		ctxErr := r.Context().Err()
+		if ctxErr == nil {
+			next(w, r, err)
+			return
+		}
+		if rr, ok := w.(*pkghttp.ResponseRecorder); ok && rr.Written() {
+			return
+		}
+		switch {
+		case errors.Is(ctxErr, context.Canceled):
+			w.WriteHeader(statusClientClosedRequest)
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			http.Error(w, ErrRequestTimeout.Error(), http.StatusGatewayTimeout)
+		default:
+			next(w, r, err)
+		}
+	}
+}
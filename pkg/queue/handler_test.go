@@ -30,6 +30,7 @@ import (
 	"go.uber.org/atomic"
 	network "knative.dev/networking/pkg"
 	"knative.dev/serving/pkg/activator"
+	pkghttp "knative.dev/serving/pkg/http"
 )
 
 const (
@@ -48,7 +49,7 @@ func TestHandlerBreakerQueueFull(t *testing.T) {
 		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1,
 	})
 	stats := network.NewRequestStats(time.Now())
-	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler)
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, nil /*onReject*/, blockHandler)
 
 	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil)
 	resps := make(chan *httptest.ResponseRecorder)
@@ -70,6 +71,9 @@ func TestHandlerBreakerQueueFull(t *testing.T) {
 	if got := failure.Body.String(); !strings.Contains(failure.Body.String(), want) {
 		t.Errorf("Body = %q wanted to contain %q", got, want)
 	}
+	if got, want := failure.Header().Get("Retry-After"), "1"; got != want {
+		t.Errorf("Retry-After = %q, want: %q", got, want)
+	}
 
 	// Allow the remaining requests to pass.
 	close(resp)
@@ -96,7 +100,7 @@ func TestHandlerBreakerTimeout(t *testing.T) {
 		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1,
 	})
 	stats := network.NewRequestStats(time.Now())
-	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, blockHandler)
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, nil /*onReject*/, blockHandler)
 
 	go func() {
 		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil))
@@ -118,6 +122,198 @@ func TestHandlerBreakerTimeout(t *testing.T) {
 	if got := rec.Body.String(); !strings.Contains(rec.Body.String(), want) {
 		t.Fatalf("Body = %q wanted to contain %q", got, want)
 	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q, want none", got)
+	}
+}
+
+func TestHandlerBreakerCanceled(t *testing.T) {
+	// A request cancelled by its client is answered with 499, even if it got
+	// capacity right away.
+	passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Request unexpectedly passed the breaker")
+	})
+	breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+	h := ProxyHandler(breaker, network.NewRequestStats(time.Now()), false /*tracingEnabled*/, nil /*onReject*/, passed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil).WithContext(ctx))
+	if got, want := rec.Code, statusClientClosedRequest; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "" {
+		t.Errorf("Retry-After = %q, want none", got)
+	}
+	if got := breaker.Active(); got != 0 {
+		t.Errorf("Active() = %d, want: 0", got)
+	}
+}
+
+func TestHandlerBreakerShedRetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		breaker func() *Breaker
+		body    string
+		want    string
+	}{{
+		name: "draining",
+		breaker: func() *Breaker {
+			b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+			b.Drain()
+			return b
+		},
+		body: ErrDraining.Error(),
+		want: "1",
+	}, {
+		name: "unhealthy",
+		breaker: func() *Breaker {
+			b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
+			b.SetHealthy(false)
+			return b
+		},
+		body: ErrUnhealthy.Error(),
+		want: "1",
+	}, {
+		name: "queue full with a long estimated wait",
+		breaker: func() *Breaker {
+			b := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 0, EstimateWait: true})
+			b.recordDuration(2500 * time.Millisecond)
+			// Occupy both slots, with no capacity to execute them.
+			b.tryAcquirePending()
+			b.tryAcquirePending()
+			return b
+		},
+		body: ErrRequestQueueFull.Error(),
+		// Both queued requests take 2.5s each, plus this one.
+		want: "8",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			passed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("Request unexpectedly passed the breaker")
+			})
+			h := ProxyHandler(test.breaker(), network.NewRequestStats(time.Now()), false /*tracingEnabled*/, nil /*onReject*/, passed)
+
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil))
+			if got, want := rec.Code, http.StatusServiceUnavailable; got != want {
+				t.Errorf("Code = %d, want: %d", got, want)
+			}
+			if got := rec.Body.String(); !strings.Contains(got, test.body) {
+				t.Errorf("Body = %q wanted to contain %q", got, test.body)
+			}
+			if got := rec.Header().Get("Retry-After"); got != test.want {
+				t.Errorf("Retry-After = %q, want: %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHandlerBreakerRequestTimeout(t *testing.T) {
+	// This test sends a request which hangs in the user container and verifies
+	// that it's failed with a 504 once it exceeds the breaker's timeout.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	proxy := httputil.NewSingleHostReverseProxy(serverURL)
+	proxy.ErrorHandler = TimeoutErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Error("Unexpected proxy error:", err)
+	})
+
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1, Timeout: 50 * time.Millisecond,
+	})
+	stats := network.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, nil /*onReject*/, proxy)
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil))
+	if got, want := rec.Code, http.StatusGatewayTimeout; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+	if got, want := rec.Body.String(), ErrRequestTimeout.Error(); !strings.Contains(got, want) {
+		t.Errorf("Body = %q wanted to contain %q", got, want)
+	}
+	if got, want := breaker.TimedOutCount(), uint64(1); got != want {
+		t.Errorf("TimedOutCount() = %d, want: %d", got, want)
+	}
+	if got := breaker.Active(); got != 0 {
+		t.Errorf("Active() = %d, want: 0", got)
+	}
+}
+
+func TestHandlerBreakerCanceledMidFlight(t *testing.T) {
+	// This test cancels a request while it's in the user container and
+	// verifies that it's neither counted nor answered as timed out.
+	seen := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(seen)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	proxy := httputil.NewSingleHostReverseProxy(serverURL)
+	proxy.ErrorHandler = TimeoutErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Error("Unexpected proxy error:", err)
+	})
+
+	breaker := NewBreaker(BreakerParams{
+		QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1, Timeout: time.Minute,
+	})
+	stats := network.NewRequestStats(time.Now())
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, nil /*onReject*/, proxy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-seen
+		cancel()
+	}()
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil).WithContext(ctx))
+	if got, want := rec.Code, statusClientClosedRequest; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+	if got := breaker.TimedOutCount(); got != 0 {
+		t.Errorf("TimedOutCount() = %d, want: 0", got)
+	}
+	if got := breaker.Active(); got != 0 {
+		t.Errorf("Active() = %d, want: 0", got)
+	}
+}
+
+func TestTimeoutErrorHandlerStartedResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8081/time", nil).WithContext(ctx)
+	h := TimeoutErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Error("Unexpected proxy error:", err)
+	})
+
+	// A response that was already started must not be overwritten.
+	rec := httptest.NewRecorder()
+	rr := pkghttp.NewResponseRecorder(rec, http.StatusOK)
+	rr.WriteHeader(http.StatusOK)
+	rr.Write([]byte("partial"))
+	h(rr, req, context.DeadlineExceeded)
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
+	if got, want := rec.Body.String(), "partial"; got != want {
+		t.Errorf("Body = %q, want: %q", got, want)
+	}
+
+	// A response that wasn't started yet is failed with a 504.
+	rec = httptest.NewRecorder()
+	h(pkghttp.NewResponseRecorder(rec, http.StatusOK), req, context.DeadlineExceeded)
+	if got, want := rec.Code, http.StatusGatewayTimeout; got != want {
+		t.Errorf("Code = %d, want: %d", got, want)
+	}
 }
 
 func TestHandlerReqEvent(t *testing.T) {
@@ -154,7 +350,7 @@ func TestHandlerReqEvent(t *testing.T) {
 			proxy := httputil.NewSingleHostReverseProxy(serverURL)
 
 			stats := network.NewRequestStats(time.Now())
-			h := ProxyHandler(br, stats, true /*tracingEnabled*/, proxy)
+			h := ProxyHandler(br, stats, true /*tracingEnabled*/, nil /*onReject*/, proxy)
 
 			writer := httptest.NewRecorder()
 			req := httptest.NewRequest(http.MethodPost, "http://example.com", nil)
@@ -215,7 +411,7 @@ func TestIgnoreProbe(t *testing.T) {
 	// Ensure no more than 1 request can be queued. So we'll send 3.
 	breaker := NewBreaker(BreakerParams{QueueDepth: 1, MaxConcurrency: 1, InitialCapacity: 1})
 	stats := network.NewRequestStats(time.Now())
-	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, proxy)
+	h := ProxyHandler(breaker, stats, false /*tracingEnabled*/, nil /*onReject*/, proxy)
 
 	req := httptest.NewRequest(http.MethodPost, "http://prob.in", nil)
 	req.Header.Set(network.KubeletProbeHeaderName, "1") // Mark it a probe.
@@ -276,7 +472,7 @@ func BenchmarkProxyHandler(b *testing.B) {
 			}
 		}()
 
-		h := ProxyHandler(tc.breaker, stats, true /*tracingEnabled*/, baseHandler)
+		h := ProxyHandler(tc.breaker, stats, true /*tracingEnabled*/, nil /*onReject*/, baseHandler)
 		b.Run("sequential-"+tc.label, func(b *testing.B) {
 			resp := httptest.NewRecorder()
 			for j := 0; j < b.N; j++ {
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"errors"
+	"net/http"
+)
+
+// errBodyTooLarge is the message of the error http.MaxBytesReader fails reads
+// with once its limit is exceeded. net/http doesn't export the error itself.
+const errBodyTooLarge = "http: request body too large"
+
+// MaxBodySizeHandler rejects requests whose declared body is larger than limit
+// bytes with a 413. Bodies of unknown length are cut off after limit bytes,
+// which fails the request while it is being proxied, see
+// MaxBodySizeErrorHandler.
+func MaxBodySizeHandler(limit int64, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// MaxBodySizeErrorHandler wraps the error handler of a reverse proxy to fail
+// requests whose body was cut off by MaxBodySizeHandler with a 413 rather than
+// a 502. All other errors are passed on to next.
+func MaxBodySizeErrorHandler(next func(http.ResponseWriter, *http.Request, error)) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		for e := err; e != nil; e = errors.Unwrap(e) {
+			if e.Error() == errBodyTooLarge {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+		next(w, r, err)
+	}
+}
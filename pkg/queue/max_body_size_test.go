@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySizeHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantCode      int
+	}{{
+		name:          "within limit",
+		body:          "hello",
+		contentLength: 5,
+		wantCode:      http.StatusOK,
+	}, {
+		name:          "exactly the limit",
+		body:          "0123456789",
+		contentLength: 10,
+		wantCode:      http.StatusOK,
+	}, {
+		name:          "declared too large",
+		body:          "0123456789a",
+		contentLength: 11,
+		wantCode:      http.StatusRequestEntityTooLarge,
+	}, {
+		name:          "unknown length too large",
+		body:          "0123456789a",
+		contentLength: -1,
+		wantCode:      http.StatusBadRequest,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := MaxBodySizeHandler(10, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := ioutil.ReadAll(r.Body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "http://example.com", strings.NewReader(test.body))
+			req.ContentLength = test.contentLength
+			resp := httptest.NewRecorder()
+			h.ServeHTTP(resp, req)
+
+			if got, want := resp.Code, test.wantCode; got != want {
+				t.Errorf("StatusCode = %d, want: %d", got, want)
+			}
+		})
+	}
+}
+
+func TestMaxBodySizeChunked(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal("Failed to parse backend URL:", err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(backendURL)
+	proxy.ErrorHandler = MaxBodySizeErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		t.Error("Unexpected proxy error:", err)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	server := httptest.NewServer(MaxBodySizeHandler(10, proxy))
+	defer server.Close()
+
+	for _, body := range []string{"hello", "0123456789a"} {
+		// Hide the length of the body, so that it's sent chunked.
+		req, err := http.NewRequest(http.MethodPost, server.URL, ioutil.NopCloser(strings.NewReader(body)))
+		if err != nil {
+			t.Fatal("Failed to create request:", err)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal("Failed to send request:", err)
+		}
+		resp.Body.Close()
+
+		want := http.StatusOK
+		if len(body) > 10 {
+			want = http.StatusRequestEntityTooLarge
+		}
+		if got := resp.StatusCode; got != want {
+			t.Errorf("StatusCode for a %d byte body = %d, want: %d", len(body), got, want)
+		}
+	}
+}
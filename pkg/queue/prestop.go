@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RunPreStopHook performs the httpGet action of a user-provided preStop hook
+// against the user container listening on port, like the kubelet would. It's
+// run by the queue-proxy once it drained, so the user container keeps serving
+// the requests in flight until then. Responses other than 2xx or 3xx fail
+// the hook.
+func RunPreStopHook(ctx context.Context, action *corev1.HTTPGetAction, port int) error {
+	host := action.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	u := url.URL{
+		Scheme: strings.ToLower(string(action.Scheme)),
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   action.Path,
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to build the preStop hook request: %w", err)
+	}
+	for _, h := range action.HTTPHeaders {
+		if h.Name == "Host" {
+			req.Host = h.Value
+			continue
+		}
+		req.Header.Add(h.Name, h.Value)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			//nolint:gosec // Like the kubelet, we don't verify the user container's certificate.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		// Redirects count as success, without following them.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("preStop hook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("preStop hook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
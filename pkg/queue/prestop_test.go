@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRunPreStopHook(t *testing.T) {
+	var gotPath, gotHeader, gotHost string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotHeader, gotHost = r.URL.Path, r.Header.Get("X-Drain"), r.Host
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	_, portStr, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	action := &corev1.HTTPGetAction{
+		Path: "/drain",
+		HTTPHeaders: []corev1.HTTPHeader{{
+			Name:  "X-Drain",
+			Value: "now",
+		}, {
+			Name:  "Host",
+			Value: "example.com",
+		}},
+	}
+	if err := RunPreStopHook(context.Background(), action, port); err != nil {
+		t.Fatal("RunPreStopHook() =", err)
+	}
+	if got, want := gotPath, "/drain"; got != want {
+		t.Errorf("Path = %q, want: %q", got, want)
+	}
+	if got, want := gotHeader, "now"; got != want {
+		t.Errorf("X-Drain = %q, want: %q", got, want)
+	}
+	if got, want := gotHost, "example.com"; got != want {
+		t.Errorf("Host = %q, want: %q", got, want)
+	}
+
+	status = http.StatusFound
+	if err := RunPreStopHook(context.Background(), action, port); err != nil {
+		t.Error("RunPreStopHook() =", err, "want redirects to succeed")
+	}
+
+	status = http.StatusInternalServerError
+	if err := RunPreStopHook(context.Background(), action, port); err == nil {
+		t.Error("RunPreStopHook() = nil, want an error for a failing hook")
+	}
+}
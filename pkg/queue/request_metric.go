@@ -59,6 +59,22 @@ var (
 		"queue_depth",
 		"The current number of items in the serving and waiting queue, or not reported if unlimited concurrency.",
 		stats.UnitDimensionless)
+	queueInFlightM = stats.Int64(
+		"queue_in_flight",
+		"The current number of requests executing in the serving queue, or not reported if unlimited concurrency.",
+		stats.UnitDimensionless)
+	queuePendingM = stats.Int64(
+		"queue_pending",
+		"The current number of requests waiting for capacity in the serving queue, or not reported if unlimited concurrency.",
+		stats.UnitDimensionless)
+	queueRejectedM = stats.Int64(
+		"queue_requests_rejected_total",
+		"The total number of requests rejected by the serving queue, or not reported if unlimited concurrency.",
+		stats.UnitDimensionless)
+	queueWaitTimeInMsecM = stats.Float64(
+		"queue_wait_time",
+		"The time in milliseconds requests waited for capacity in the serving queue",
+		stats.UnitMilliseconds)
 )
 
 type requestMetricsHandler struct {
@@ -159,6 +175,16 @@ func NewAppRequestMetricsHandler(next http.Handler, b *Breaker,
 		Measure:     queueDepthM,
 		Aggregation: view.LastValue(),
 		TagKeys:     keys,
+	}, &view.View{
+		Description: "The number of requests executing at this queue proxy.",
+		Measure:     queueInFlightM,
+		Aggregation: view.LastValue(),
+		TagKeys:     keys,
+	}, &view.View{
+		Description: "The number of requests waiting for capacity at this queue proxy.",
+		Measure:     queuePendingM,
+		Aggregation: view.LastValue(),
+		TagKeys:     keys,
 	}); err != nil {
 		return nil, err
 	}
@@ -180,7 +206,9 @@ func (h *appRequestMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	startTime := time.Now()
 
 	if h.breaker != nil {
-		pkgmetrics.Record(h.statsCtx, queueDepthM.M(int64(h.breaker.InFlight())))
+		pkgmetrics.RecordBatch(h.statsCtx, queueDepthM.M(int64(h.breaker.InFlight())),
+			queueInFlightM.M(int64(h.breaker.Active())),
+			queuePendingM.M(int64(h.breaker.Pending())))
 	}
 	defer func() {
 		// Filter probe requests for revision metrics.
@@ -205,6 +233,50 @@ func (h *appRequestMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	h.next.ServeHTTP(rr, r)
 }
 
+// NewBreakerWaitRecorder returns a function to be used as BreakerParams.OnWait,
+// which records the time requests waited for capacity in the breaker.
+func NewBreakerWaitRecorder(ns, service, config, rev, pod string) (func(time.Duration), error) {
+	if err := pkgmetrics.RegisterResourceView(&view.View{
+		Description: "The time in milliseconds requests waited for capacity at this queue proxy.",
+		Measure:     queueWaitTimeInMsecM,
+		Aggregation: defaultLatencyDistribution,
+		TagKeys:     []tag.Key{metrics.PodTagKey, metrics.ContainerTagKey},
+	}); err != nil {
+		return nil, err
+	}
+
+	ctx, err := metrics.PodRevisionContext(pod, "queue-proxy", ns, service, config, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(d time.Duration) {
+		pkgmetrics.Record(ctx, queueWaitTimeInMsecM.M(float64(d.Milliseconds())))
+	}, nil
+}
+
+// NewBreakerRejectionRecorder returns a function to be passed to ProxyHandler
+// as its onReject callback, which counts the requests the breaker shed.
+func NewBreakerRejectionRecorder(ns, service, config, rev, pod string) (func(), error) {
+	if err := pkgmetrics.RegisterResourceView(&view.View{
+		Description: "The total number of requests rejected at this queue proxy.",
+		Measure:     queueRejectedM,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{metrics.PodTagKey, metrics.ContainerTagKey},
+	}); err != nil {
+		return nil, err
+	}
+
+	ctx, err := metrics.PodRevisionContext(pod, "queue-proxy", ns, service, config, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		pkgmetrics.Record(ctx, queueRejectedM.M(1))
+	}, nil
+}
+
 /*
 TODO: add the routeTag back after stackdriver adds support for it.
 https://github.com/knative/serving/issues/8970
@@ -18,11 +18,14 @@ package queue
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"go.opencensus.io/resource"
+	"k8s.io/apimachinery/pkg/util/wait"
 	network "knative.dev/networking/pkg"
 	"knative.dev/pkg/metrics/metricskey"
 	"knative.dev/pkg/metrics/metricstest"
@@ -140,7 +143,8 @@ func reset() {
 	metricstest.Unregister(
 		requestCountM.Name(), appRequestCountM.Name(),
 		responseTimeInMsecM.Name(), appResponseTimeInMsecM.Name(),
-		queueDepthM.Name())
+		queueDepthM.Name(), queueInFlightM.Name(), queuePendingM.Name(), queueRejectedM.Name(),
+		queueWaitTimeInMsecM.Name())
 }
 
 func TestRequestMetricsHandlerPanickingHandler(t *testing.T) {
@@ -282,6 +286,14 @@ func TestAppRequestMetricsHandler(t *testing.T) {
 	metricstest.AssertMetric(t, metricstest.IntMetric("app_request_count", 1, wantTags).WithResource(wantResource))
 	metricstest.AssertMetric(t, metricstest.DistributionCountOnlyMetric("app_request_latencies", 1, wantTags).WithResource(wantResource))
 
+	queueTags := map[string]string{
+		metricskey.PodName:       "pod",
+		metricskey.ContainerName: "queue-proxy",
+	}
+	metricstest.AssertMetric(t, metricstest.IntMetric("queue_in_flight", 0, queueTags).WithResource(wantResource))
+	metricstest.AssertMetric(t, metricstest.IntMetric("queue_pending", 0, queueTags).WithResource(wantResource))
+	metricstest.AssertNoMetric(t, "queue_requests_rejected_total")
+
 	// A probe request should not be recorded.
 	req.Header.Set(network.ProbeHeaderName, "activator")
 	handler.ServeHTTP(resp, req)
@@ -289,6 +301,90 @@ func TestAppRequestMetricsHandler(t *testing.T) {
 	metricstest.AssertMetric(t, metricstest.DistributionCountOnlyMetric("app_request_latencies", 1, wantTags).WithResource(wantResource))
 }
 
+func TestBreakerWaitRecorder(t *testing.T) {
+	defer reset()
+	onWait, err := NewBreakerWaitRecorder("ns", "svc", "cfg", "rev", "pod")
+	if err != nil {
+		t.Fatal("Failed to create recorder:", err)
+	}
+	breaker := NewBreaker(BreakerParams{QueueDepth: 10, MaxConcurrency: 1, InitialCapacity: 1, OnWait: onWait})
+	reqs := newRequestor(breaker)
+
+	// One request executes right away, the other two wait for it.
+	for i := 0; i < 3; i++ {
+		reqs.request()
+	}
+	if err := wait.PollImmediate(time.Millisecond, semAcquireTimeout, func() (bool, error) {
+		return breaker.InFlight() == 3, nil
+	}); err != nil {
+		t.Fatal("Timed out waiting for the requests to arrive")
+	}
+	for i := 0; i < 3; i++ {
+		reqs.processSuccessfully(t)
+	}
+
+	wantTags := map[string]string{
+		metricskey.PodName:       "pod",
+		metricskey.ContainerName: "queue-proxy",
+	}
+	wantResource := &resource.Resource{
+		Type: "knative_revision",
+		Labels: map[string]string{
+			metricskey.LabelNamespaceName:     "ns",
+			metricskey.LabelRevisionName:      "rev",
+			metricskey.LabelServiceName:       "svc",
+			metricskey.LabelConfigurationName: "cfg",
+		},
+	}
+	metricstest.AssertMetric(t, metricstest.DistributionCountOnlyMetric("queue_wait_time", 3, wantTags).WithResource(wantResource))
+}
+
+func TestBreakerRejectionRecorder(t *testing.T) {
+	defer reset()
+	onReject, err := NewBreakerRejectionRecorder("ns", "svc", "cfg", "rev", "pod")
+	if err != nil {
+		t.Fatal("Failed to create recorder:", err)
+	}
+	breaker := NewBreaker(BreakerParams{QueueDepth: 0, MaxConcurrency: 1, InitialCapacity: 1})
+	baseHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := ProxyHandler(breaker, network.NewRequestStats(time.Now()), false /*tracingEnabled*/, onReject, baseHandler)
+
+	// Admitted requests aren't counted.
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, targetURI, nil))
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("StatusCode = %d, want: %d", got, want)
+	}
+	metricstest.AssertNoMetric(t, "queue_requests_rejected_total")
+
+	// With all capacity taken, the next request is rejected and counted.
+	release, ok := breaker.Reserve(context.Background())
+	if !ok {
+		t.Fatal("Reserve() = false, want true")
+	}
+	defer release()
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, targetURI, nil))
+	if got, want := resp.Code, http.StatusServiceUnavailable; got != want {
+		t.Fatalf("StatusCode = %d, want: %d", got, want)
+	}
+
+	wantTags := map[string]string{
+		metricskey.PodName:       "pod",
+		metricskey.ContainerName: "queue-proxy",
+	}
+	wantResource := &resource.Resource{
+		Type: "knative_revision",
+		Labels: map[string]string{
+			metricskey.LabelNamespaceName:     "ns",
+			metricskey.LabelRevisionName:      "rev",
+			metricskey.LabelServiceName:       "svc",
+			metricskey.LabelConfigurationName: "cfg",
+		},
+	}
+	metricstest.AssertMetric(t, metricstest.IntMetric("queue_requests_rejected_total", 1, wantTags).WithResource(wantResource))
+}
+
 func BenchmarkRequestMetricsHandler(b *testing.B) {
 	baseHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 	handler, _ := NewRequestMetricsHandler(baseHandler, "ns", "svc", "cfg", "rev", "pod")
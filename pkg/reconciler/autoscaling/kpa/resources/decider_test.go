@@ -74,6 +74,13 @@ func TestMakeDecider(t *testing.T) {
 			c.MaxScaleDownRate = 19.88
 			return &c
 		},
+	}, {
+		name: "rps metric",
+		pa:   pa(WithMetricAnnotation(autoscaling.RPS)),
+		want: decider(withTarget(100.0), withPanicThreshold(2.0), withTotal(100), func(d *scaling.Decider) {
+			d.Annotations[autoscaling.MetricAnnotationKey] = autoscaling.RPS
+			d.Spec.ScalingMetric = autoscaling.RPS
+		}),
 	}, {
 		name: "with container concurrency 1",
 		pa:   pa(WithPAContainerConcurrency(1)),
@@ -18,9 +18,14 @@ package config
 
 import (
 	"context"
+	"errors"
+	"sync"
 
+	corev1 "k8s.io/api/core/v1"
 	network "knative.dev/networking/pkg"
 	"knative.dev/pkg/configmap"
+	asconfig "knative.dev/serving/pkg/autoscaler/config"
+	"knative.dev/serving/pkg/autoscaler/config/autoscalerconfig"
 	routecfg "knative.dev/serving/pkg/reconciler/route/config"
 )
 
@@ -28,8 +33,9 @@ type cfgKey struct{}
 
 // Config of the nscert controller.
 type Config struct {
-	Network *network.Config
-	Domain  *routecfg.Domain
+	Network    *network.Config
+	Domain     *routecfg.Domain
+	Autoscaler *autoscalerconfig.Config
 }
 
 // FromContext fetches config from context.
@@ -37,6 +43,23 @@ func FromContext(ctx context.Context) *Config {
 	return ctx.Value(cfgKey{}).(*Config)
 }
 
+// FromContextOrDefault is like FromContext, but when no Config has been
+// attached to the context it returns one built from the defaults of each
+// configuration.
+func FromContextOrDefault(ctx context.Context) *Config {
+	if cfg, ok := ctx.Value(cfgKey{}).(*Config); ok && cfg != nil {
+		return cfg
+	}
+	nc, _ := network.NewConfigFromMap(nil)
+	dc, _ := routecfg.NewDomainFromConfigMap(&corev1.ConfigMap{})
+	ac, _ := asconfig.NewConfigFromMap(nil)
+	return &Config{
+		Network:    nc,
+		Domain:     dc,
+		Autoscaler: ac,
+	}
+}
+
 // ToContext adds config to given context.
 func ToContext(ctx context.Context, c *Config) context.Context {
 	return context.WithValue(ctx, cfgKey{}, c)
@@ -46,6 +69,12 @@ func ToContext(ctx context.Context, c *Config) context.Context {
 // updates to configuration related to routes (currently only config-domain).
 type Store struct {
 	*configmap.UntypedStore
+
+	mu           sync.Mutex
+	network      *network.Config
+	domain       *routecfg.Domain
+	networkHooks []func(old, new *network.Config)
+	domainHooks  []func(old, new *routecfg.Domain)
 }
 
 // NewStore creates a configmap.UntypedStore based config store.
@@ -58,21 +87,78 @@ type Store struct {
 //
 // See also: configmap.NewUntypedStore().
 func NewStore(logger configmap.Logger, onAfterStore ...func(name string, value interface{})) *Store {
-	store := &Store{
-		UntypedStore: configmap.NewUntypedStore(
-			"namespace",
-			logger,
-			configmap.Constructors{
-				network.ConfigName:        network.NewConfigFromConfigMap,
-				routecfg.DomainConfigName: routecfg.NewDomainFromConfigMap,
-			},
-			onAfterStore...,
-		),
-	}
+	store := &Store{}
+	store.UntypedStore = configmap.NewUntypedStore(
+		"namespace",
+		logger,
+		configmap.Constructors{
+			network.ConfigName:        network.NewConfigFromConfigMap,
+			routecfg.DomainConfigName: newDomainFromConfigMap,
+			asconfig.ConfigName:       asconfig.NewConfigFromConfigMap,
+		},
+		append([]func(string, interface{}){store.onAfterStore}, onAfterStore...)...,
+	)
 
 	return store
 }
 
+// OnNetworkChanged registers f to be called with the previous and the current
+// network configuration whenever config-network was stored. old is nil for the
+// initial configuration.
+func (s *Store) OnNetworkChanged(f func(old, new *network.Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.networkHooks = append(s.networkHooks, f)
+}
+
+// OnDomainChanged registers f to be called with the previous and the current
+// domain configuration whenever config-domain was stored, e.g. to reissue
+// certificates when the domain suffix changes. old is nil for the initial
+// configuration.
+func (s *Store) OnDomainChanged(f func(old, new *routecfg.Domain)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.domainHooks = append(s.domainHooks, f)
+}
+
+// onAfterStore keeps track of the last stored network and domain configuration
+// and calls the registered hooks with it.
+func (s *Store) onAfterStore(_ string, value interface{}) {
+	switch cfg := value.(type) {
+	case *network.Config:
+		s.mu.Lock()
+		old, hooks := s.network, s.networkHooks
+		s.network = cfg
+		s.mu.Unlock()
+		for _, f := range hooks {
+			f(old, cfg)
+		}
+	case *routecfg.Domain:
+		s.mu.Lock()
+		old, hooks := s.domain, s.domainHooks
+		s.domain = cfg
+		s.mu.Unlock()
+		for _, f := range hooks {
+			f(old, cfg)
+		}
+	}
+}
+
+// newDomainFromConfigMap wraps routecfg.NewDomainFromConfigMap and rejects
+// configurations without a usable default domain, as that's what the
+// wildcard certificates are issued for. Returning an error makes the store
+// log it and keep the previous configuration.
+func newDomainFromConfigMap(cm *corev1.ConfigMap) (*routecfg.Domain, error) {
+	d, err := routecfg.NewDomainFromConfigMap(cm)
+	if err != nil {
+		return nil, err
+	}
+	if d.LookupDomainForLabels(nil) == "" {
+		return nil, errors.New("config-domain has no usable default domain")
+	}
+	return d, nil
+}
+
 // ToContext adds Store contents to given context.
 func (s *Store) ToContext(ctx context.Context) context.Context {
 	return ToContext(ctx, s.Load())
@@ -81,7 +167,8 @@ func (s *Store) ToContext(ctx context.Context) context.Context {
 // Load fetches config from Store.
 func (s *Store) Load() *Config {
 	return &Config{
-		Network: s.UntypedLoad(network.ConfigName).(*network.Config).DeepCopy(),
-		Domain:  s.UntypedLoad(routecfg.DomainConfigName).(*routecfg.Domain).DeepCopy(),
+		Network:    s.UntypedLoad(network.ConfigName).(*network.Config).DeepCopy(),
+		Domain:     s.UntypedLoad(routecfg.DomainConfigName).(*routecfg.Domain).DeepCopy(),
+		Autoscaler: s.UntypedLoad(asconfig.ConfigName).(*autoscalerconfig.Config).DeepCopy(),
 	}
 }
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	network "knative.dev/networking/pkg"
+	logtesting "knative.dev/pkg/logging/testing"
+	asconfig "knative.dev/serving/pkg/autoscaler/config"
+	routecfg "knative.dev/serving/pkg/reconciler/route/config"
+
+	. "knative.dev/pkg/configmap/testing"
+)
+
+func TestStoreLoadWithContext(t *testing.T) {
+	store := NewStore(logtesting.TestLogger(t))
+
+	domainConfig := ConfigMapFromTestFile(t, routecfg.DomainConfigName)
+	networkConfig := ConfigMapFromTestFile(t, network.ConfigName)
+	autoscalerConfig := ConfigMapFromTestFile(t, asconfig.ConfigName)
+
+	store.OnConfigChanged(domainConfig)
+	store.OnConfigChanged(networkConfig)
+	store.OnConfigChanged(autoscalerConfig)
+
+	config := FromContext(store.ToContext(context.Background()))
+
+	t.Run("domain", func(t *testing.T) {
+		expected, _ := routecfg.NewDomainFromConfigMap(domainConfig)
+		if diff := cmp.Diff(expected, config.Domain); diff != "" {
+			t.Error("Unexpected domain config (-want, +got):", diff)
+		}
+	})
+
+	t.Run("network", func(t *testing.T) {
+		expected, _ := network.NewConfigFromConfigMap(networkConfig)
+		if diff := cmp.Diff(expected, config.Network); diff != "" {
+			t.Error("Unexpected network config (-want, +got):", diff)
+		}
+	})
+
+	t.Run("autoscaler", func(t *testing.T) {
+		expected, _ := asconfig.NewConfigFromConfigMap(autoscalerConfig)
+		if diff := cmp.Diff(expected, config.Autoscaler); diff != "" {
+			t.Error("Unexpected autoscaler config (-want, +got):", diff)
+		}
+	})
+}
+
+func TestStoreKeepsDomainWithoutDefault(t *testing.T) {
+	store := NewStore(logtesting.TestLogger(t))
+
+	domainConfig := ConfigMapFromTestFile(t, routecfg.DomainConfigName)
+	store.OnConfigChanged(domainConfig)
+	store.OnConfigChanged(ConfigMapFromTestFile(t, network.ConfigName))
+	store.OnConfigChanged(ConfigMapFromTestFile(t, asconfig.ConfigName))
+
+	store.OnConfigChanged(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: routecfg.DomainConfigName,
+		},
+		Data: map[string]string{
+			"": "",
+		},
+	})
+
+	expected, _ := routecfg.NewDomainFromConfigMap(domainConfig)
+	if diff := cmp.Diff(expected, store.Load().Domain); diff != "" {
+		t.Error("Unexpected domain config (-want, +got):", diff)
+	}
+}
+
+func TestStoreChangeHooks(t *testing.T) {
+	var stored []string
+	store := NewStore(logtesting.TestLogger(t), func(name string, _ interface{}) {
+		stored = append(stored, name)
+	})
+
+	var domains [][2]string
+	store.OnDomainChanged(func(old, new *routecfg.Domain) {
+		var o string
+		if old != nil {
+			o = old.LookupDomainForLabels(nil)
+		}
+		domains = append(domains, [2]string{o, new.LookupDomainForLabels(nil)})
+	})
+	var networks int
+	store.OnNetworkChanged(func(old, new *network.Config) {
+		if networks == 0 && old != nil {
+			t.Error("Expected no previous network config on the initial load")
+		}
+		networks++
+	})
+
+	store.OnConfigChanged(domainConfigMap("example.com"))
+	store.OnConfigChanged(ConfigMapFromTestFile(t, network.ConfigName))
+	store.OnConfigChanged(domainConfigMap("example.org"))
+
+	if want := [][2]string{{"", "example.com"}, {"example.com", "example.org"}}; !cmp.Equal(domains, want) {
+		t.Errorf("Domain changes = %v, want: %v", domains, want)
+	}
+	if networks != 1 {
+		t.Errorf("Network changes = %d, want: 1", networks)
+	}
+	if want := []string{routecfg.DomainConfigName, network.ConfigName, routecfg.DomainConfigName}; !cmp.Equal(stored, want) {
+		t.Errorf("onAfterStore calls = %v, want: %v", stored, want)
+	}
+}
+
+func domainConfigMap(domain string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: routecfg.DomainConfigName,
+		},
+		Data: map[string]string{
+			domain: "",
+		},
+	}
+}
+
+func TestNewDomainFromConfigMap(t *testing.T) {
+	if _, err := newDomainFromConfigMap(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: routecfg.DomainConfigName,
+		},
+		Data: map[string]string{
+			"": "",
+		},
+	}); err == nil {
+		t.Error("newDomainFromConfigMap() = nil, wanted an error")
+	}
+
+	d, err := newDomainFromConfigMap(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: routecfg.DomainConfigName,
+		},
+	})
+	if err != nil {
+		t.Fatal("newDomainFromConfigMap() =", err)
+	}
+	if got, want := d.LookupDomainForLabels(nil), routecfg.DefaultDomain; got != want {
+		t.Errorf("Default domain = %q, want: %q", got, want)
+	}
+}
+
+func TestFromContextOrDefault(t *testing.T) {
+	cfg := FromContextOrDefault(context.Background())
+	if cfg.Network == nil || cfg.Domain == nil || cfg.Autoscaler == nil {
+		t.Fatalf("FromContextOrDefault() = %#v, wanted all configs to be set", cfg)
+	}
+	if got, want := cfg.Domain.LookupDomainForLabels(nil), routecfg.DefaultDomain; got != want {
+		t.Errorf("Default domain = %q, want: %q", got, want)
+	}
+
+	want := &Config{}
+	if got := FromContextOrDefault(ToContext(context.Background(), want)); got != want {
+		t.Errorf("FromContextOrDefault() = %p, want: %p", got, want)
+	}
+}
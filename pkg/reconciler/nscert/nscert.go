@@ -59,7 +59,7 @@ func certClass(ctx context.Context, r *corev1.Namespace) string {
 	if class := r.Annotations[networking.CertificateClassAnnotationKey]; class != "" {
 		return class
 	}
-	return config.FromContext(ctx).Network.DefaultCertificateClass
+	return config.FromContextOrDefault(ctx).Network.DefaultCertificateClass
 }
 
 // ReconcileKind implements Interface.ReconcileKind.
@@ -42,6 +42,7 @@ import (
 	pkgreconciler "knative.dev/pkg/reconciler"
 	. "knative.dev/pkg/reconciler/testing"
 	"knative.dev/pkg/system"
+	asconfig "knative.dev/serving/pkg/autoscaler/config"
 	"knative.dev/serving/pkg/reconciler/nscert/config"
 	"knative.dev/serving/pkg/reconciler/nscert/resources/names"
 	routecfg "knative.dev/serving/pkg/reconciler/route/config"
@@ -102,6 +103,11 @@ func newTestSetup(t *testing.T, configs ...*corev1.ConfigMap) (
 		Data: map[string]string{
 			"example.com": "",
 		},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      asconfig.ConfigName,
+			Namespace: system.Namespace(),
+		},
 	}}
 	cms = append(cms, configs...)
 
@@ -152,6 +158,11 @@ func TestNewController(t *testing.T) {
 			Data: map[string]string{
 				"example.com": "",
 			}},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      asconfig.ConfigName,
+				Namespace: system.Namespace(),
+			}},
 	)
 
 	c := NewController(ctx, configMapWatcher)
@@ -491,7 +502,13 @@ func TestDomainConfigDomain(t *testing.T) {
 				wf()
 			}()
 
-			cmw := configmap.NewStaticWatcher(domCfg, netCfg)
+			asCfg := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      asconfig.ConfigName,
+					Namespace: system.Namespace(),
+				},
+			}
+			cmw := configmap.NewStaticWatcher(domCfg, netCfg, asCfg)
 			configStore := config.NewStore(logging.FromContext(ctx).Named("config-store"))
 			configStore.WatchConfigs(cmw)
 
@@ -29,11 +29,17 @@ import (
 	"knative.dev/pkg/changeset"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	deploymentinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/deployment"
+	configmapinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/configmap/filtered"
+	secretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered"
+	serviceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/service"
 	servingclient "knative.dev/serving/pkg/client/injection/client"
 	painformer "knative.dev/serving/pkg/client/injection/informers/autoscaling/v1alpha1/podautoscaler"
 	revisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision"
+	networkpolicyinformer "knative.dev/serving/pkg/client/injection/kube/informers/networking/v1/networkpolicy"
+	pdbinformer "knative.dev/serving/pkg/client/injection/kube/informers/policy/v1beta1/poddisruptionbudget"
 	revisionreconciler "knative.dev/serving/pkg/client/injection/reconciler/serving/v1/revision"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	network "knative.dev/networking/pkg"
@@ -41,7 +47,10 @@ import (
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/metrics"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
 	apisconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/deployment"
 	"knative.dev/serving/pkg/reconciler/revision/config"
@@ -73,6 +82,11 @@ func newControllerWithOptions(
 	deploymentInformer := deploymentinformer.Get(ctx)
 	imageInformer := imageinformer.Get(ctx)
 	paInformer := painformer.Get(ctx)
+	pdbInformer := pdbinformer.Get(ctx)
+	networkPolicyInformer := networkpolicyinformer.Get(ctx)
+	serviceInformer := serviceinformer.Get(ctx)
+	configMapInformer := configmapinformer.Get(ctx, serving.RevisionReferenceLabelKey)
+	secretInformer := secretinformer.Get(ctx, serving.RevisionReferenceLabelKey)
 
 	c := &Reconciler{
 		kubeclient:    kubeclient.Get(ctx),
@@ -82,6 +96,11 @@ func newControllerWithOptions(
 		podAutoscalerLister: paInformer.Lister(),
 		imageLister:         imageInformer.Lister(),
 		deploymentLister:    deploymentInformer.Lister(),
+		pdbLister:           pdbInformer.Lister(),
+		networkPolicyLister: networkPolicyInformer.Lister(),
+		serviceLister:       serviceInformer.Lister(),
+		configMapLister:     configMapInformer.Lister(),
+		secretLister:        secretInformer.Lister(),
 	}
 
 	impl := revisionreconciler.NewImpl(ctx, c, func(impl *controller.Impl) controller.Options {
@@ -136,11 +155,39 @@ func newControllerWithOptions(
 		Handler:    controller.HandleAll(impl.EnqueueControllerOf),
 	}
 	deploymentInformer.Informer().AddEventHandler(handleMatchingControllers)
+	// The Image's readiness is surfaced as the informational ImageCached
+	// condition, which must follow the Image controller's progress.
+	imageInformer.Informer().AddEventHandler(handleMatchingControllers)
 	paInformer.Informer().AddEventHandler(handleMatchingControllers)
+	pdbInformer.Informer().AddEventHandler(handleMatchingControllers)
+	networkPolicyInformer.Informer().AddEventHandler(handleMatchingControllers)
+
+	// Only the headless Services carry the revision's labels, skip all the
+	// other Services of the cluster early.
+	serviceInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: pkgreconciler.ChainFilterFuncs(
+			pkgreconciler.LabelExistsFilterFunc(serving.RevisionUID),
+			controller.FilterController(&v1.Revision{}),
+		),
+		Handler: controller.HandleAll(impl.EnqueueControllerOf),
+	})
+
+	c.tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+
+	// Make sure trackers are deleted once the observers are removed.
+	revisionInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: c.tracker.OnDeletedObserver,
+	})
 
-	// We don't watch for changes to Image because we don't incorporate any of its
-	// properties into our own status and should work completely in the absence of
-	// a functioning Image controller.
+	// Reconcile revisions whenever the ConfigMaps and Secrets they refer to
+	// change. Only those labeled for it are cached. As with all tracked
+	// objects, make sure TypeMeta is populated.
+	configMapInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(c.tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("ConfigMap")),
+	))
+	secretInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(c.tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret")),
+	))
 
 	for _, opt := range opts {
 		opt(c)
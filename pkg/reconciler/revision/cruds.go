@@ -21,6 +21,9 @@ import (
 	"fmt"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -99,6 +102,70 @@ func (c *Reconciler) createImageCache(ctx context.Context, rev *v1.Revision, con
 	return c.cachingclient.CachingV1alpha1().Images(image.Namespace).Create(ctx, image, metav1.CreateOptions{})
 }
 
+func (c *Reconciler) checkAndUpdateImageCache(ctx context.Context, rev *v1.Revision, have *caching.Image, containerName, imageDigest string) (*caching.Image, error) {
+	image := resources.MakeImageCache(rev, containerName, imageDigest)
+
+	// If the spec we want is the spec we have, then we're good.
+	if equality.Semantic.DeepEqual(have.Spec, image.Spec) {
+		return have, nil
+	}
+
+	// Otherwise attempt an update (with ONLY the spec changes).
+	want := have.DeepCopy()
+	want.Spec = image.Spec
+	return c.cachingclient.CachingV1alpha1().Images(want.Namespace).Update(ctx, want, metav1.UpdateOptions{})
+}
+
+func (c *Reconciler) createPDB(ctx context.Context, pdb *policyv1beta1.PodDisruptionBudget) (*policyv1beta1.PodDisruptionBudget, error) {
+	return c.kubeclient.PolicyV1beta1().PodDisruptionBudgets(pdb.Namespace).Create(ctx, pdb, metav1.CreateOptions{})
+}
+
+func (c *Reconciler) checkAndUpdatePDB(ctx context.Context, have, want *policyv1beta1.PodDisruptionBudget) (*policyv1beta1.PodDisruptionBudget, error) {
+	// If the spec we want is the spec we have, then we're good.
+	if equality.Semantic.DeepEqual(have.Spec, want.Spec) {
+		return have, nil
+	}
+
+	// Otherwise attempt an update (with ONLY the spec changes).
+	desired := have.DeepCopy()
+	desired.Spec = want.Spec
+	return c.kubeclient.PolicyV1beta1().PodDisruptionBudgets(desired.Namespace).Update(ctx, desired, metav1.UpdateOptions{})
+}
+
+func (c *Reconciler) createNetworkPolicy(ctx context.Context, np *networkingv1.NetworkPolicy) (*networkingv1.NetworkPolicy, error) {
+	return c.kubeclient.NetworkingV1().NetworkPolicies(np.Namespace).Create(ctx, np, metav1.CreateOptions{})
+}
+
+func (c *Reconciler) checkAndUpdateNetworkPolicy(ctx context.Context, have, want *networkingv1.NetworkPolicy) (*networkingv1.NetworkPolicy, error) {
+	// If the spec we want is the spec we have, then we're good.
+	if equality.Semantic.DeepEqual(have.Spec, want.Spec) {
+		return have, nil
+	}
+
+	// Otherwise attempt an update (with ONLY the spec changes).
+	desired := have.DeepCopy()
+	desired.Spec = want.Spec
+	return c.kubeclient.NetworkingV1().NetworkPolicies(desired.Namespace).Update(ctx, desired, metav1.UpdateOptions{})
+}
+
+func (c *Reconciler) createHeadlessService(ctx context.Context, svc *corev1.Service) (*corev1.Service, error) {
+	return c.kubeclient.CoreV1().Services(svc.Namespace).Create(ctx, svc, metav1.CreateOptions{})
+}
+
+func (c *Reconciler) checkAndUpdateHeadlessService(ctx context.Context, have, want *corev1.Service) (*corev1.Service, error) {
+	// Our controller manages only part of the spec, the rest is defaulted by
+	// the API server, so only compare and set the fields we own.
+	desired := have.DeepCopy()
+	desired.Spec.ClusterIP = want.Spec.ClusterIP
+	desired.Spec.PublishNotReadyAddresses = want.Spec.PublishNotReadyAddresses
+	desired.Spec.Ports = want.Spec.Ports
+	desired.Spec.Selector = want.Spec.Selector
+	if equality.Semantic.DeepEqual(have.Spec, desired.Spec) {
+		return have, nil
+	}
+	return c.kubeclient.CoreV1().Services(desired.Namespace).Update(ctx, desired, metav1.UpdateOptions{})
+}
+
 func (c *Reconciler) createPA(ctx context.Context, rev *v1.Revision) (*autoscalingv1alpha1.PodAutoscaler, error) {
 	pa := resources.MakePA(rev)
 	return c.client.AutoscalingV1alpha1().PodAutoscalers(pa.Namespace).Create(ctx, pa, metav1.CreateOptions{})
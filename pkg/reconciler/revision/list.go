@@ -0,0 +1,54 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	listers "knative.dev/serving/pkg/client/listers/serving/v1"
+)
+
+// ListRevisionsByConditionReason returns all revisions across namespaces which
+// have at least one condition with the given reason, e.g.
+// ProgressDeadlineExceeded. The result is sorted by namespace and name.
+func ListRevisionsByConditionReason(lister listers.RevisionLister, reason string) ([]*v1.Revision, error) {
+	revs, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*v1.Revision
+	for _, rev := range revs {
+		for _, cond := range rev.Status.Conditions {
+			if cond.Reason == reason {
+				ret = append(ret, rev)
+				break
+			}
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revision
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+
+	. "knative.dev/serving/pkg/reconciler/testing/v1"
+	. "knative.dev/serving/pkg/testing/v1"
+)
+
+func TestListRevisionsByConditionReason(t *testing.T) {
+	objs := []runtime.Object{
+		Revision("foo", "ready", MarkRevisionReady),
+		Revision("foo", "deploying", WithInitRevConditions, MarkDeploying(v1.ReasonDeploying)),
+		Revision("foo", "timeout", WithInitRevConditions, MarkProgressDeadlineExceeded("timed out")),
+		Revision("bar", "timeout", WithInitRevConditions, MarkProgressDeadlineExceeded("timed out")),
+		Revision("bar", "no-conditions"),
+	}
+
+	tests := []struct {
+		name   string
+		reason string
+		want   []string
+	}{{
+		name:   "progress deadline exceeded",
+		reason: v1.ReasonProgressDeadlineExceeded,
+		want:   []string{"bar/timeout", "foo/timeout"},
+	}, {
+		name:   "deploying",
+		reason: v1.ReasonDeploying,
+		want:   []string{"foo/deploying"},
+	}, {
+		name:   "no match",
+		reason: v1.ReasonNotOwned,
+	}}
+
+	listers := NewListers(objs)
+	lister := listers.GetRevisionLister()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			revs, err := ListRevisionsByConditionReason(lister, test.reason)
+			if err != nil {
+				t.Fatal("ListRevisionsByConditionReason() =", err)
+			}
+			var got []string
+			for _, rev := range revs {
+				got = append(got, rev.Namespace+"/"+rev.Name)
+			}
+			if !cmp.Equal(got, test.want) {
+				t.Error("ListRevisionsByConditionReason (-want, +got) =", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
@@ -19,6 +19,8 @@ package revision
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -27,12 +29,21 @@ import (
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 
+	"knative.dev/pkg/apis"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/kmp"
 	"knative.dev/pkg/logging"
 	"knative.dev/pkg/logging/logkey"
+	"knative.dev/pkg/tracker"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
+	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	aresources "knative.dev/serving/pkg/reconciler/autoscaling/resources"
+	"knative.dev/serving/pkg/reconciler/revision/config"
 	"knative.dev/serving/pkg/reconciler/revision/resources"
 	resourcenames "knative.dev/serving/pkg/reconciler/revision/resources/names"
 )
@@ -76,17 +87,35 @@ func (c *Reconciler) reconcileDeployment(ctx context.Context, rev *v1.Revision)
 			rev.Status.PropagateDeploymentStatus(&deployment.Status)
 		}
 	}
+	rev.Status.QueueProxyImage = queueProxyImage(deployment)
 
 	// If a container keeps crashing (no active pods in the deployment although we want some)
 	if *deployment.Spec.Replicas > 0 && deployment.Status.AvailableReplicas == 0 {
-		pods, err := c.kubeclient.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector)})
+		// List all of the revision's pods rather than only those selected by
+		// the deployment, to also notice the ones whose labels drifted away
+		// from its selector.
+		pods, err := c.kubeclient.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{serving.RevisionLabelKey: rev.Name}).String(),
+		})
 		if err != nil {
 			logger.Errorw("Error getting pods", zap.Error(err))
 			return nil
 		}
-		if len(pods.Items) > 0 {
+		selected, err := selectedPods(deployment, pods.Items)
+		if err != nil {
+			logger.Errorw("Error getting pods", zap.Error(err))
+			return nil
+		}
+		if len(pods.Items) > 0 && len(selected) == 0 {
+			// The deployment doesn't see any of the pods, e.g. because a
+			// mutating webhook changed their labels, so it keeps creating new
+			// ones that never become available.
+			rev.Status.MarkResourcesAvailableFalse(v1.ReasonSelectorMismatch,
+				fmt.Sprintf("Pods of the revision are not selected by Deployment %q", deploymentName))
+		}
+		if len(selected) > 0 {
 			// Arbitrarily grab the very first pod, as they all should be crashing
-			pod := pods.Items[0]
+			pod := selected[0]
 
 			// Update the revision status if pod cannot be scheduled (possibly resource constraints)
 			// If pod cannot be scheduled then we expect the container status to be empty.
@@ -97,40 +126,458 @@ func (c *Reconciler) reconcileDeployment(ctx context.Context, rev *v1.Revision)
 				}
 			}
 
+			// Surface the first failure across all of the user's containers.
+			userContainers := make(map[string]*corev1.Container, len(rev.Spec.Containers))
+			for i := range rev.Spec.Containers {
+				userContainers[rev.Spec.Containers[i].Name] = &rev.Spec.Containers[i]
+			}
 			for _, status := range pod.Status.ContainerStatuses {
-				if status.Name == rev.Spec.GetContainer().Name {
-					if t := status.LastTerminationState.Terminated; t != nil {
-						logger.Infof("marking exiting with: %d/%s", t.ExitCode, t.Message)
-						rev.Status.MarkContainerHealthyFalse(v1.ExitCodeReason(t.ExitCode), v1.RevisionContainerExitingMessage(t.Message))
-					} else if w := status.State.Waiting; w != nil && hasDeploymentTimedOut(deployment) {
-						logger.Infof("marking resources unavailable with: %s: %s", w.Reason, w.Message)
-						rev.Status.MarkResourcesAvailableFalse(w.Reason, w.Message)
-					}
+				container, ok := userContainers[status.Name]
+				if !ok {
+					continue
+				}
+				if w := status.State.Waiting; w != nil && w.Reason == postStartHookError {
+					// Only the sidecar gate sets a postStart hook.
+					logger.Infof("marking sidecar %s not ready with: %s", status.Name, w.Message)
+					rev.Status.MarkContainerHealthyFalse(v1.ReasonSidecarNotReady,
+						v1.RevisionSidecarNotReadyMessage(status.Name, w.Message))
+					break
+				} else if restartedTooOften(ctx, container, status) {
+					logger.Infof("marking restart loop after %d restarts", status.RestartCount)
+					rev.Status.MarkContainerHealthyFalse(v1.ReasonRestartLoop,
+						v1.RevisionContainerRestartingMessage(status.Name, status.RestartCount))
+					break
+				} else if t := status.LastTerminationState.Terminated; t != nil {
+					logger.Infof("marking exiting with: %d/%s", t.ExitCode, t.Message)
+					rev.Status.MarkContainerHealthyFalse(v1.ExitCodeReason(t.ExitCode), v1.RevisionContainerExitingMessage(t.Message))
+					break
+				} else if w := status.State.Waiting; w != nil && isImagePullError(w.Reason) {
+					logger.Infof("marking image pull failure with: %s: %s", w.Reason, w.Message)
+					rev.Status.MarkContainerHealthyFalse(v1.ReasonImagePullBackOff,
+						v1.RevisionContainerMissingMessage(container.Image, w.Message))
+					break
+				} else if w != nil && hasDeploymentTimedOut(deployment) {
+					logger.Infof("marking resources unavailable with: %s: %s", w.Reason, w.Message)
+					rev.Status.MarkResourcesAvailableFalse(w.Reason, w.Message)
 					break
 				}
 			}
+
+			if !rev.Status.GetCondition(v1.RevisionConditionContainerHealthy).IsFalse() {
+				if msg, failing := readinessProbeFailing(deployment, &pod, time.Now()); failing {
+					logger.Infof("marking readiness probe failing with: %s", msg)
+					rev.Status.MarkContainerHealthyFalse(v1.ReasonProbeFailed, v1.RevisionContainerProbeFailedMessage(msg))
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
+// restartedTooOften returns whether the container has a liveness probe and was
+// restarted more often than the configured maximum.
+func restartedTooOften(ctx context.Context, container *corev1.Container, status corev1.ContainerStatus) bool {
+	max := config.FromContext(ctx).Deployment.LivenessProbeMaxRestarts
+	return max > 0 && container.LivenessProbe != nil && int(status.RestartCount) > max
+}
+
+// postStartHookError is the waiting reason the kubelet reports for a container
+// whose postStart hook failed.
+const postStartHookError = "PostStartHookError"
+
+// isImagePullError returns whether the given container waiting reason signals
+// that the container's image cannot be pulled.
+func isImagePullError(reason string) bool {
+	return reason == "ImagePullBackOff" || reason == "ErrImagePull"
+}
+
+// readinessProbeFailing returns whether the queue-proxy container, which executes
+// the revision's readiness probe, has been running without becoming ready for
+// longer than its probes allow. If so, it also returns the pod's readiness
+// message. Pods whose containers haven't passed their startup probes yet are
+// left to the progress deadline.
+func readinessProbeFailing(deployment *appsv1.Deployment, pod *corev1.Pod, now time.Time) (string, bool) {
+	var (
+		readiness *corev1.Probe
+		startup   time.Duration
+	)
+	for _, c := range deployment.Spec.Template.Spec.Containers {
+		if c.Name == resources.QueueContainerName {
+			readiness = c.ReadinessProbe
+		} else if d := probeBudget(c.StartupProbe); d > startup {
+			// The queue-proxy's startup probe is gated on the user container's
+			// readiness, so only the user containers' budgets matter.
+			startup = d
+		}
+	}
+	if readiness == nil {
+		return "", false
+	}
+
+	var startedAt time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Started == nil || !*status.Started || status.State.Running == nil {
+			return "", false
+		}
+		if status.Name != resources.QueueContainerName {
+			continue
+		}
+		if status.Ready {
+			return "", false
+		}
+		startedAt = status.State.Running.StartedAt.Time
+	}
+	if startedAt.IsZero() {
+		return "", false
+	}
+
+	if now.Sub(startedAt) <= startup+probeBudget(readiness) {
+		return "", false
+	}
+
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady && cond.Message != "" {
+			return cond.Message, true
+		}
+	}
+	return "containers are not ready", true
+}
+
+// probeBudget returns how long the given probe may fail before K8s gives up
+// on the container.
+func probeBudget(probe *corev1.Probe) time.Duration {
+	if probe == nil {
+		return 0
+	}
+	// Fall back to the K8s defaults for unset probe values.
+	period, threshold := probe.PeriodSeconds, probe.FailureThreshold
+	if period <= 0 {
+		period = 10
+	}
+	if threshold <= 0 {
+		threshold = 3
+	}
+	return time.Duration(probe.InitialDelaySeconds+period*threshold) * time.Second
+}
+
+// selectedPods returns the given pods that are matched by the deployment's
+// selector.
+func selectedPods(deployment *appsv1.Deployment, pods []corev1.Pod) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected, nil
+}
+
+// queueProxyImage returns the image of the queue-proxy container of the given
+// deployment, or the empty string if it has none.
+func queueProxyImage(deployment *appsv1.Deployment) string {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == resources.QueueContainerName {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// reconcileReferences tracks the ConfigMaps and Secrets the revision's
+// containers take their environment from, as well as its image pull secrets,
+// so that the revision is reconciled once they change. Until the containers
+// became healthy, a missing reference is surfaced in the revision's status, as
+// the pods can't start without it.
+func (c *Reconciler) reconcileReferences(ctx context.Context, rev *v1.Revision) error {
+	var reason, message string
+	for _, ref := range envSources(rev) {
+		found, err := c.trackReference(ref, rev)
+		if err != nil {
+			return err
+		}
+		if !found && reason == "" {
+			reason, message = v1.ReasonMissingConfiguration, v1.RevisionConfigurationMissingMessage(ref.Kind, ref.Name)
+		}
+	}
+	for _, ref := range pullSecrets(rev) {
+		found, err := c.trackReference(ref, rev)
+		if err != nil {
+			return err
+		}
+		if !found && reason == "" {
+			reason, message = v1.ReasonMissingPullSecret, v1.RevisionPullSecretMissingMessage(ref.Name)
+		}
+	}
+
+	cond := rev.Status.GetCondition(v1.RevisionConditionContainerHealthy)
+	if reason != "" && !cond.IsTrue() {
+		rev.Status.MarkContainerHealthyFalse(reason, message)
+	} else if reason == "" && cond != nil &&
+		(cond.Reason == v1.ReasonMissingConfiguration || cond.Reason == v1.ReasonMissingPullSecret) {
+		// The references appeared, give the pods a chance to start.
+		rev.Status.MarkContainerHealthyUnknown(v1.ReasonDeploying, "")
+	}
+	return nil
+}
+
+// trackReference tracks the referenced ConfigMap or Secret for the revision
+// and returns whether it exists. Only the objects labeled with
+// serving.RevisionReferenceLabelKey are cached, so the others are reported as
+// missing.
+func (c *Reconciler) trackReference(ref tracker.Reference, rev *v1.Revision) (bool, error) {
+	if err := c.tracker.TrackReference(ref, rev); err != nil {
+		return false, fmt.Errorf("failed to track %s %q: %w", ref.Kind, ref.Name, err)
+	}
+
+	var err error
+	switch ref.Kind {
+	case "ConfigMap":
+		_, err = c.configMapLister.ConfigMaps(ref.Namespace).Get(ref.Name)
+	case "Secret":
+		_, err = c.secretLister.Secrets(ref.Namespace).Get(ref.Name)
+	}
+	if apierrs.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get %s %q: %w", ref.Kind, ref.Name, err)
+	}
+	return true, nil
+}
+
+// pullSecrets returns references to the image pull secrets of the revision.
+// Those of its service account are applied by the kubelet and not tracked.
+func pullSecrets(rev *v1.Revision) []tracker.Reference {
+	refs := make([]tracker.Reference, 0, len(rev.Spec.ImagePullSecrets))
+	for _, s := range rev.Spec.ImagePullSecrets {
+		refs = append(refs, tracker.Reference{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Namespace:  rev.Namespace,
+			Name:       s.Name,
+		})
+	}
+	return refs
+}
+
+// envSources returns references to the ConfigMaps and Secrets the revision's
+// containers take their environment from. Optional sources are omitted.
+func envSources(rev *v1.Revision) []tracker.Reference {
+	var refs []tracker.Reference
+	seen := sets.NewString()
+	add := func(kind, name string, optional *bool) {
+		if optional != nil && *optional {
+			return
+		}
+		if key := kind + "/" + name; !seen.Has(key) {
+			seen.Insert(key)
+			refs = append(refs, tracker.Reference{
+				APIVersion: "v1",
+				Kind:       kind,
+				Namespace:  rev.Namespace,
+				Name:       name,
+			})
+		}
+	}
+
+	for _, container := range rev.Spec.Containers {
+		for _, from := range container.EnvFrom {
+			if ref := from.ConfigMapRef; ref != nil {
+				add("ConfigMap", ref.Name, ref.Optional)
+			}
+			if ref := from.SecretRef; ref != nil {
+				add("Secret", ref.Name, ref.Optional)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				add("ConfigMap", ref.Name, ref.Optional)
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				add("Secret", ref.Name, ref.Optional)
+			}
+		}
+	}
+	return refs
+}
+
+// reconcileImageCache makes sure a caching.Image pins each of the revision's
+// images and surfaces their status in the informational ImageCached
+// condition. The condition is False as soon as one of them failed and True
+// once all of them are ready. It's absent while they haven't reported their
+// status yet, e.g. if knative/caching isn't installed.
 func (c *Reconciler) reconcileImageCache(ctx context.Context, rev *v1.Revision) error {
+	if config.FromContext(ctx).Deployment.DisableImageCache {
+		rev.Status.ClearImageCached()
+		return nil
+	}
 	logger := logging.FromContext(ctx)
 
 	ns := rev.Namespace
 	// Revisions are immutable.
 	// Updating image results to new revision so there won't be any chance of resource leak.
+	var failed *apis.Condition
+	var failedName string
+	cached := true
 	for _, container := range rev.Status.ContainerStatuses {
 		imageName := kmeta.ChildName(resourcenames.ImageCache(rev), "-"+container.Name)
-		if _, err := c.imageLister.Images(ns).Get(imageName); apierrs.IsNotFound(err) {
+		img, err := c.imageLister.Images(ns).Get(imageName)
+		if apierrs.IsNotFound(err) {
 			if _, err := c.createImageCache(ctx, rev, container.Name, container.ImageDigest); err != nil {
 				return fmt.Errorf("failed to create image cache %q: %w", imageName, err)
 			}
 			logger.Infof("Created image cache %q", imageName)
+			cached = false
+			continue
 		} else if err != nil {
 			return fmt.Errorf("failed to get image cache %q: %w", imageName, err)
 		}
+
+		// Make sure the image cache follows the resolved digest, e.g. after a retag.
+		if img, err = c.checkAndUpdateImageCache(ctx, rev, img, container.Name, container.ImageDigest); err != nil {
+			return fmt.Errorf("failed to update image cache %q: %w", imageName, err)
+		}
+
+		cond := img.Status.GetCondition(apis.ConditionReady)
+		if cond.IsFalse() && failed == nil {
+			failed, failedName = cond, imageName
+		}
+		cached = cached && cond.IsTrue()
+	}
+
+	switch {
+	case failed != nil:
+		rev.Status.MarkImageCachedFalse(failed.Reason,
+			fmt.Sprintf("Image cache %q failed: %s", failedName, failed.Message))
+	case cached:
+		rev.Status.MarkImageCachedTrue()
+	default:
+		rev.Status.ClearImageCached()
+	}
+	return nil
+}
+
+func (c *Reconciler) reconcilePDB(ctx context.Context, rev *v1.Revision) error {
+	ns := rev.Namespace
+	pdbName := resourcenames.PDB(rev)
+	logger := logging.FromContext(ctx)
+
+	want := resources.MakePDB(rev)
+	pdb, err := c.pdbLister.PodDisruptionBudgets(ns).Get(pdbName)
+	if want == nil {
+		// The revision's minimum scale doesn't need protection (anymore),
+		// remove the budget we might have created before, so it doesn't block
+		// node drains.
+		if err == nil && metav1.IsControlledBy(pdb, rev) {
+			if err := c.kubeclient.PolicyV1beta1().PodDisruptionBudgets(ns).Delete(ctx, pdbName, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+				return fmt.Errorf("failed to delete pod disruption budget %q: %w", pdbName, err)
+			}
+			logger.Infof("Deleted pod disruption budget %q", pdbName)
+		}
+		return nil
+	}
+
+	if apierrs.IsNotFound(err) {
+		if _, err := c.createPDB(ctx, want); err != nil {
+			return fmt.Errorf("failed to create pod disruption budget %q: %w", pdbName, err)
+		}
+		logger.Infof("Created pod disruption budget %q", pdbName)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get pod disruption budget %q: %w", pdbName, err)
+	} else if !metav1.IsControlledBy(pdb, rev) {
+		// Surface an error in the revision's status, and return an error.
+		rev.Status.MarkResourcesAvailableFalse(v1.ReasonNotOwned, v1.ResourceNotOwnedMessage("PodDisruptionBudget", pdbName))
+		return fmt.Errorf("revision: %q does not own PodDisruptionBudget: %q", rev.Name, pdbName)
+	}
+
+	if _, err := c.checkAndUpdatePDB(ctx, pdb, want); err != nil {
+		return fmt.Errorf("failed to update pod disruption budget %q: %w", pdbName, err)
+	}
+	return nil
+}
+
+func (c *Reconciler) reconcileNetworkPolicy(ctx context.Context, rev *v1.Revision) error {
+	ns := rev.Namespace
+	npName := resourcenames.NetworkPolicy(rev)
+	logger := logging.FromContext(ctx)
+
+	want := resources.MakeNetworkPolicy(rev, config.FromContext(ctx))
+	np, err := c.networkPolicyLister.NetworkPolicies(ns).Get(npName)
+	if want == nil {
+		// Network policies are disabled, remove the one we might have created
+		// while they were enabled.
+		if err == nil && metav1.IsControlledBy(np, rev) {
+			if err := c.kubeclient.NetworkingV1().NetworkPolicies(ns).Delete(ctx, npName, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+				return fmt.Errorf("failed to delete network policy %q: %w", npName, err)
+			}
+			logger.Infof("Deleted network policy %q", npName)
+		}
+		return nil
+	}
+
+	if apierrs.IsNotFound(err) {
+		if _, err := c.createNetworkPolicy(ctx, want); err != nil {
+			return fmt.Errorf("failed to create network policy %q: %w", npName, err)
+		}
+		logger.Infof("Created network policy %q", npName)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get network policy %q: %w", npName, err)
+	} else if !metav1.IsControlledBy(np, rev) {
+		// Surface an error in the revision's status, and return an error.
+		rev.Status.MarkResourcesAvailableFalse(v1.ReasonNotOwned, v1.ResourceNotOwnedMessage("NetworkPolicy", npName))
+		return fmt.Errorf("revision: %q does not own NetworkPolicy: %q", rev.Name, npName)
+	}
+
+	if _, err := c.checkAndUpdateNetworkPolicy(ctx, np, want); err != nil {
+		return fmt.Errorf("failed to update network policy %q: %w", npName, err)
+	}
+	return nil
+}
+
+func (c *Reconciler) reconcileHeadlessService(ctx context.Context, rev *v1.Revision) error {
+	ns := rev.Namespace
+	svcName := resourcenames.HeadlessService(rev)
+	logger := logging.FromContext(ctx)
+
+	svc, err := c.serviceLister.Services(ns).Get(svcName)
+	if !config.FromContext(ctx).Deployment.EnableHeadlessService {
+		// Headless services are disabled, remove the one we might have
+		// created while they were enabled.
+		if err == nil && metav1.IsControlledBy(svc, rev) {
+			if err := c.kubeclient.CoreV1().Services(ns).Delete(ctx, svcName, metav1.DeleteOptions{}); err != nil && !apierrs.IsNotFound(err) {
+				return fmt.Errorf("failed to delete headless service %q: %w", svcName, err)
+			}
+			logger.Infof("Deleted headless service %q", svcName)
+		}
+		return nil
+	}
+
+	want := resources.MakeHeadlessService(rev)
+	if apierrs.IsNotFound(err) {
+		if _, err := c.createHeadlessService(ctx, want); err != nil {
+			return fmt.Errorf("failed to create headless service %q: %w", svcName, err)
+		}
+		logger.Infof("Created headless service %q", svcName)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get headless service %q: %w", svcName, err)
+	} else if !metav1.IsControlledBy(svc, rev) {
+		// Surface an error in the revision's status, and return an error.
+		rev.Status.MarkResourcesAvailableFalse(v1.ReasonNotOwned, v1.ResourceNotOwnedMessage("Service", svcName))
+		return fmt.Errorf("revision: %q does not own Service: %q", rev.Name, svcName)
+	}
+
+	if _, err := c.checkAndUpdateHeadlessService(ctx, svc, want); err != nil {
+		return fmt.Errorf("failed to update headless service %q: %w", svcName, err)
 	}
 	return nil
 }
@@ -177,10 +624,52 @@ func (c *Reconciler) reconcilePA(ctx context.Context, rev *v1.Revision) error {
 	rev.Status.ServiceName = rev.Name
 
 	logger.Debugf("Observed PA Status=%#v", pa.Status)
+	// A PA that became ready before the labels of the pods drifted away from
+	// the deployment's selector must not hide the mismatch found by
+	// reconcileDeployment.
+	mismatch := rev.Status.GetCondition(v1.RevisionConditionResourcesAvailable)
+	if mismatch != nil && (!mismatch.IsFalse() || mismatch.Reason != v1.ReasonSelectorMismatch) {
+		mismatch = nil
+	}
 	rev.Status.PropagateAutoscalerStatus(&pa.Status)
+	if mismatch != nil {
+		rev.Status.MarkResourcesAvailableFalse(mismatch.Reason, mismatch.Message)
+	}
+	rev.Status.CurrentTarget = currentTarget(ctx, pa)
+	rev.Status.ScaleDownDelay = scaleDownDelay(ctx, pa)
+	rev.Status.MinReplicas, _ = pa.ScaleBounds(config.FromContext(ctx).Autoscaler)
 	return nil
 }
 
+// scaleDownDelay returns the scale down delay the autoscaler applies to the
+// given PA, or the empty string if scaling down isn't delayed. Only the KPA
+// supports delaying scale down.
+func scaleDownDelay(ctx context.Context, pa *autoscalingv1alpha1.PodAutoscaler) string {
+	if pa.Class() != autoscaling.KPA {
+		return ""
+	}
+	delay, ok := pa.ScaleDownDelay()
+	if !ok {
+		delay = config.FromContext(ctx).Autoscaler.ScaleDownDelay
+	}
+	if delay == 0 {
+		return ""
+	}
+	return delay.String()
+}
+
+// currentTarget returns the scaling target the autoscaler resolves for the
+// given PA, or the empty string if the PA doesn't scale on concurrency or rps.
+func currentTarget(ctx context.Context, pa *autoscalingv1alpha1.PodAutoscaler) string {
+	switch pa.Metric() {
+	case autoscaling.Concurrency, autoscaling.RPS:
+		target, _ := aresources.ResolveMetricTarget(pa, config.FromContext(ctx).Autoscaler)
+		return strconv.FormatFloat(target, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
 func hasDeploymentTimedOut(deployment *appsv1.Deployment) bool {
 	// as per https://kubernetes.io/docs/concepts/workloads/controllers/deployment
 	for _, cond := range deployment.Status.Conditions {
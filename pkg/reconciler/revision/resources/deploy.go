@@ -18,15 +18,18 @@ package resources
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 
 	network "knative.dev/networking/pkg"
 	"knative.dev/pkg/kmeta"
 	"knative.dev/pkg/ptr"
 	"knative.dev/serving/pkg/apis/autoscaling"
+	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/networking"
 	"knative.dev/serving/pkg/queue"
+	"knative.dev/serving/pkg/queue/readiness"
 	"knative.dev/serving/pkg/reconciler/revision/config"
 	"knative.dev/serving/pkg/reconciler/revision/resources/names"
 
@@ -36,7 +39,28 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+const (
+	// SidecarGateContainerName is the name of the init container installing
+	// the binary that gates the serving container's start on its sidecars.
+	SidecarGateContainerName = "sidecar-gate"
+
+	sidecarGateBinary = "/knative-sidecar-gate/queue"
+)
+
 var (
+	sidecarGateVolume = corev1.Volume{
+		Name: "knative-sidecar-gate",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	sidecarGateVolumeMount = corev1.VolumeMount{
+		Name:      sidecarGateVolume.Name,
+		MountPath: "/knative-sidecar-gate",
+		ReadOnly:  true,
+	}
+
 	varLogVolume = corev1.Volume{
 		Name: "knative-var-log",
 		VolumeSource: corev1.VolumeSource{
@@ -93,7 +117,14 @@ func makePodSpec(rev *v1.Revision, cfg *config.Config) (*corev1.PodSpec, error)
 		return nil, fmt.Errorf("failed to create queue-proxy container: %w", err)
 	}
 
-	podSpec := BuildPodSpec(rev, append(BuildUserContainers(rev), *queueContainer), cfg)
+	userContainers := BuildUserContainers(rev)
+	gated := sidecarsFirst(rev) && gateSidecars(userContainers, cfg)
+	podSpec := BuildPodSpec(rev, append(userContainers, *queueContainer), cfg)
+	if gated {
+		podSpec.Volumes = append(podSpec.Volumes, sidecarGateVolume)
+		podSpec.InitContainers = append(podSpec.InitContainers, makeSidecarGateContainer(cfg))
+	}
+	applyTopologySpread(podSpec, rev, cfg)
 
 	if cfg.Observability.EnableVarLogCollection {
 		podSpec.Volumes = append(podSpec.Volumes, varLogVolume)
@@ -115,6 +146,130 @@ func makePodSpec(rev *v1.Revision, cfg *config.Config) (*corev1.PodSpec, error)
 	return podSpec, nil
 }
 
+// sidecarsFirst returns whether the revision requests its sidecars to be
+// started before its serving container.
+func sidecarsFirst(rev *v1.Revision) bool {
+	first, _ := strconv.ParseBool(rev.Annotations[serving.SidecarsFirstAnnotation])
+	return first
+}
+
+// gateSidecars moves the serving container behind all sidecars, keeping the
+// relative order of the sidecars intact, and makes the sidecars with an HTTP
+// or TCP readiness probe block in a postStart hook until that probe passes.
+// The kubelet starts containers in order and waits for a container's postStart
+// hook before starting the next one, so the serving container only starts once
+// these sidecars are ready. It returns whether any sidecar was gated, in which
+// case the pod needs the sidecar gate init container.
+func gateSidecars(containers []corev1.Container, cfg *config.Config) bool {
+	sort.SliceStable(containers, func(i, j int) bool {
+		return len(containers[i].Ports) == 0 && len(containers[j].Ports) != 0
+	})
+
+	gated := false
+	for i := range containers {
+		c := &containers[i]
+		if len(c.Ports) != 0 {
+			continue
+		}
+		probe := sidecarGateProbe(c.ReadinessProbe)
+		if probe == nil {
+			continue
+		}
+		encoded, err := readiness.EncodeProbe(probe)
+		if err != nil {
+			continue
+		}
+
+		lifecycle := c.Lifecycle.DeepCopy()
+		if lifecycle == nil {
+			lifecycle = &corev1.Lifecycle{}
+		}
+		lifecycle.PostStart = &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{sidecarGateBinary,
+					"-sidecar-probe", encoded,
+					"-probe-timeout", cfg.Deployment.ProgressDeadline.String()},
+			},
+		}
+		c.Lifecycle = lifecycle
+		c.VolumeMounts = append(c.VolumeMounts, sidecarGateVolumeMount)
+		gated = true
+	}
+	return gated
+}
+
+// sidecarGateProbe returns the probe the sidecar gate runs from within the
+// sidecar, or nil if the sidecar's readiness probe can't be run that way.
+func sidecarGateProbe(in *corev1.Probe) *corev1.Probe {
+	if in == nil {
+		return nil
+	}
+	probe := in.DeepCopy()
+	switch {
+	case probe.HTTPGet != nil && probe.HTTPGet.Port.Type == intstr.Int:
+		if probe.HTTPGet.Host == "" {
+			probe.HTTPGet.Host = localAddress
+		}
+		if probe.HTTPGet.Scheme == "" {
+			probe.HTTPGet.Scheme = corev1.URISchemeHTTP
+		}
+	case probe.TCPSocket != nil && probe.TCPSocket.Port.Type == intstr.Int:
+		if probe.TCPSocket.Host == "" {
+			probe.TCPSocket.Host = localAddress
+		}
+	default:
+		return nil
+	}
+	return probe
+}
+
+// makeSidecarGateContainer makes the init container that installs the queue
+// binary, which runs the sidecars' postStart hooks, into the shared volume.
+func makeSidecarGateContainer(cfg *config.Config) corev1.Container {
+	mount := sidecarGateVolumeMount
+	mount.ReadOnly = false
+	return corev1.Container{
+		Name:            SidecarGateContainerName,
+		Image:           cfg.Deployment.QueueSidecarImage,
+		Command:         []string{"/ko-app/queue", "-install", sidecarGateBinary},
+		VolumeMounts:    []corev1.VolumeMount{mount},
+		SecurityContext: queueSecurityContext,
+	}
+}
+
+// CheckTolerations verifies that the revision only tolerates taint keys the
+// operator allowed. An empty allow-list permits any key.
+func CheckTolerations(rev *v1.Revision, cfg *config.Config) error {
+	allowed := cfg.Deployment.AllowedTolerationKeys
+	if allowed.Len() == 0 {
+		return nil
+	}
+	for _, t := range rev.Spec.Tolerations {
+		if !allowed.Has(t.Key) {
+			return fmt.Errorf("toleration for taint key %q is not allowed", t.Key)
+		}
+	}
+	return nil
+}
+
+// applyTopologySpread spreads the revision's pods across the topology key from
+// the revision's annotation or, if absent, the cluster-wide default.
+func applyTopologySpread(pod *corev1.PodSpec, rev *v1.Revision, cfg *config.Config) {
+	key := cfg.Deployment.DefaultTopologyKey
+	if k, ok := rev.Annotations[serving.TopologyKeyAnnotation]; ok {
+		key = k
+	}
+	if key == "" {
+		return
+	}
+	pod.TopologySpreadConstraints = append(pod.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+		MaxSkew:           1,
+		TopologyKey:       key,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     makeSelector(rev),
+	})
+}
+
 // BuildUserContainers makes an array of containers from the Revision template.
 func BuildUserContainers(rev *v1.Revision) []corev1.Container {
 	containers := make([]corev1.Container, 0, len(rev.Spec.PodSpec.Containers))
@@ -169,6 +324,10 @@ func makeServingContainer(servingContainer corev1.Container, rev *v1.Revision) c
 	}
 	// If the client provides probes, we should fill in the port for them.
 	rewriteUserProbe(container.LivenessProbe, int(userPort))
+	// The kubelet doesn't consider the user container ready before its startup
+	// probe passed, which keeps the pod from becoming ready even if the
+	// queue-proxy already reports ready.
+	rewriteUserProbe(container.StartupProbe, int(userPort))
 	return container
 }
 
@@ -178,6 +337,11 @@ func BuildPodSpec(rev *v1.Revision, containers []corev1.Container, cfg *config.C
 	pod := rev.Spec.PodSpec.DeepCopy()
 	pod.Containers = containers
 	pod.TerminationGracePeriodSeconds = rev.Spec.TimeoutSeconds
+	if _, ok := rev.Annotations[serving.PreStopHookAnnotation]; ok && rev.Spec.TimeoutSeconds != nil {
+		// The queue-proxy runs the user's preStop hook once it drained, which
+		// may take up to another timeout.
+		pod.TerminationGracePeriodSeconds = ptr.Int64(2 * *rev.Spec.TimeoutSeconds)
+	}
 	if cfg != nil && pod.EnableServiceLinks == nil {
 		pod.EnableServiceLinks = cfg.Defaults.EnableServiceLinks
 	}
@@ -226,6 +390,21 @@ func buildUserPortEnv(userPort string) corev1.EnvVar {
 	}
 }
 
+// makePodAnnotations returns the annotations of the revision's pods. If the
+// revision opted out of sidecar injection, the service mesh's annotation is
+// added to a copy of anns.
+func makePodAnnotations(rev *v1.Revision, anns map[string]string, cfg *config.Config) map[string]string {
+	meshKey := cfg.Deployment.SidecarInjectAnnotation
+	if meshKey == "" {
+		return anns
+	}
+	// Ignore errors, the value has been validated in the webhook.
+	if inject, err := strconv.ParseBool(rev.Annotations[serving.SidecarInjectAnnotation]); err != nil || inject {
+		return anns
+	}
+	return kmeta.UnionMaps(anns, map[string]string{meshKey: "false"})
+}
+
 // MakeDeployment constructs a K8s Deployment resource from a revision.
 func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, error) {
 	podSpec, err := makePodSpec(rev, cfg)
@@ -267,7 +446,7 @@ func MakeDeployment(rev *v1.Revision, cfg *config.Config) (*appsv1.Deployment, e
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels:      labels,
-					Annotations: anns,
+					Annotations: makePodAnnotations(rev, anns, cfg),
 				},
 				Spec: *podSpec,
 			},
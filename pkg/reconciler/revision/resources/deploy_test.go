@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	network "knative.dev/networking/pkg"
 	"knative.dev/pkg/kmeta"
@@ -346,6 +347,12 @@ func withLivenessProbe(handler corev1.Handler) containerOption {
 	}
 }
 
+func withStartupProbe(handler corev1.Handler) containerOption {
+	return func(container *corev1.Container) {
+		container.StartupProbe = &corev1.Probe{Handler: handler, FailureThreshold: 30, PeriodSeconds: 10}
+	}
+}
+
 func withPrependedVolumeMounts(volumeMounts ...corev1.VolumeMount) containerOption {
 	return func(c *corev1.Container) {
 		c.VolumeMounts = append(volumeMounts, c.VolumeMounts...)
@@ -506,6 +513,63 @@ func TestMakePodSpec(t *testing.T) {
 					withEnvVar("USER_PORT", "8888"),
 					withEnvVar("SERVING_READINESS_PROBE", `{"tcpSocket":{"port":8888,"host":"127.0.0.1"}}`),
 				)}),
+	}, {
+		name: "preStop hook run by the queue-proxy",
+		// The serving container keeps waiting for the drain, after which the
+		// queue-proxy runs the hook, which the grace period leaves room for.
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithRevisionAnn(serving.PreStopHookAnnotation, `{"httpGet":{"path":"/drain"}}`),
+		),
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(),
+				queueContainer(
+					withEnvVar("SERVING_PRE_STOP_HOOK", `{"httpGet":{"path":"/drain"}}`),
+				)},
+			func(ps *corev1.PodSpec) {
+				ps.TerminationGracePeriodSeconds = ptr.Int64(90)
+			}),
+	}, {
+		name: "extended resources passed through",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:  servingContainerName,
+				Image: "busybox",
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: 8888,
+				}},
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						"nvidia.com/gpu": resource.MustParse("1"),
+					},
+				},
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+		),
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(
+					func(container *corev1.Container) {
+						container.Ports[0].ContainerPort = 8888
+						container.Image = "busybox@sha256:deadbeef"
+						container.Resources.Limits = corev1.ResourceList{
+							"nvidia.com/gpu": resource.MustParse("1"),
+						}
+					},
+					withEnvVar("PORT", "8888"),
+				),
+				queueContainer(
+					withEnvVar("USER_PORT", "8888"),
+					withEnvVar("SERVING_READINESS_PROBE", `{"tcpSocket":{"port":8888,"host":"127.0.0.1"}}`),
+				)}),
 	}, {
 		name: "volumes passed through",
 		rev: revision("bar", "foo",
@@ -841,6 +905,79 @@ func TestMakePodSpec(t *testing.T) {
 				),
 				queueContainer(),
 			}),
+	}, {
+		name: "with HTTP startup probe",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+				StartupProbe: &corev1.Probe{
+					FailureThreshold: 30,
+					PeriodSeconds:    10,
+					Handler: corev1.Handler{
+						HTTPGet: &corev1.HTTPGetAction{
+							Path: "/started",
+						},
+					},
+				},
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+		),
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(
+					func(container *corev1.Container) {
+						container.Image = "busybox@sha256:deadbeef"
+					},
+					withStartupProbe(corev1.Handler{
+						HTTPGet: &corev1.HTTPGetAction{
+							Path: "/started",
+							Port: intstr.FromInt(networking.BackendHTTPPort),
+							HTTPHeaders: []corev1.HTTPHeader{{
+								Name:  network.KubeletProbeHeaderName,
+								Value: queue.Name,
+							}},
+						},
+					}),
+				),
+				queueContainer(),
+			}),
+	}, {
+		name: "with tcp startup probe",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+				StartupProbe: &corev1.Probe{
+					FailureThreshold: 30,
+					PeriodSeconds:    10,
+					Handler: corev1.Handler{
+						TCPSocket: &corev1.TCPSocketAction{},
+					},
+				},
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+		),
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(
+					func(container *corev1.Container) {
+						container.Image = "busybox@sha256:deadbeef"
+					},
+					withStartupProbe(corev1.Handler{
+						TCPSocket: &corev1.TCPSocketAction{
+							Port: intstr.FromInt(v1.DefaultUserPort),
+						},
+					}),
+				),
+				queueContainer(),
+			}),
 	}, {
 		name: "complex pod spec",
 		rev: revision("bar", "foo",
@@ -992,6 +1129,92 @@ func TestMakePodSpec(t *testing.T) {
 					withEnvVar("SERVING_READINESS_PROBE", `{"tcpSocket":{"port":8888,"host":"127.0.0.1"}}`),
 				),
 			}),
+	}, {
+		name: "serving container waits for sidecars with readiness probes",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:  servingContainerName,
+				Image: "busybox",
+				Ports: []corev1.ContainerPort{{
+					ContainerPort: v1.DefaultUserPort,
+				}},
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}, {
+				Name:           sidecarContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withHTTPReadinessProbe(8090),
+			}, {
+				Name:  sidecarContainerName2,
+				Image: "alpine",
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}, {
+				ImageDigest: "ubuntu@sha256:deadbffe",
+			}, {
+				ImageDigest: "alpine@sha256:deadbfff",
+			}}),
+			func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.SidecarsFirstAnnotation: "true",
+				}
+			},
+		),
+		want: podSpec(
+			[]corev1.Container{
+				sidecarContainer(sidecarContainerName,
+					func(container *corev1.Container) {
+						container.Image = "ubuntu@sha256:deadbffe"
+						container.ReadinessProbe = withHTTPReadinessProbe(8090)
+						// The sidecar blocks the start of the next container
+						// until its readiness probe passes.
+						container.Lifecycle = &corev1.Lifecycle{
+							PostStart: &corev1.Handler{
+								Exec: &corev1.ExecAction{
+									Command: []string{"/knative-sidecar-gate/queue",
+										"-sidecar-probe", `{"httpGet":{"path":"/","port":8090,"host":"127.0.0.1","scheme":"HTTP"}}`,
+										"-probe-timeout", "1h34m38s"},
+								},
+							},
+							PreStop: userLifecycle.PreStop,
+						}
+						container.VolumeMounts = []corev1.VolumeMount{{
+							Name:      "knative-sidecar-gate",
+							MountPath: "/knative-sidecar-gate",
+							ReadOnly:  true,
+						}}
+					},
+				),
+				// Without a readiness probe, there's nothing to wait for.
+				sidecarContainer(sidecarContainerName2,
+					func(container *corev1.Container) {
+						container.Image = "alpine@sha256:deadbfff"
+					},
+				),
+				servingContainer(
+					func(container *corev1.Container) {
+						container.Image = "busybox@sha256:deadbeef"
+					},
+				),
+				queueContainer(),
+			},
+			withAppendedVolumes(corev1.Volume{
+				Name: "knative-sidecar-gate",
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			}),
+			func(ps *corev1.PodSpec) {
+				ps.InitContainers = []corev1.Container{{
+					Name:    SidecarGateContainerName,
+					Command: []string{"/ko-app/queue", "-install", "/knative-sidecar-gate/queue"},
+					VolumeMounts: []corev1.VolumeMount{{
+						Name:      "knative-sidecar-gate",
+						MountPath: "/knative-sidecar-gate",
+					}},
+					SecurityContext: queueSecurityContext,
+				}}
+			}),
 	}, {
 		name: "properties allowed by the webhook are passed through",
 		rev: revision("bar", "foo",
@@ -1022,6 +1245,26 @@ func TestMakePodSpec(t *testing.T) {
 				p.EnableServiceLinks = ptr.Bool(false)
 			},
 		),
+	}, {
+		name: "service account passed through",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "busybox",
+				ReadinessProbe: withTCPReadinessProbe(v1.DefaultUserPort),
+			}}),
+			func(r *v1.Revision) {
+				r.Spec.ServiceAccountName = "workload-identity"
+			}),
+		want: podSpec(
+			[]corev1.Container{
+				servingContainer(),
+				queueContainer(),
+			},
+			func(p *corev1.PodSpec) {
+				p.ServiceAccountName = "workload-identity"
+			},
+		),
 	}, {
 		name: "var-log collection enabled",
 		oc: metrics.ObservabilityConfig{
@@ -1109,6 +1352,103 @@ var quantityComparer = cmp.Comparer(func(x, y resource.Quantity) bool {
 	return x.Cmp(y) == 0
 })
 
+func TestApplyTopologySpread(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultKey string
+		anns       map[string]string
+		want       string
+	}{{
+		name: "no topology key",
+	}, {
+		name:       "cluster-wide default",
+		defaultKey: "topology.kubernetes.io/zone",
+		want:       "topology.kubernetes.io/zone",
+	}, {
+		name:       "revision override",
+		defaultKey: "topology.kubernetes.io/zone",
+		anns:       map[string]string{serving.TopologyKeyAnnotation: "kubernetes.io/hostname"},
+		want:       "kubernetes.io/hostname",
+	}, {
+		name:       "revision opts out",
+		defaultKey: "topology.kubernetes.io/zone",
+		anns:       map[string]string{serving.TopologyKeyAnnotation: ""},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := revConfig()
+			dc := *cfg.Deployment
+			dc.DefaultTopologyKey = test.defaultKey
+			cfg.Deployment = &dc
+
+			rev := revision("bar", "foo", func(r *v1.Revision) {
+				r.Annotations = test.anns
+			})
+			pod := &corev1.PodSpec{}
+			applyTopologySpread(pod, rev, cfg)
+
+			var want []corev1.TopologySpreadConstraint
+			if test.want != "" {
+				want = []corev1.TopologySpreadConstraint{{
+					MaxSkew:           1,
+					TopologyKey:       test.want,
+					WhenUnsatisfiable: corev1.ScheduleAnyway,
+					LabelSelector:     makeSelector(rev),
+				}}
+			}
+			if got := pod.TopologySpreadConstraints; !cmp.Equal(got, want) {
+				t.Error("TopologySpreadConstraints (-want, +got) =", cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestCheckTolerations(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed sets.String
+		keys    []string
+		wantErr bool
+	}{{
+		name: "empty allow-list",
+		keys: []string{"nvidia.com/gpu"},
+	}, {
+		name:    "allowed key",
+		allowed: sets.NewString("nvidia.com/gpu"),
+		keys:    []string{"nvidia.com/gpu"},
+	}, {
+		name:    "no tolerations",
+		allowed: sets.NewString("nvidia.com/gpu"),
+	}, {
+		name:    "key not allowed",
+		allowed: sets.NewString("nvidia.com/gpu"),
+		keys:    []string{"nvidia.com/gpu", "dedicated"},
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := revConfig()
+			dc := *cfg.Deployment
+			dc.AllowedTolerationKeys = test.allowed
+			cfg.Deployment = &dc
+
+			rev := revision("bar", "foo", func(r *v1.Revision) {
+				for _, key := range test.keys {
+					r.Spec.Tolerations = append(r.Spec.Tolerations, corev1.Toleration{
+						Key:      key,
+						Operator: corev1.TolerationOpExists,
+					})
+				}
+			})
+			if err := CheckTolerations(rev, cfg); (err != nil) != test.wantErr {
+				t.Errorf("CheckTolerations() = %v, wantErr: %t", err, test.wantErr)
+			}
+		})
+	}
+}
+
 func TestMissingProbeError(t *testing.T) {
 	if _, err := MakeDeployment(revision("bar", "foo"), revConfig()); err == nil {
 		t.Error("expected error from MakeDeployment")
@@ -1180,6 +1520,53 @@ func TestMakeDeployment(t *testing.T) {
 			deploy.Spec.Template.Annotations = kmeta.UnionMaps(deploy.Spec.Template.Annotations,
 				map[string]string{sidecarIstioInjectAnnotation: "false"})
 		}),
+	}, {
+		name: "with sidecar injection opt out",
+		dc: deployment.Config{
+			SidecarInjectAnnotation: sidecarIstioInjectAnnotation,
+		},
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			withoutLabels, func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.SidecarInjectAnnotation: "false",
+				}
+			}),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			// Only the pods get the mesh's annotation.
+			deploy.Annotations = map[string]string{serving.SidecarInjectAnnotation: "false"}
+			deploy.Spec.Template.Annotations = map[string]string{
+				serving.SidecarInjectAnnotation: "false",
+				sidecarIstioInjectAnnotation:    "false",
+			}
+		}),
+	}, {
+		name: "with sidecar injection opt out without mesh annotation",
+		rev: revision("bar", "foo",
+			withContainers([]corev1.Container{{
+				Name:           servingContainerName,
+				Image:          "ubuntu",
+				ReadinessProbe: withTCPReadinessProbe(12345),
+			}}),
+			WithContainerStatuses([]v1.ContainerStatus{{
+				ImageDigest: "busybox@sha256:deadbeef",
+			}}),
+			withoutLabels, func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.SidecarInjectAnnotation: "false",
+				}
+			}),
+		want: appsv1deployment(func(deploy *appsv1.Deployment) {
+			deploy.Annotations = map[string]string{serving.SidecarInjectAnnotation: "false"}
+			deploy.Spec.Template.Annotations = map[string]string{serving.SidecarInjectAnnotation: "false"}
+		}),
 	}, {
 		name: "with ProgressDeadline override",
 		dc: deployment.Config{
@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	pkgnet "knative.dev/networking/pkg/apis/networking"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/serving/pkg/apis/serving"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/networking"
+	"knative.dev/serving/pkg/reconciler/revision/resources/names"
+)
+
+// MakeHeadlessService makes a headless Service selecting the revision's pods,
+// which gives every pod its own DNS record. Contrary to the ClusterIP Services
+// owned by the ServerlessService, traffic is never load balanced through it.
+// Only ready pods are published, unless the revision opts into publishing not
+// ready ones as well via serving.PublishNotReadyAddressesAnnotation.
+func MakeHeadlessService(rev *v1.Revision) *corev1.Service {
+	servingPort := queueHTTPPort
+	if rev.GetProtocol() == pkgnet.ProtocolH2C {
+		servingPort = queueHTTP2Port
+	}
+	publishNotReady, _ := strconv.ParseBool(rev.Annotations[serving.PublishNotReadyAddressesAnnotation])
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            names.HeadlessService(rev),
+			Namespace:       rev.Namespace,
+			Labels:          makeLabels(rev),
+			Annotations:     makeAnnotations(rev),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(rev)},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			PublishNotReadyAddresses: publishNotReady,
+			Ports: []corev1.ServicePort{{
+				Name:       pkgnet.ServicePortName(rev.GetProtocol()),
+				Protocol:   corev1.ProtocolTCP,
+				Port:       servingPort.ContainerPort,
+				TargetPort: intstr.FromInt(int(servingPort.ContainerPort)),
+			}, {
+				Name:       v1.AutoscalingQueueMetricsPortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       networking.AutoscalingQueueMetricsPort,
+				TargetPort: intstr.FromString(v1.AutoscalingQueueMetricsPortName),
+			}, {
+				Name:       v1.UserQueueMetricsPortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       networking.UserQueueMetricsPort,
+				TargetPort: intstr.FromString(v1.UserQueueMetricsPortName),
+			}},
+			Selector: makeSelector(rev).MatchLabels,
+		},
+	}
+}
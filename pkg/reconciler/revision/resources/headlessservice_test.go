@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"knative.dev/pkg/ptr"
+	"knative.dev/serving/pkg/apis/serving"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func TestMakeHeadlessService(t *testing.T) {
+	tests := []struct {
+		name string
+		rev  *v1.Revision
+		want *corev1.Service
+	}{{
+		name: "http1",
+		rev:  revisionWithPort("http1"),
+		want: headlessService(corev1.ServicePort{
+			Name:       "http",
+			Protocol:   corev1.ProtocolTCP,
+			Port:       8012,
+			TargetPort: intstr.FromInt(8012),
+		}),
+	}, {
+		name: "h2c",
+		rev:  revisionWithPort("h2c"),
+		want: headlessService(corev1.ServicePort{
+			Name:       "http2",
+			Protocol:   corev1.ProtocolTCP,
+			Port:       8013,
+			TargetPort: intstr.FromInt(8013),
+		}),
+	}, {
+		name: "publish not ready addresses",
+		rev: func() *v1.Revision {
+			rev := revisionWithPort("http1")
+			rev.Annotations = map[string]string{serving.PublishNotReadyAddressesAnnotation: "true"}
+			return rev
+		}(),
+		want: func() *corev1.Service {
+			svc := headlessService(corev1.ServicePort{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       8012,
+				TargetPort: intstr.FromInt(8012),
+			})
+			svc.Annotations = map[string]string{serving.PublishNotReadyAddressesAnnotation: "true"}
+			svc.Spec.PublishNotReadyAddresses = true
+			return svc
+		}(),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MakeHeadlessService(test.rev)
+			if !cmp.Equal(got, test.want) {
+				t.Error("MakeHeadlessService (-want, +got) =", cmp.Diff(test.want, got))
+			}
+			if !cmp.Equal(got.Spec.Selector, makeSelector(test.rev).MatchLabels) {
+				t.Errorf("Selector = %v, want the revision's pod selector %v", got.Spec.Selector, makeSelector(test.rev).MatchLabels)
+			}
+		})
+	}
+}
+
+func revisionWithPort(name string) *v1.Revision {
+	return &v1.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar",
+			UID:       "1234",
+		},
+		Spec: v1.RevisionSpec{
+			PodSpec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Ports: []corev1.ContainerPort{{Name: name}},
+				}},
+			},
+		},
+	}
+}
+
+func headlessService(servingPort corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar-headless",
+			Labels: map[string]string{
+				serving.RevisionLabelKey: "bar",
+				serving.RevisionUID:      "1234",
+				AppLabelKey:              "bar",
+			},
+			Annotations: map[string]string{},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         v1.SchemeGroupVersion.String(),
+				Kind:               "Revision",
+				Name:               "bar",
+				UID:                "1234",
+				Controller:         ptr.Bool(true),
+				BlockOwnerDeletion: ptr.Bool(true),
+			}},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Ports: []corev1.ServicePort{servingPort, {
+				Name:       v1.AutoscalingQueueMetricsPortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       9090,
+				TargetPort: intstr.FromString(v1.AutoscalingQueueMetricsPortName),
+			}, {
+				Name:       v1.UserQueueMetricsPortName,
+				Protocol:   corev1.ProtocolTCP,
+				Port:       9091,
+				TargetPort: intstr.FromString(v1.UserQueueMetricsPortName),
+			}},
+			Selector: map[string]string{
+				serving.RevisionUID: "1234",
+			},
+		},
+	}
+}
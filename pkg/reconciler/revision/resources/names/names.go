@@ -28,6 +28,22 @@ func ImageCache(rev kmeta.Accessor) string {
 	return kmeta.ChildName(rev.GetName(), "-cache")
 }
 
+// PDB returns the precomputed name for the revision's pod disruption budget.
+func PDB(rev kmeta.Accessor) string {
+	return kmeta.ChildName(rev.GetName(), "-pdb")
+}
+
+// NetworkPolicy returns the precomputed name for the revision's network policy.
+func NetworkPolicy(rev kmeta.Accessor) string {
+	return kmeta.ChildName(rev.GetName(), "-netpol")
+}
+
+// HeadlessService returns the precomputed name for the revision's headless
+// service.
+func HeadlessService(rev kmeta.Accessor) string {
+	return kmeta.ChildName(rev.GetName(), "-headless")
+}
+
 // PA returns the PA name for the revision.
 func PA(rev kmeta.Accessor) string {
 	return rev.GetName()
@@ -86,6 +86,33 @@ func TestNamer(t *testing.T) {
 		},
 		f:    ImageCache,
 		want: "foo-cache",
+	}, {
+		name: "PDB",
+		rev: &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "bar",
+			},
+		},
+		f:    PDB,
+		want: "bar-pdb",
+	}, {
+		name: "NetworkPolicy",
+		rev: &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "bar",
+			},
+		},
+		f:    NetworkPolicy,
+		want: "bar-netpol",
+	}, {
+		name: "HeadlessService",
+		rev: &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "bar",
+			},
+		},
+		f:    HeadlessService,
+		want: "bar-headless",
 	}, {
 		name: "PA",
 		rev: &v1.Revision{
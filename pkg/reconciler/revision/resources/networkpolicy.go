@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/system"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/reconciler/revision/config"
+	"knative.dev/serving/pkg/reconciler/revision/resources/names"
+)
+
+// MakeNetworkPolicy makes a NetworkPolicy which only admits traffic to the
+// revision's pods from the Knative Serving namespace, where the activator
+// and the autoscaler scraping metrics live, and from the configured ingress
+// namespaces, which are selected by the configured namespace label. It
+// returns nil if network policies are disabled.
+func MakeNetworkPolicy(rev *v1.Revision, cfg *config.Config) *networkingv1.NetworkPolicy {
+	if !cfg.Deployment.EnableNetworkPolicy {
+		return nil
+	}
+
+	labelKey := cfg.Deployment.NetworkPolicyNamespaceLabel
+	namespaces := cfg.Deployment.NetworkPolicyIngressNamespaces.Union(nil).Insert(system.Namespace())
+	from := make([]networkingv1.NetworkPolicyPeer, 0, namespaces.Len())
+	for _, ns := range namespaces.List() {
+		from = append(from, networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{labelKey: ns},
+			},
+		})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            names.NetworkPolicy(rev),
+			Namespace:       rev.Namespace,
+			Labels:          makeLabels(rev),
+			Annotations:     makeAnnotations(rev),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(rev)},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *makeSelector(rev),
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: from,
+			}},
+		},
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"knative.dev/pkg/ptr"
+	"knative.dev/pkg/system"
+	"knative.dev/serving/pkg/apis/serving"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/deployment"
+	"knative.dev/serving/pkg/reconciler/revision/config"
+)
+
+func TestMakeNetworkPolicy(t *testing.T) {
+	rev := &v1.Revision{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar",
+			UID:       "1234",
+		},
+	}
+	labeledPeer := func(key, ns string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{key: ns},
+			},
+		}
+	}
+	peer := func(ns string) networkingv1.NetworkPolicyPeer {
+		return labeledPeer("kubernetes.io/metadata.name", ns)
+	}
+
+	tests := []struct {
+		name string
+		dc   deployment.Config
+		want *networkingv1.NetworkPolicy
+	}{{
+		name: "disabled",
+		dc: deployment.Config{
+			NetworkPolicyIngressNamespaces: sets.NewString("kourier-system"),
+		},
+	}, {
+		name: "only the system namespace",
+		dc: deployment.Config{
+			EnableNetworkPolicy:         true,
+			NetworkPolicyNamespaceLabel: "kubernetes.io/metadata.name",
+		},
+		want: networkPolicy(peer(system.Namespace())),
+	}, {
+		name: "with ingress namespaces",
+		dc: deployment.Config{
+			EnableNetworkPolicy:            true,
+			NetworkPolicyIngressNamespaces: sets.NewString("kourier-system", "monitoring"),
+			NetworkPolicyNamespaceLabel:    "kubernetes.io/metadata.name",
+		},
+		want: networkPolicy(peer(system.Namespace()), peer("kourier-system"), peer("monitoring")),
+	}, {
+		name: "with custom namespace label",
+		dc: deployment.Config{
+			EnableNetworkPolicy:            true,
+			NetworkPolicyIngressNamespaces: sets.NewString("kourier-system"),
+			NetworkPolicyNamespaceLabel:    "name",
+		},
+		want: networkPolicy(labeledPeer("name", system.Namespace()), labeledPeer("name", "kourier-system")),
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MakeNetworkPolicy(rev, &config.Config{Deployment: &test.dc})
+			if !cmp.Equal(got, test.want) {
+				t.Error("MakeNetworkPolicy (-want, +got) =", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
+
+func networkPolicy(from ...networkingv1.NetworkPolicyPeer) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar-netpol",
+			Labels: map[string]string{
+				serving.RevisionLabelKey: "bar",
+				serving.RevisionUID:      "1234",
+				AppLabelKey:              "bar",
+			},
+			Annotations: map[string]string{},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         v1.SchemeGroupVersion.String(),
+				Kind:               "Revision",
+				Name:               "bar",
+				UID:                "1234",
+				Controller:         ptr.Bool(true),
+				BlockOwnerDeletion: ptr.Bool(true),
+			}},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					serving.RevisionUID: "1234",
+				},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: from,
+			}},
+		},
+	}
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package resources
 
 import (
+	"strconv"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"knative.dev/pkg/kmeta"
+	"knative.dev/serving/pkg/apis/autoscaling"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/reconciler/revision/resources/names"
@@ -33,7 +36,7 @@ func MakePA(rev *v1.Revision) *autoscalingv1alpha1.PodAutoscaler {
 			Name:            names.PA(rev),
 			Namespace:       rev.Namespace,
 			Labels:          makeLabels(rev),
-			Annotations:     makeAnnotations(rev),
+			Annotations:     makePAAnnotations(rev),
 			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(rev)},
 		},
 		Spec: autoscalingv1alpha1.PodAutoscalerSpec{
@@ -68,3 +71,17 @@ func MakePA(rev *v1.Revision) *autoscalingv1alpha1.PodAutoscaler {
 		},
 	}
 }
+
+// makePAAnnotations constructs the annotations of the PA. If the revision
+// opted out of scaling to zero, the minScale annotation is raised to 1 so that
+// the autoscaler keeps at least one replica around.
+func makePAAnnotations(rev *v1.Revision) map[string]string {
+	anns := makeAnnotations(rev)
+	if stz, err := strconv.ParseBool(anns[autoscaling.ScaleToZeroAnnotationKey]); err == nil && !stz {
+		// Ignore errors, the value has been validated in the webhook.
+		if min, _ := strconv.ParseInt(anns[autoscaling.MinScaleAnnotationKey], 10, 32); min < 1 {
+			anns[autoscaling.MinScaleAnnotationKey] = "1"
+		}
+	}
+	return anns
+}
@@ -25,6 +25,7 @@ import (
 
 	"knative.dev/networking/pkg/apis/networking"
 	"knative.dev/pkg/ptr"
+	"knative.dev/serving/pkg/apis/autoscaling"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
@@ -319,3 +320,68 @@ func TestMakePA(t *testing.T) {
 		})
 	}
 }
+
+func TestMakePAAnnotations(t *testing.T) {
+	tests := []struct {
+		name string
+		anns map[string]string
+		want map[string]string
+	}{{
+		name: "no annotations",
+		want: map[string]string{},
+	}, {
+		name: "scale to zero allowed",
+		anns: map[string]string{autoscaling.ScaleToZeroAnnotationKey: "true"},
+		want: map[string]string{autoscaling.ScaleToZeroAnnotationKey: "true"},
+	}, {
+		name: "scale to zero disabled",
+		anns: map[string]string{autoscaling.ScaleToZeroAnnotationKey: "false"},
+		want: map[string]string{
+			autoscaling.ScaleToZeroAnnotationKey: "false",
+			autoscaling.MinScaleAnnotationKey:    "1",
+		},
+	}, {
+		name: "scale to zero disabled with min scale 0",
+		anns: map[string]string{
+			autoscaling.ScaleToZeroAnnotationKey: "false",
+			autoscaling.MinScaleAnnotationKey:    "0",
+		},
+		want: map[string]string{
+			autoscaling.ScaleToZeroAnnotationKey: "false",
+			autoscaling.MinScaleAnnotationKey:    "1",
+		},
+	}, {
+		name: "scale to zero disabled with higher min scale",
+		anns: map[string]string{
+			autoscaling.ScaleToZeroAnnotationKey: "false",
+			autoscaling.MinScaleAnnotationKey:    "3",
+		},
+		want: map[string]string{
+			autoscaling.ScaleToZeroAnnotationKey: "false",
+			autoscaling.MinScaleAnnotationKey:    "3",
+		},
+	}, {
+		name: "hpa class",
+		anns: map[string]string{autoscaling.ClassAnnotationKey: autoscaling.HPA},
+		want: map[string]string{autoscaling.ClassAnnotationKey: autoscaling.HPA},
+	}, {
+		name: "kpa class",
+		anns: map[string]string{autoscaling.ClassAnnotationKey: autoscaling.KPA},
+		want: map[string]string{autoscaling.ClassAnnotationKey: autoscaling.KPA},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rev := &v1.Revision{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "foo",
+					Name:        "bar",
+					Annotations: test.anns,
+				},
+			}
+			if got := makePAAnnotations(rev); !cmp.Equal(got, test.want) {
+				t.Error("makePAAnnotations (-want, +got) =", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"strconv"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"knative.dev/pkg/kmeta"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/reconciler/revision/resources/names"
+)
+
+// MakePDB makes a PodDisruptionBudget allowing only one of the revision's pods
+// to be unavailable at a time during voluntary disruptions, like node drains.
+// A minimum available count would block drains indefinitely while the revision
+// runs at its minimum scale, which is its usual state. It returns nil if the
+// revision's minimum scale is 1 or less, as there's nothing to protect then.
+func MakePDB(rev *v1.Revision) *policyv1beta1.PodDisruptionBudget {
+	// Ignore errors, the value has been validated in the webhook.
+	min, _ := strconv.ParseInt(rev.Annotations[autoscaling.MinScaleAnnotationKey], 10, 32)
+	if min <= 1 {
+		return nil
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	return &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            names.PDB(rev),
+			Namespace:       rev.Namespace,
+			Labels:          makeLabels(rev),
+			Annotations:     makeAnnotations(rev),
+			OwnerReferences: []metav1.OwnerReference{*kmeta.NewControllerRef(rev)},
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector:       makeSelector(rev),
+		},
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"knative.dev/pkg/ptr"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	"knative.dev/serving/pkg/apis/serving"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func TestMakePDB(t *testing.T) {
+	rev := func(minScale string) *v1.Revision {
+		rev := &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar",
+				UID:       "1234",
+			},
+		}
+		if minScale != "" {
+			rev.Annotations = map[string]string{
+				autoscaling.MinScaleAnnotationKey: minScale,
+			}
+		}
+		return rev
+	}
+
+	one := intstr.FromInt(1)
+	tests := []struct {
+		name string
+		rev  *v1.Revision
+		want *policyv1beta1.PodDisruptionBudget
+	}{{
+		name: "no min scale",
+		rev:  rev(""),
+	}, {
+		name: "min scale 1",
+		rev:  rev("1"),
+	}, {
+		name: "min scale 3",
+		rev:  rev("3"),
+		want: &policyv1beta1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "foo",
+				Name:      "bar-pdb",
+				Labels: map[string]string{
+					serving.RevisionLabelKey: "bar",
+					serving.RevisionUID:      "1234",
+					AppLabelKey:              "bar",
+				},
+				Annotations: map[string]string{
+					autoscaling.MinScaleAnnotationKey: "3",
+				},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         v1.SchemeGroupVersion.String(),
+					Kind:               "Revision",
+					Name:               "bar",
+					UID:                "1234",
+					Controller:         ptr.Bool(true),
+					BlockOwnerDeletion: ptr.Bool(true),
+				}},
+			},
+			Spec: policyv1beta1.PodDisruptionBudgetSpec{
+				MaxUnavailable: &one,
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						serving.RevisionUID: "1234",
+					},
+				},
+			},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := MakePDB(test.rev)
+			if !cmp.Equal(got, test.want) {
+				t.Error("MakePDB (-want, +got) =", cmp.Diff(test.want, got))
+			}
+		})
+	}
+}
@@ -203,6 +203,18 @@ func makeStartupExecProbe(in *corev1.Probe, progressDeadline time.Duration) *cor
 	return out
 }
 
+// applyReadinessAnnotations overrides the queue-proxy readiness probe's period
+// and failure threshold with the values from the revision's annotations.
+func applyReadinessAnnotations(p *corev1.Probe, anns map[string]string) {
+	// Ignore errors, the values have been validated in the webhook.
+	if v, err := strconv.ParseInt(anns[serving.QueueSideCarReadinessFailureThresholdAnnotation], 10, 32); err == nil {
+		p.FailureThreshold = int32(v)
+	}
+	if v, err := strconv.ParseInt(anns[serving.QueueSideCarReadinessPeriodSecondsAnnotation], 10, 32); err == nil {
+		p.PeriodSeconds = int32(v)
+	}
+}
+
 // makeQueueContainer creates the container spec for the queue sidecar.
 func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container, error) {
 	configName := ""
@@ -269,6 +281,7 @@ func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container
 	if httpProbe.PeriodSeconds == 0 {
 		httpProbe.PeriodSeconds = 1
 	}
+	applyReadinessAnnotations(httpProbe, rev.Annotations)
 
 	c := &corev1.Container{
 		Name:            QueueContainerName,
@@ -375,6 +388,32 @@ func makeQueueContainer(rev *v1.Revision, cfg *config.Config) (*corev1.Container
 		})
 	}
 
+	// Same as above, only add this if set to avoid upgrade churn.
+	if v, ok := rev.Annotations[serving.QueueSideCarMaxRequestBodySizeAnnotation]; ok {
+		// Ignore errors, the value has been validated in the webhook.
+		q, _ := resource.ParseQuantity(v)
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  "MAX_REQUEST_BODY_SIZE",
+			Value: strconv.FormatInt(q.Value(), 10),
+		})
+	}
+
+	// Same as above, only add this if set to avoid upgrade churn.
+	if v, ok := rev.Annotations[serving.PreStopHookAnnotation]; ok {
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  "SERVING_PRE_STOP_HOOK",
+			Value: v,
+		})
+	}
+
+	// Same as above, only add this if enforced to avoid upgrade churn.
+	if enforce, _ := strconv.ParseBool(rev.Annotations[serving.QueueSideCarEnforceRequestTimeoutAnnotation]); enforce {
+		c.Env = append(c.Env, corev1.EnvVar{
+			Name:  "ENFORCE_REQUEST_TIMEOUT",
+			Value: "true",
+		})
+	}
+
 	return c, nil
 }
 
@@ -354,6 +354,76 @@ func TestMakeQueueContainer(t *testing.T) {
 				"ENABLE_HTTP2_AUTO_DETECTION": "true",
 			})
 		}),
+	}, {
+		name: "max request body size",
+		rev: revision("bar", "foo",
+			withContainers(containers),
+			func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.QueueSideCarMaxRequestBodySizeAnnotation: "1Mi",
+				}
+			}),
+		dc: deployment.Config{
+			ProgressDeadline: 5678 * time.Second,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"MAX_REQUEST_BODY_SIZE": "1048576",
+			})
+		}),
+	}, {
+		name: "preStop hook",
+		rev: revision("bar", "foo",
+			withContainers(containers),
+			func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.PreStopHookAnnotation: `{"httpGet":{"path":"/drain"}}`,
+				}
+			}),
+		dc: deployment.Config{
+			ProgressDeadline: 5678 * time.Second,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"SERVING_PRE_STOP_HOOK": `{"httpGet":{"path":"/drain"}}`,
+			})
+		}),
+	}, {
+		name: "enforced request timeout",
+		rev: revision("bar", "foo",
+			withContainers(containers),
+			func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.QueueSideCarEnforceRequestTimeoutAnnotation: "true",
+				}
+			}),
+		dc: deployment.Config{
+			ProgressDeadline: 5678 * time.Second,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{
+				"ENFORCE_REQUEST_TIMEOUT": "true",
+			})
+		}),
+	}, {
+		name: "readiness probe tuned via annotations",
+		rev: revision("bar", "foo",
+			withContainers(containers),
+			func(revision *v1.Revision) {
+				revision.Annotations = map[string]string{
+					serving.QueueSideCarReadinessFailureThresholdAnnotation: "5",
+					serving.QueueSideCarReadinessPeriodSecondsAnnotation:    "10",
+				}
+			}),
+		dc: deployment.Config{
+			ProgressDeadline: 5678 * time.Second,
+		},
+		want: queueContainer(func(c *corev1.Container) {
+			c.Env = env(map[string]string{})
+			c.ReadinessProbe = c.ReadinessProbe.DeepCopy()
+			c.ReadinessProbe.FailureThreshold = 5
+			c.ReadinessProbe.PeriodSeconds = 10
+		}),
 	}}
 
 	for _, test := range tests {
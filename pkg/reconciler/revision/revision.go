@@ -26,10 +26,14 @@ import (
 	"go.uber.org/zap/zapcore"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	policyv1beta1listers "k8s.io/client-go/listers/policy/v1beta1"
 	cachingclientset "knative.dev/caching/pkg/client/clientset/versioned"
 	clientset "knative.dev/serving/pkg/client/clientset/versioned"
 	revisionreconciler "knative.dev/serving/pkg/client/injection/reconciler/serving/v1/revision"
@@ -38,9 +42,12 @@ import (
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
 	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
+	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	palisters "knative.dev/serving/pkg/client/listers/autoscaling/v1alpha1"
 	"knative.dev/serving/pkg/reconciler/revision/config"
+	"knative.dev/serving/pkg/reconciler/revision/resources"
 )
 
 type resolver interface {
@@ -59,8 +66,14 @@ type Reconciler struct {
 	podAutoscalerLister palisters.PodAutoscalerLister
 	imageLister         cachinglisters.ImageLister
 	deploymentLister    appsv1listers.DeploymentLister
+	pdbLister           policyv1beta1listers.PodDisruptionBudgetLister
+	networkPolicyLister networkingv1listers.NetworkPolicyLister
+	serviceLister       corev1listers.ServiceLister
+	configMapLister     corev1listers.ConfigMapLister
+	secretLister        corev1listers.SecretLister
 
 	resolver resolver
+	tracker  tracker.Interface
 }
 
 // Check that our Reconciler implements the necessary interfaces.
@@ -142,6 +155,13 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgrec
 		return nil
 	}
 
+	if err := resources.CheckTolerations(rev, config.FromContext(ctx)); err != nil {
+		// Retrying doesn't help until either the revision or the allow-list
+		// changes, both of which enqueue the revision again.
+		rev.Status.MarkResourcesAvailableFalse(v1.ReasonTolerationNotAllowed, err.Error())
+		return nil
+	}
+
 	// Spew is an expensive operation so guard the computation on the debug level
 	// being enabled.
 	// Some things, like PA reachability, etc are computed based on various labels/annotations
@@ -153,7 +173,11 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgrec
 
 	for _, phase := range []func(context.Context, *v1.Revision) error{
 		c.reconcileDeployment,
+		c.reconcileReferences,
 		c.reconcileImageCache,
+		c.reconcilePDB,
+		c.reconcileNetworkPolicy,
+		c.reconcileHeadlessService,
 		c.reconcilePA,
 	} {
 		if err := phase(ctx, rev); err != nil {
@@ -175,14 +199,46 @@ func (c *Reconciler) ReconcileKind(ctx context.Context, rev *v1.Revision) pkgrec
 
 func (c *Reconciler) updateRevisionLoggingURL(ctx context.Context, rev *v1.Revision) {
 	config := config.FromContext(ctx)
-	if config.Observability.LoggingURLTemplate == "" {
+	template := config.Observability.LoggingURLTemplate
+	if t, ok := rev.Annotations[serving.LoggingURLTemplateAnnotation]; ok {
+		if config.Deployment.AllowedLoggingURLTemplates.Has(t) {
+			template = t
+		} else {
+			logging.FromContext(ctx).Warnf("Ignoring logging URL template %q, it's not allowed", t)
+		}
+	}
+	if template == "" {
 		rev.Status.LogURL = ""
 		return
 	}
 
-	rev.Status.LogURL = strings.ReplaceAll(
-		config.Observability.LoggingURLTemplate,
-		"${REVISION_UID}", string(rev.UID))
+	rev.Status.LogURL = makeLogURL(template, rev)
+}
+
+// makeLogURL substitutes the revision's variables in the given logging URL
+// template. Variables that can't be resolved are left as they are.
+func makeLogURL(template string, rev *v1.Revision) string {
+	vars := []string{
+		"${REVISION_UID}", string(rev.UID),
+		"${REVISION_NAMESPACE}", rev.Namespace,
+		"${REVISION_NAME}", rev.Name,
+	}
+	if cfg := configurationName(rev); cfg != "" {
+		vars = append(vars, "${CONFIGURATION_NAME}", cfg)
+	}
+	return strings.NewReplacer(vars...).Replace(template)
+}
+
+// configurationName returns the name of the revision's Configuration, taken
+// from its label or otherwise its controlling owner reference.
+func configurationName(rev *v1.Revision) string {
+	if name := rev.Labels[serving.ConfigurationLabelKey]; name != "" {
+		return name
+	}
+	if owner := metav1.GetControllerOf(rev); owner != nil && owner.Kind == "Configuration" {
+		return owner.Name
+	}
+	return ""
 }
 
 // ObserveDeletion implements OnDeletionInterface.ObserveDeletion.
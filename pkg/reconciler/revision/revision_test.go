@@ -30,11 +30,17 @@ import (
 	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
 	fakedeploymentinformer "knative.dev/pkg/client/injection/kube/informers/apps/v1/deployment/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/configmap/fake"
+	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/configmap/filtered/fake"
+	fakesecretinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/secret/filtered/fake"
 	_ "knative.dev/pkg/client/injection/kube/informers/core/v1/service/fake"
+	filteredinformerfactory "knative.dev/pkg/client/injection/kube/informers/factory/filtered"
+	_ "knative.dev/pkg/client/injection/kube/informers/factory/filtered/fake"
 	"knative.dev/pkg/ptr"
 	fakeservingclient "knative.dev/serving/pkg/client/injection/client/fake"
 	fakepainformer "knative.dev/serving/pkg/client/injection/informers/autoscaling/v1alpha1/podautoscaler/fake"
 	fakerevisioninformer "knative.dev/serving/pkg/client/injection/informers/serving/v1/revision/fake"
+	_ "knative.dev/serving/pkg/client/injection/kube/informers/networking/v1/networkpolicy/fake"
+	_ "knative.dev/serving/pkg/client/injection/kube/informers/policy/v1beta1/poddisruptionbudget/fake"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
@@ -84,7 +90,9 @@ func newTestController(t *testing.T, configs []*corev1.ConfigMap, opts ...reconc
 	*controller.Impl,
 	*configmap.ManualWatcher) {
 
-	ctx, cancel, informers := SetupFakeContextWithCancel(t)
+	ctx, cancel, informers := SetupFakeContextWithCancel(t, func(ctx context.Context) context.Context {
+		return filteredinformerfactory.WithSelectors(ctx, serving.RevisionReferenceLabelKey)
+	})
 	t.Cleanup(cancel) // cancel is reentrant, so if necessary callers can call it directly, if needed.
 	configMapWatcher := &configmap.ManualWatcher{Namespace: system.Namespace()}
 
@@ -305,8 +313,10 @@ func testDeploymentCM() *corev1.ConfigMap {
 			Namespace: system.Namespace(),
 		},
 		Data: map[string]string{
-			"queueSidecarImage": testQueueImage,
-			"autoscalerImage":   testAutoscalerImage,
+			"queueSidecarImage":          testQueueImage,
+			"autoscalerImage":            testAutoscalerImage,
+			"allowedTolerationKeys":      "dedicated",
+			"allowedLoggingURLTemplates": "http://team-logs.io/${REVISION_UID},http://team-logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}",
 		},
 	}
 }
@@ -425,6 +435,62 @@ func TestUpdateRevWithWithUpdatedLoggingURL(t *testing.T) {
 	}
 }
 
+func TestMakeLogURL(t *testing.T) {
+	const template = "http://logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}/${REVISION_UID}"
+
+	tests := []struct {
+		name string
+		rev  *v1.Revision
+		want string
+	}{{
+		name: "configuration label",
+		rev: &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "ns",
+				Name:      "rev",
+				UID:       "uid",
+				Labels: map[string]string{
+					serving.ConfigurationLabelKey: "cfg",
+				},
+			},
+		},
+		want: "http://logs.io/ns/cfg/rev/uid",
+	}, {
+		name: "configuration owner",
+		rev: &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "ns",
+				Name:      "rev",
+				UID:       "uid",
+				OwnerReferences: []metav1.OwnerReference{{
+					Kind:       "Configuration",
+					Name:       "owner",
+					Controller: ptr.Bool(true),
+				}},
+			},
+		},
+		want: "http://logs.io/ns/owner/rev/uid",
+	}, {
+		name: "no configuration",
+		rev: &v1.Revision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "ns",
+				Name:      "rev",
+				UID:       "uid",
+			},
+		},
+		want: "http://logs.io/ns/${CONFIGURATION_NAME}/rev/uid",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := makeLogURL(template, test.rev); got != test.want {
+				t.Errorf("makeLogURL() = %q, want: %q", got, test.want)
+			}
+		})
+	}
+}
+
 func TestStatusUnknownWhenDigestsNotResolvedYet(t *testing.T) {
 	ctx, _, _, controller, _ := newTestController(t, nil /*additional CMs*/, func(r *Reconciler) {
 		r.resolver = &notResolvedYetResolver{}
@@ -674,6 +740,45 @@ func TestGlobalResyncOnConfigMapUpdateDeployment(t *testing.T) {
 	}
 }
 
+func TestReferencesOnlyLabeledCached(t *testing.T) {
+	ctx, cancel, informers, _, _ := newTestController(t, nil /*additional CMs*/)
+
+	// Only the Secrets labeled for revisions to reference are cached.
+	for _, secret := range []*corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "labeled",
+			Labels:    map[string]string{serving.RevisionReferenceLabelKey: "true"},
+		},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "unlabeled",
+		},
+	}} {
+		if _, err := fakekubeclient.Get(ctx).CoreV1().Secrets(testNamespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			t.Fatal("Error creating secret:", err)
+		}
+	}
+
+	waitInformers, err := RunAndSyncInformers(ctx, informers...)
+	if err != nil {
+		t.Fatal("Error starting informers:", err)
+	}
+	defer func() {
+		cancel()
+		waitInformers()
+	}()
+
+	secretL := fakesecretinformer.Get(ctx, serving.RevisionReferenceLabelKey).Lister().Secrets(testNamespace)
+	if _, err := secretL.Get("labeled"); err != nil {
+		t.Error("Get(labeled) =", err)
+	}
+	if _, err := secretL.Get("unlabeled"); !apierrs.IsNotFound(err) {
+		t.Errorf("Get(unlabeled) = %v, want a NotFound error", err)
+	}
+}
+
 func TestNewRevisionCallsSyncHandler(t *testing.T) {
 	ctx, cancel, informers, ctrl, _ := newTestController(t, nil /*additional CMs*/)
 
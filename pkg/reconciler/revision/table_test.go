@@ -23,14 +23,20 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 	clientgotesting "k8s.io/client-go/testing"
 
 	caching "knative.dev/caching/pkg/apis/caching/v1alpha1"
 	cachingclient "knative.dev/caching/pkg/client/injection/client"
 	"knative.dev/networking/pkg/apis/networking"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
 	kubeclient "knative.dev/pkg/client/injection/kube/client"
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
@@ -38,8 +44,11 @@ import (
 	"knative.dev/pkg/metrics"
 	pkgreconciler "knative.dev/pkg/reconciler"
 	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/pkg/tracker"
+	"knative.dev/serving/pkg/apis/autoscaling"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
 	defaultconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 	"knative.dev/serving/pkg/autoscaler/config/autoscalerconfig"
 	servingclient "knative.dev/serving/pkg/client/injection/client"
@@ -92,9 +101,362 @@ func TestReconcile(t *testing.T) {
 			Object: Revision("foo", "first-reconcile",
 				// The first reconciliation Populates the following status properties.
 				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
-				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		Key: "foo/first-reconcile",
+	}, {
+		Name: "first revision reconciliation without image cache",
+		// Same as above, but with the creation of image caches disabled.
+		Ctx: configContext(func(cfg *config.Config) {
+			cfg.Deployment.DisableImageCache = true
+		}),
+		Objects: []runtime.Object{
+			Revision("foo", "first-reconcile-no-cache"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "first-reconcile-no-cache"),
+			deploy(t, "foo", "first-reconcile-no-cache"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "first-reconcile-no-cache",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/first-reconcile-no-cache",
+	}, {
+		Name: "first revision reconciliation with hpa class",
+		// The autoscaler class is carried over to the PodAutoscaler, so that
+		// the HPA reconciler picks it up instead of the KPA one.
+		Objects: []runtime.Object{
+			Revision("foo", "hpa-class", WithRevisionAnn(autoscaling.ClassAnnotationKey, autoscaling.HPA)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "hpa-class", WithHPAClass),
+			deploy(t, "foo", "hpa-class", WithRevisionAnn(autoscaling.ClassAnnotationKey, autoscaling.HPA)),
+			withAnnotation(image("foo", "hpa-class"), autoscaling.ClassAnnotationKey, autoscaling.HPA),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			// No concurrency target is reported, the HPA scales on its own metric.
+			Object: Revision("foo", "hpa-class", WithRevisionAnn(autoscaling.ClassAnnotationKey, autoscaling.HPA),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/hpa-class",
+	}, {
+		Name: "first revision reconciliation with kpa class",
+		Objects: []runtime.Object{
+			Revision("foo", "kpa-class", WithRevisionAnn(autoscaling.ClassAnnotationKey, autoscaling.KPA)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "kpa-class", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[autoscaling.ClassAnnotationKey] = autoscaling.KPA
+			}),
+			deploy(t, "foo", "kpa-class", WithRevisionAnn(autoscaling.ClassAnnotationKey, autoscaling.KPA)),
+			withAnnotation(image("foo", "kpa-class"), autoscaling.ClassAnnotationKey, autoscaling.KPA),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "kpa-class", WithRevisionAnn(autoscaling.ClassAnnotationKey, autoscaling.KPA),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/kpa-class",
+	}, {
+		Name: "create pod disruption budget for min scale",
+		// Revisions with a min scale greater than 1 get a PodDisruptionBudget
+		// letting only one of their pods be disrupted at a time.
+		Objects: []runtime.Object{
+			Revision("foo", "pdb-create", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "pdb-create", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[autoscaling.MinScaleAnnotationKey] = "3"
+			}),
+			deploy(t, "foo", "pdb-create", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+			pdb("foo", "pdb-create", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+			withAnnotation(image("foo", "pdb-create"), autoscaling.MinScaleAnnotationKey, "3"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "pdb-create", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, withMinReplicas(3),
+				WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/pdb-create",
+	}, {
+		Name: "no pod disruption budget for min scale 1",
+		// A budget for a single pod would block node drains, so none is created.
+		Objects: []runtime.Object{
+			Revision("foo", "pdb-skip", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "pdb-skip", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[autoscaling.MinScaleAnnotationKey] = "1"
+			}),
+			deploy(t, "foo", "pdb-skip", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1")),
+			withAnnotation(image("foo", "pdb-skip"), autoscaling.MinScaleAnnotationKey, "1"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "pdb-skip", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, withMinReplicas(1),
+				WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/pdb-skip",
+	}, {
+		Name: "mutated pod disruption budget gets fixed",
+		// The PodDisruptionBudget is updated if its spec drifted.
+		Objects: []runtime.Object{
+			Revision("foo", "pdb-drift", WithK8sServiceName, WithLogURL,
+				WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+			pa("foo", "pdb-drift", WithPASKSReady, WithTraffic, WithScaleTargetInitialized,
+				WithPAStatusService("pdb-drift"), func(pa *autoscalingv1alpha1.PodAutoscaler) {
+					pa.Annotations[autoscaling.MinScaleAnnotationKey] = "3"
+				}),
+			deploy(t, "foo", "pdb-drift", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+			withAnnotation(image("foo", "pdb-drift"), autoscaling.MinScaleAnnotationKey, "3"),
+			withMaxUnavailable(pdb("foo", "pdb-drift", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")), 2),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pdb("foo", "pdb-drift", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "pdb-drift", WithK8sServiceName, WithLogURL,
+				WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3"),
+				MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				withMinReplicas(3), WithRevisionObservedGeneration(1)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "RevisionReady", "Revision becomes ready upon all resources being ready"),
+		},
+		Key: "foo/pdb-drift",
+	}, {
+		Name: "pod disruption budget deleted once min scale lowered",
+		// The min scale dropped to 1, so the budget created before is removed.
+		Objects: []runtime.Object{
+			Revision("foo", "pdb-lowered", WithLogURL, allUnknownConditions,
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				withMinReplicas(1), WithRevisionObservedGeneration(1),
+				WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1")),
+			pa("foo", "pdb-lowered", WithReachabilityUnknown, func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[autoscaling.MinScaleAnnotationKey] = "1"
+			}),
+			deploy(t, "foo", "pdb-lowered", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1")),
+			withAnnotation(image("foo", "pdb-lowered"), autoscaling.MinScaleAnnotationKey, "1"),
+			pdb("foo", "pdb-lowered", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "3")),
+		},
+		WantDeletes: []clientgotesting.DeleteActionImpl{{
+			ActionImpl: clientgotesting.ActionImpl{
+				Namespace: "foo",
+				Verb:      "delete",
+				Resource:  policyv1beta1.SchemeGroupVersion.WithResource("poddisruptionbudgets"),
+			},
+			Name: "pdb-lowered-pdb",
+		}},
+		Key: "foo/pdb-lowered",
+	}, {
+		Name: "missing secret in the environment",
+		// A Secret the container takes its environment from doesn't exist,
+		// so its pods can't start. Surface that in the revision's status.
+		Objects: []runtime.Object{
+			Revision("foo", "missing-secret", withEnvFromSecret("db-creds", false)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "missing-secret", WithReachabilityUnreachable),
+			deploy(t, "foo", "missing-secret", withEnvFromSecret("db-creds", false)),
+			image("foo", "missing-secret"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "missing-secret", withEnvFromSecret("db-creds", false),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				MarkMissingConfiguration("Secret", "db-creds"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/missing-secret",
+	}, {
+		Name: "missing config map in the environment",
+		// Same as above, but for a single variable from a ConfigMap. The
+		// existing Secret is fine.
+		Objects: []runtime.Object{
+			Revision("foo", "missing-config-map", withEnvFromSecret("db-creds", false),
+				withEnvFromConfigMapKey("app-config", "level")),
+			secret("foo", "db-creds"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "missing-config-map", WithReachabilityUnreachable),
+			deploy(t, "foo", "missing-config-map", withEnvFromSecret("db-creds", false),
+				withEnvFromConfigMapKey("app-config", "level")),
+			image("foo", "missing-config-map"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "missing-config-map", withEnvFromSecret("db-creds", false),
+				withEnvFromConfigMapKey("app-config", "level"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				MarkMissingConfiguration("ConfigMap", "app-config"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/missing-config-map",
+	}, {
+		Name: "missing optional secret in the environment",
+		// Optional sources may be missing.
+		Objects: []runtime.Object{
+			Revision("foo", "missing-optional-secret", withEnvFromSecret("db-creds", true)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "missing-optional-secret"),
+			deploy(t, "foo", "missing-optional-secret", withEnvFromSecret("db-creds", true)),
+			image("foo", "missing-optional-secret"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "missing-optional-secret", withEnvFromSecret("db-creds", true),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/missing-optional-secret",
+	}, {
+		Name: "missing secret in the environment appeared",
+		// Once the missing Secret was created, the pods get a chance to start.
+		Objects: []runtime.Object{
+			Revision("foo", "appeared-secret", withEnvFromSecret("db-creds", false),
+				WithLogURL, allUnknownConditions, WithK8sServiceName,
+				MarkMissingConfiguration("Secret", "db-creds"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+			pa("foo", "appeared-secret", WithReachabilityUnknown),
+			deploy(t, "foo", "appeared-secret", withEnvFromSecret("db-creds", false)),
+			image("foo", "appeared-secret"),
+			secret("foo", "db-creds"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "appeared-secret", withEnvFromSecret("db-creds", false),
+				WithLogURL, allUnknownConditions, WithK8sServiceName,
+				MarkContainerHealthyUnknown(v1.ReasonDeploying),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/appeared-secret",
+	}, {
+		Name: "create network policy",
+		// With network policies enabled, the revision's pods are isolated.
+		Ctx: configContext(withNetworkPolicies),
+		Objects: []runtime.Object{
+			Revision("foo", "netpol-create"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "netpol-create"),
+			deploy(t, "foo", "netpol-create"),
+			networkPolicy("foo", "netpol-create"),
+			image("foo", "netpol-create"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "netpol-create",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/netpol-create",
+	}, {
+		Name: "mutated network policy gets fixed",
+		Ctx:  configContext(withNetworkPolicies),
+		Objects: []runtime.Object{
+			Revision("foo", "netpol-drift", WithLogURL, allUnknownConditions,
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
+			pa("foo", "netpol-drift", WithReachabilityUnknown),
+			deploy(t, "foo", "netpol-drift"),
+			image("foo", "netpol-drift"),
+			withoutIngressRules(networkPolicy("foo", "netpol-drift")),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: networkPolicy("foo", "netpol-drift"),
+		}},
+		Key: "foo/netpol-drift",
+	}, {
+		Name: "network policy deleted once disabled",
+		// Network policies are disabled by default, so the one created while
+		// they were enabled is removed.
+		Objects: []runtime.Object{
+			Revision("foo", "netpol-disabled", WithLogURL, allUnknownConditions,
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
+			pa("foo", "netpol-disabled", WithReachabilityUnknown),
+			deploy(t, "foo", "netpol-disabled"),
+			image("foo", "netpol-disabled"),
+			networkPolicy("foo", "netpol-disabled"),
+		},
+		WantDeletes: []clientgotesting.DeleteActionImpl{{
+			ActionImpl: clientgotesting.ActionImpl{
+				Namespace: "foo",
+				Verb:      "delete",
+				Resource:  networkingv1.SchemeGroupVersion.WithResource("networkpolicies"),
+			},
+			Name: "netpol-disabled-netpol",
+		}},
+		Key: "foo/netpol-disabled",
+	}, {
+		Name: "create headless service",
+		// With headless services enabled, the revision's pods get DNS records.
+		Ctx: configContext(withHeadlessServices),
+		Objects: []runtime.Object{
+			Revision("foo", "headless-create"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "headless-create"),
+			deploy(t, "foo", "headless-create"),
+			headlessService("foo", "headless-create"),
+			image("foo", "headless-create"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "headless-create",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/headless-create",
+	}, {
+		Name: "headless service not created when disabled",
+		// Headless services are disabled by default, so nothing is created
+		// besides the usual resources.
+		Objects: []runtime.Object{
+			Revision("foo", "headless-disabled", WithLogURL, allUnknownConditions,
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
+			pa("foo", "headless-disabled", WithReachabilityUnknown),
+			deploy(t, "foo", "headless-disabled"),
+			image("foo", "headless-disabled"),
+		},
+		Key: "foo/headless-disabled",
+	}, {
+		Name: "mutated headless service gets fixed",
+		Ctx:  configContext(withHeadlessServices),
+		Objects: []runtime.Object{
+			Revision("foo", "headless-drift", WithLogURL, allUnknownConditions,
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
+			pa("foo", "headless-drift", WithReachabilityUnknown),
+			deploy(t, "foo", "headless-drift"),
+			image("foo", "headless-drift"),
+			withoutSelector(withNotReadyAddresses(headlessService("foo", "headless-drift"))),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: headlessService("foo", "headless-drift"),
+		}},
+		Key: "foo/headless-drift",
+	}, {
+		Name: "headless service deleted once disabled",
+		Objects: []runtime.Object{
+			Revision("foo", "headless-off", WithLogURL, allUnknownConditions,
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
+			pa("foo", "headless-off", WithReachabilityUnknown),
+			deploy(t, "foo", "headless-off"),
+			image("foo", "headless-off"),
+			headlessService("foo", "headless-off"),
+		},
+		WantDeletes: []clientgotesting.DeleteActionImpl{{
+			ActionImpl: clientgotesting.ActionImpl{
+				Namespace: "foo",
+				Verb:      "delete",
+				Resource:  corev1.SchemeGroupVersion.WithResource("services"),
+			},
+			Name: "headless-off-headless",
+		}},
+		Key: "foo/headless-off",
 	}, {
 		Name: "failure updating revision status",
 		// This starts from the first reconciliation case above and induces a failure
@@ -116,7 +478,7 @@ func TestReconcile(t *testing.T) {
 			Object: Revision("foo", "update-status-failure",
 				// Despite failure, the following status properties are set.
 				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
-				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantEvents: []string{
 			Eventf(corev1.EventTypeWarning, "UpdateFailed", "Failed to update status for %q: %v",
@@ -144,7 +506,7 @@ func TestReconcile(t *testing.T) {
 			Object: Revision("foo", "create-pa-failure",
 				// Despite failure, the following status properties are set.
 				WithLogURL, WithInitRevConditions,
-				MarkDeploying("Deploying"), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				MarkDeploying("Deploying"), withDefaultContainerStatuses(), withQueueProxyImage, WithRevisionObservedGeneration(1)),
 		}},
 		WantEvents: []string{
 			Eventf(corev1.EventTypeWarning, "InternalError", `failed to create PA "create-pa-failure": inducing failure for create podautoscalers`),
@@ -185,7 +547,8 @@ func TestReconcile(t *testing.T) {
 		// are necessary.
 		Objects: []runtime.Object{
 			Revision("foo", "stable-reconcile", WithLogURL, allUnknownConditions,
-				WithK8sServiceName, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				WithK8sServiceName, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
 			pa("foo", "stable-reconcile", WithReachabilityUnknown),
 
 			deploy(t, "foo", "stable-reconcile"),
@@ -199,7 +562,8 @@ func TestReconcile(t *testing.T) {
 		// with our desired spec.
 		Objects: []runtime.Object{
 			Revision("foo", "fix-containers", WithK8sServiceName,
-				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				WithLogURL, allUnknownConditions, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
+				WithRevisionObservedGeneration(1)),
 			pa("foo", "fix-containers", WithReachabilityUnknown),
 			changeContainers(deploy(t, "foo", "fix-containers")),
 			image("foo", "fix-containers"),
@@ -240,7 +604,7 @@ func TestReconcile(t *testing.T) {
 			Revision("foo", "stable-deactivation",
 				WithLogURL, MarkRevisionReady, WithK8sServiceName,
 				MarkInactive("NoTraffic", "This thing is inactive."),
-				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 			pa("foo", "stable-deactivation",
 				WithNoTraffic("NoTraffic", "This thing is inactive."), WithReachabilityUnreachable,
 				WithScaleTargetInitialized),
@@ -263,12 +627,38 @@ func TestReconcile(t *testing.T) {
 				WithLogURL,
 				// When the endpoint and pa are ready, then we will see the
 				// Revision become ready.
-				MarkRevisionReady, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantEvents: []string{
 			Eventf(corev1.EventTypeNormal, "RevisionReady", "Revision becomes ready upon all resources being ready"),
 		},
 		Key: "foo/pa-ready",
+	}, {
+		Name: "pa is ready with min scale replicas",
+		// The replicas the PA asks for, e.g. to keep min scale pods warm,
+		// are reflected in the revision's status.
+		Objects: []runtime.Object{
+			Revision("foo", "pa-ready-scale",
+				WithK8sServiceName, WithLogURL, allUnknownConditions,
+				WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1")),
+			pa("foo", "pa-ready-scale", WithPASKSReady, WithTraffic, WithPAScale(2, 1),
+				WithScaleTargetInitialized, WithPAStatusService("new-stuff"), WithReachabilityUnknown,
+				func(pa *autoscalingv1alpha1.PodAutoscaler) {
+					pa.Annotations[autoscaling.MinScaleAnnotationKey] = "1"
+				}),
+			deploy(t, "foo", "pa-ready-scale", WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1")),
+			withAnnotation(image("foo", "pa-ready-scale"), autoscaling.MinScaleAnnotationKey, "1"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "pa-ready-scale", WithK8sServiceName,
+				WithLogURL, WithRevisionAnn(autoscaling.MinScaleAnnotationKey, "1"),
+				MarkRevisionReady, WithRevisionReplicas(2, 1), withDefaultContainerStatuses(),
+				withQueueProxyImage, withCurrentTarget, withMinReplicas(1), WithRevisionObservedGeneration(1)),
+		}},
+		WantEvents: []string{
+			Eventf(corev1.EventTypeNormal, "RevisionReady", "Revision becomes ready upon all resources being ready"),
+		},
+		Key: "foo/pa-ready-scale",
 	}, {
 		Name: "pa not ready",
 		// Test propagating the pa not ready status to the Revision.
@@ -285,7 +675,7 @@ func TestReconcile(t *testing.T) {
 		},
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "pa-not-ready",
-				WithLogURL, MarkRevisionReady, withDefaultContainerStatuses(),
+				WithLogURL, MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
 				WithK8sServiceName,
 				// When we reconcile a ready state and our pa is in an activating
 				// state, we should see the following mutation.
@@ -310,7 +700,7 @@ func TestReconcile(t *testing.T) {
 		},
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "pa-inactive",
-				WithLogURL, MarkRevisionReady, withDefaultContainerStatuses(),
+				WithLogURL, MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
 				WithK8sServiceName,
 				// When we reconcile an "all ready" revision when the PA
 				// is inactive, we should see the following change.
@@ -332,7 +722,7 @@ func TestReconcile(t *testing.T) {
 		},
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "pa-inactive",
-				WithLogURL, withDefaultContainerStatuses(), MarkDeploying(""),
+				WithLogURL, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, MarkDeploying(""),
 				// When we reconcile an "all ready" revision when the PA
 				// is inactive, we should see the following change.
 				MarkInactive("NoTraffic", "This thing is inactive."), WithRevisionObservedGeneration(1),
@@ -354,7 +744,7 @@ func TestReconcile(t *testing.T) {
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			// We should not mark resources unavailable if ServiceName is empty
 			Object: Revision("foo", "pa-inactive",
-				WithLogURL, withDefaultContainerStatuses(), allUnknownConditions,
+				WithLogURL, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, allUnknownConditions,
 				WithK8sServiceName, MarkInactive("NoTraffic", "This thing is inactive."),
 				WithRevisionObservedGeneration(1)),
 		}},
@@ -381,7 +771,7 @@ func TestReconcile(t *testing.T) {
 				// When we reconcile an "all ready" revision when the PA
 				// is inactive, we should see the following change.
 				MarkInactive("NoTraffic", "This thing is inactive."),
-				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		Key: "foo/pa-inactive",
 	}, {
@@ -406,7 +796,7 @@ func TestReconcile(t *testing.T) {
 				// we should see the following mutations to status.
 				WithK8sServiceName,
 				WithRoutingState(v1.RoutingStateActive, fc), WithLogURL, MarkRevisionReady,
-				withDefaultContainerStatuses()),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget),
 		}},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: pa("foo", "fix-mutated-pa", WithPASKSReady,
@@ -420,7 +810,7 @@ func TestReconcile(t *testing.T) {
 		Objects: []runtime.Object{
 			Revision("foo", "fix-mutated-pa-fail",
 				WithK8sServiceName, WithLogURL, allUnknownConditions,
-				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 			pa("foo", "fix-mutated-pa-fail", WithProtocolType(networking.ProtocolH2C), WithReachabilityUnknown),
 			deploy(t, "foo", "fix-mutated-pa-fail"),
 			image("foo", "fix-mutated-pa-fail"),
@@ -455,7 +845,7 @@ func TestReconcile(t *testing.T) {
 				WithLogURL, allUnknownConditions, WithK8sServiceName,
 				// When the revision is reconciled after a Deployment has
 				// timed out, we should see it marked with the PDE state.
-				MarkProgressDeadlineExceeded("I timed out!"), withDefaultContainerStatuses(),
+				MarkProgressDeadlineExceeded("I timed out!"), withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget,
 				WithRevisionObservedGeneration(1)),
 		}},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
@@ -481,7 +871,7 @@ func TestReconcile(t *testing.T) {
 				// When the revision is reconciled after a Deployment has
 				// timed out, we should see it marked with the FailedCreate state.
 				MarkResourcesUnavailable("FailedCreate", "I replica failed!"),
-				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: pa("foo", "deploy-replica-failure", WithReachabilityUnreachable),
@@ -501,12 +891,77 @@ func TestReconcile(t *testing.T) {
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "pull-backoff",
 				WithLogURL, allUnknownConditions, WithK8sServiceName,
-				MarkResourcesUnavailable("ImagePullBackoff", "can't pull it"), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				MarkResourcesUnavailable("ImagePullBackoff", "can't pull it"), withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: pa("foo", "pull-backoff", WithReachabilityUnreachable),
 		}},
 		Key: "foo/pull-backoff",
+	}, {
+		Name: "surface ImagePullBackOff without deployment timeout",
+		// Test that image pull failures of the user container are surfaced
+		// right away, without waiting for the deployment to time out.
+		Objects: []runtime.Object{
+			Revision("foo", "image-pull-backoff",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "image-pull-backoff"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "image-pull-backoff", WithWaitingContainer("image-pull-backoff", "ImagePullBackOff", "manifest unknown")),
+			deploy(t, "foo", "image-pull-backoff"),
+			image("foo", "image-pull-backoff"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "image-pull-backoff", WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkImagePullBackOff("busybox", "manifest unknown"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "image-pull-backoff", WithReachabilityUnreachable),
+		}},
+		Key: "foo/image-pull-backoff",
+	}, {
+		Name: "surface ErrImagePull without deployment timeout",
+		// Test that image pull failures of the user container are surfaced
+		// right away, without waiting for the deployment to time out.
+		Objects: []runtime.Object{
+			Revision("foo", "err-image-pull",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "err-image-pull"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "err-image-pull", WithWaitingContainer("err-image-pull", "ErrImagePull", "manifest unknown")),
+			deploy(t, "foo", "err-image-pull"),
+			image("foo", "err-image-pull"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "err-image-pull", WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkImagePullBackOff("busybox", "manifest unknown"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "err-image-pull", WithReachabilityUnreachable),
+		}},
+		Key: "foo/err-image-pull",
+	}, {
+		Name: "surface sidecars not becoming ready",
+		// Test that a sidecar whose postStart hook gave up waiting for its
+		// readiness probe is surfaced, as the serving container never starts.
+		Objects: []runtime.Object{
+			Revision("foo", "sidecar-not-ready",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "sidecar-not-ready"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "sidecar-not-ready", WithWaitingContainer("sidecar-not-ready", "PostStartHookError",
+				"command '/knative-sidecar-gate/queue' exited with 1: sidecar did not become ready")),
+			deploy(t, "foo", "sidecar-not-ready"),
+			image("foo", "sidecar-not-ready"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "sidecar-not-ready", WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkSidecarNotReady("sidecar-not-ready",
+					"command '/knative-sidecar-gate/queue' exited with 1: sidecar did not become ready"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "sidecar-not-ready", WithReachabilityUnreachable),
+		}},
+		Key: "foo/sidecar-not-ready",
 	}, {
 		Name: "surface pod errors",
 		// Test the propagation of the termination state of a Pod into the revision.
@@ -524,12 +979,83 @@ func TestReconcile(t *testing.T) {
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "pod-error", WithK8sServiceName,
 				WithLogURL, allUnknownConditions, MarkContainerExiting(5,
-					v1.RevisionContainerExitingMessage("I failed man!")), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+					v1.RevisionContainerExitingMessage("I failed man!")), withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: pa("foo", "pod-error", WithReachabilityUnreachable),
 		}},
 		Key: "foo/pod-error",
+	}, {
+		Name: "surface liveness probe restart loop",
+		// A container with a liveness probe was restarted more often than
+		// allowed, so the revision is marked as being in a restart loop.
+		Ctx: configContext(func(cfg *config.Config) {
+			cfg.Deployment.LivenessProbeMaxRestarts = 3
+		}),
+		Objects: []runtime.Object{
+			Revision("foo", "restart-loop", withLivenessProbe(),
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "restart-loop"),
+			pod(t, "foo", "restart-loop", WithRestartingContainer("restart-loop", 4)),
+			deploy(t, "foo", "restart-loop", withLivenessProbe()),
+			image("foo", "restart-loop"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "restart-loop", withLivenessProbe(), WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkRestartLoop("restart-loop", 4),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "restart-loop", WithReachabilityUnreachable),
+		}},
+		Key: "foo/restart-loop",
+	}, {
+		Name: "liveness probe restarts within the max",
+		// Up to the max, restarts are surfaced by the container's exit code.
+		Ctx: configContext(func(cfg *config.Config) {
+			cfg.Deployment.LivenessProbeMaxRestarts = 3
+		}),
+		Objects: []runtime.Object{
+			Revision("foo", "few-restarts", withLivenessProbe(),
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "few-restarts"),
+			pod(t, "foo", "few-restarts", WithRestartingContainer("few-restarts", 3)),
+			deploy(t, "foo", "few-restarts", withLivenessProbe()),
+			image("foo", "few-restarts"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "few-restarts", withLivenessProbe(), WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkContainerExiting(137, v1.RevisionContainerExitingMessage("")),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "few-restarts", WithReachabilityUnreachable),
+		}},
+		Key: "foo/few-restarts",
+	}, {
+		Name: "surface sidecar pod errors",
+		// Test that the termination state of a sidecar container is propagated
+		// into the revision, just like the serving container's.
+		Objects: []runtime.Object{
+			Revision("foo", "sidecar-error",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive, withSidecar(),
+				withDefaultContainerStatuses(), withSidecarContainerStatus()),
+			pa("foo", "sidecar-error"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "sidecar-error", WithFailingContainer("sidecar", 5, "I failed man!")),
+			deploy(t, "foo", "sidecar-error", withSidecar()),
+			image("foo", "sidecar-error"),
+			sidecarImage("foo", "sidecar-error"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "sidecar-error", WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkContainerExiting(5,
+					v1.RevisionContainerExitingMessage("I failed man!")), withSidecar(),
+				withDefaultContainerStatuses(), withSidecarContainerStatus(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "sidecar-error", WithReachabilityUnreachable),
+		}},
+		Key: "foo/sidecar-error",
 	}, {
 		Name: "surface pod schedule errors",
 		// Test the propagation of the scheduling errors of Pod into the revision.
@@ -546,12 +1072,79 @@ func TestReconcile(t *testing.T) {
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "pod-schedule-error", WithK8sServiceName,
 				WithLogURL, allUnknownConditions, MarkResourcesUnavailable("Insufficient energy",
-					"Unschedulable"), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+					"Unschedulable"), withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: pa("foo", "pod-schedule-error", WithReachabilityUnreachable),
 		}},
 		Key: "foo/pod-schedule-error",
+	}, {
+		Name: "surface readiness probe failures",
+		// Test the propagation of a readiness probe that keeps failing into the
+		// revision, even though the deployment has not timed out yet.
+		Objects: []runtime.Object{
+			Revision("foo", "probe-failure",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "probe-failure"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "probe-failure", WithUnreadyContainer(resources.QueueContainerName,
+				time.Now().Add(-time.Hour), "containers with unready status: [queue-proxy]")),
+			deploy(t, "foo", "probe-failure"),
+			image("foo", "probe-failure"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "probe-failure", WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkContainerProbeFailed("containers with unready status: [queue-proxy]"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "probe-failure", WithReachabilityUnreachable),
+		}},
+		Key: "foo/probe-failure",
+	}, {
+		Name: "readiness probe still within its window",
+		// Test that a freshly started pod that isn't ready yet is not reported
+		// as failing its readiness probe.
+		Objects: []runtime.Object{
+			Revision("foo", "probe-pending",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "probe-pending"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "probe-pending", WithUnreadyContainer(resources.QueueContainerName,
+				time.Now(), "containers with unready status: [queue-proxy]")),
+			deploy(t, "foo", "probe-pending"),
+			image("foo", "probe-pending"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "probe-pending", WithK8sServiceName,
+				WithLogURL, allUnknownConditions,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "probe-pending", WithReachabilityUnreachable),
+		}},
+		Key: "foo/probe-pending",
+	}, {
+		Name: "slow starter not reported as failing its readiness probe",
+		// Test that a pod that is still within its startup probe is not
+		// reported as failing its readiness probe, no matter how long it has
+		// been running. The progress deadline covers that case.
+		Objects: []runtime.Object{
+			Revision("foo", "slow-starter",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "slow-starter"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "slow-starter", WithStartingContainer(resources.QueueContainerName,
+				time.Now().Add(-30*time.Second), "containers with unready status: [queue-proxy]")),
+			deploy(t, "foo", "slow-starter"),
+			image("foo", "slow-starter"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "slow-starter", WithK8sServiceName,
+				WithLogURL, allUnknownConditions,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "slow-starter", WithReachabilityUnreachable),
+		}},
+		Key: "foo/slow-starter",
 	}, {
 		Name: "ready steady state",
 		// Test the transition that Reconcile makes when Endpoints become ready on the
@@ -570,7 +1163,7 @@ func TestReconcile(t *testing.T) {
 			Object: Revision("foo", "steady-ready", WithK8sServiceName, WithLogURL,
 				// All resources are ready to go, we should see the revision being
 				// marked ready
-				MarkRevisionReady, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		WantEvents: []string{
 			Eventf(corev1.EventTypeNormal, "RevisionReady", "Revision becomes ready upon all resources being ready"),
@@ -590,7 +1183,7 @@ func TestReconcile(t *testing.T) {
 			Object: Revision("foo", "missing-owners", WithK8sServiceName, WithLogURL,
 				MarkRevisionReady,
 				// When we're missing the OwnerRef for PodAutoscaler we see this update.
-				MarkResourceNotOwned("PodAutoscaler", "missing-owners"), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				MarkResourceNotOwned("PodAutoscaler", "missing-owners"), withDefaultContainerStatuses(), withQueueProxyImage, WithRevisionObservedGeneration(1)),
 		}},
 		WantEvents: []string{
 			Eventf(corev1.EventTypeWarning, "InternalError", `revision: "missing-owners" does not own PodAutoscaler: "missing-owners"`),
@@ -621,6 +1214,7 @@ func TestReconcile(t *testing.T) {
 		// This test case tests that the image pull secrets from revision propagate to deployment and image
 		Objects: []runtime.Object{
 			Revision("foo", "image-pull-secrets", WithImagePullSecrets("foo-secret"), WithK8sServiceName),
+			secret("foo", "foo-secret"),
 		},
 		WantCreates: []runtime.Object{
 			pa("foo", "image-pull-secrets"),
@@ -630,9 +1224,510 @@ func TestReconcile(t *testing.T) {
 		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
 			Object: Revision("foo", "image-pull-secrets",
 				WithImagePullSecrets("foo-secret"), WithK8sServiceName,
-				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
 		}},
 		Key: "foo/image-pull-secrets",
+	}, {
+		Name: "missing image pull secret",
+		// The images of the revision can't be pulled without the secret, so
+		// its pods can't start. Surface that in the revision's status.
+		Objects: []runtime.Object{
+			Revision("foo", "missing-pull-secret", WithImagePullSecrets("foo-secret"), WithK8sServiceName),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "missing-pull-secret", WithReachabilityUnreachable),
+			deployImagePullSecrets(deploy(t, "foo", "missing-pull-secret"), "foo-secret"),
+			imagePullSecrets(image("foo", "missing-pull-secret"), "foo-secret"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "missing-pull-secret",
+				WithImagePullSecrets("foo-secret"), WithK8sServiceName,
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), MarkMissingPullSecret("foo-secret"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/missing-pull-secret",
+	}, {
+		Name: "missing image pull secret appeared",
+		// Once the missing pull secret was created, the pods get a chance to start.
+		Objects: []runtime.Object{
+			Revision("foo", "appeared-pull-secret", WithImagePullSecrets("foo-secret"),
+				WithLogURL, allUnknownConditions, WithK8sServiceName, MarkMissingPullSecret("foo-secret"),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+			pa("foo", "appeared-pull-secret", WithReachabilityUnknown),
+			deployImagePullSecrets(deploy(t, "foo", "appeared-pull-secret"), "foo-secret"),
+			imagePullSecrets(image("foo", "appeared-pull-secret"), "foo-secret"),
+			secret("foo", "foo-secret"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "appeared-pull-secret", WithImagePullSecrets("foo-secret"),
+				WithLogURL, allUnknownConditions, WithK8sServiceName,
+				MarkContainerHealthyUnknown(v1.ReasonDeploying),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/appeared-pull-secret",
+	}, {
+		Name: "tolerations",
+		// Test that allowed tolerations on the revision propagate to the deployment.
+		Ctx: tolerationsEnabledContext(),
+		Objects: []runtime.Object{
+			Revision("foo", "tolerations", WithTolerations(dedicatedToleration)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "tolerations"),
+			deploy(t, "foo", "tolerations", WithTolerations(dedicatedToleration)),
+			image("foo", "tolerations"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "tolerations",
+				WithTolerations(dedicatedToleration), WithLogURL, allUnknownConditions,
+				MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/tolerations",
+	}, {
+		Name: "disallowed toleration key",
+		// Test that tolerations for taint keys outside of the operator's
+		// allow-list are surfaced in the status, no deployment is created and
+		// the revision isn't retried.
+		Ctx: tolerationsEnabledContext(),
+		Objects: []runtime.Object{
+			Revision("foo", "bad-tolerations", WithTolerations(corev1.Toleration{
+				Key:      "nvidia.com/gpu",
+				Operator: corev1.TolerationOpExists,
+			})),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "bad-tolerations",
+				WithTolerations(corev1.Toleration{
+					Key:      "nvidia.com/gpu",
+					Operator: corev1.TolerationOpExists,
+				}),
+				WithLogURL, WithInitRevConditions,
+				MarkResourcesUnavailable(v1.ReasonTolerationNotAllowed,
+					`toleration for taint key "nvidia.com/gpu" is not allowed`),
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/bad-tolerations",
+	}, {
+		Name: "scale to zero disabled",
+		// Test that opting out of scale to zero results in a PA with a floor of
+		// one replica, and that the floor is surfaced in the revision's status.
+		Objects: []runtime.Object{
+			Revision("foo", "no-scale-to-zero",
+				WithRevisionAnn(autoscaling.ScaleToZeroAnnotationKey, "false")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "no-scale-to-zero", WithLowerScaleBound(1),
+				func(pa *autoscalingv1alpha1.PodAutoscaler) {
+					pa.Annotations[autoscaling.ScaleToZeroAnnotationKey] = "false"
+				}),
+			deploy(t, "foo", "no-scale-to-zero",
+				WithRevisionAnn(autoscaling.ScaleToZeroAnnotationKey, "false")),
+			withAnnotation(image("foo", "no-scale-to-zero"),
+				autoscaling.ScaleToZeroAnnotationKey, "false"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "no-scale-to-zero",
+				WithRevisionAnn(autoscaling.ScaleToZeroAnnotationKey, "false"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, withMinReplicas(1),
+				WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/no-scale-to-zero",
+	}, {
+		Name: "topology key",
+		// Test that the revision's topology key ends up in the spread constraint
+		// of the deployment.
+		Objects: []runtime.Object{
+			Revision("foo", "spread",
+				WithRevisionAnn(serving.TopologyKeyAnnotation, "kubernetes.io/hostname")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "spread", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.TopologyKeyAnnotation] = "kubernetes.io/hostname"
+			}),
+			withTopologySpread(deploy(t, "foo", "spread",
+				WithRevisionAnn(serving.TopologyKeyAnnotation, "kubernetes.io/hostname")),
+				"kubernetes.io/hostname"),
+			withAnnotation(image("foo", "spread"),
+				serving.TopologyKeyAnnotation, "kubernetes.io/hostname"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "spread",
+				WithRevisionAnn(serving.TopologyKeyAnnotation, "kubernetes.io/hostname"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/spread",
+	}, {
+		Name: "default topology key",
+		// Test that revisions without a topology key of their own are spread
+		// across the cluster-wide default.
+		Ctx: configContext(func(cfg *config.Config) {
+			cfg.Deployment.DefaultTopologyKey = "topology.kubernetes.io/zone"
+		}),
+		Objects: []runtime.Object{
+			Revision("foo", "default-spread"),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "default-spread"),
+			withTopologySpread(deploy(t, "foo", "default-spread"), "topology.kubernetes.io/zone"),
+			image("foo", "default-spread"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "default-spread",
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/default-spread",
+	}, {
+		Name: "prestop hook",
+		// Test that the revision's preStop hook is handed to the queue-proxy,
+		// which runs it once it drained.
+		Objects: []runtime.Object{
+			Revision("foo", "prestop",
+				WithRevisionAnn(serving.PreStopHookAnnotation, `{"httpGet":{"path":"/drain"}}`)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "prestop", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.PreStopHookAnnotation] = `{"httpGet":{"path":"/drain"}}`
+			}),
+			deploy(t, "foo", "prestop",
+				WithRevisionAnn(serving.PreStopHookAnnotation, `{"httpGet":{"path":"/drain"}}`)),
+			withAnnotation(image("foo", "prestop"),
+				serving.PreStopHookAnnotation, `{"httpGet":{"path":"/drain"}}`),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "prestop",
+				WithRevisionAnn(serving.PreStopHookAnnotation, `{"httpGet":{"path":"/drain"}}`),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/prestop",
+	}, {
+		Name: "image cache failed",
+		// Test that a failing caching.Image is surfaced on the revision without
+		// affecting its readiness.
+		Objects: []runtime.Object{
+			Revision("foo", "bad-cache", WithK8sServiceName, WithLogURL,
+				MarkRevisionReady, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+			pa("foo", "bad-cache", WithPASKSReady, WithTraffic,
+				WithScaleTargetInitialized, WithPAStatusService("bad-cache"), WithReachabilityUnreachable),
+			readyDeploy(deploy(t, "foo", "bad-cache")),
+			withImageFailed(image("foo", "bad-cache"), "PullFailed", "no such image"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "bad-cache", WithK8sServiceName, WithLogURL,
+				MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1),
+				MarkImageNotCached("PullFailed",
+					`Image cache "bad-cache-cache-bad-cache" failed: no such image`)),
+		}},
+		Key: "foo/bad-cache",
+	}, {
+		Name: "image cache recovered",
+		// Test that the condition becomes true once the caching.Image recovers.
+		Objects: []runtime.Object{
+			Revision("foo", "fixed-cache", WithK8sServiceName, WithLogURL,
+				MarkRevisionReady, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1),
+				MarkImageNotCached("PullFailed", "no such image")),
+			pa("foo", "fixed-cache", WithPASKSReady, WithTraffic,
+				WithScaleTargetInitialized, WithPAStatusService("fixed-cache"), WithReachabilityUnreachable),
+			readyDeploy(deploy(t, "foo", "fixed-cache")),
+			withImageReady(image("foo", "fixed-cache")),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "fixed-cache", WithK8sServiceName, WithLogURL,
+				MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1),
+				MarkImageCached),
+		}},
+		Key: "foo/fixed-cache",
+	}, {
+		Name: "stale image cache",
+		// Test that a caching.Image that doesn't match the revision's resolved
+		// digest anymore, e.g. after a retag, is updated.
+		Objects: []runtime.Object{
+			Revision("foo", "stale-cache", WithK8sServiceName, WithLogURL,
+				MarkRevisionReady, withDefaultContainerStatuses(), WithRevisionObservedGeneration(1)),
+			pa("foo", "stale-cache", WithPASKSReady, WithTraffic,
+				WithScaleTargetInitialized, WithPAStatusService("stale-cache"), WithReachabilityUnreachable),
+			readyDeploy(deploy(t, "foo", "stale-cache")),
+			withImageDigest(image("foo", "stale-cache"), "busybox@sha256:deadbeef"),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: image("foo", "stale-cache"),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "stale-cache", WithK8sServiceName, WithLogURL,
+				MarkRevisionReady, withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/stale-cache",
+	}, {
+		Name: "queue-proxy readiness thresholds",
+		// Test that the readiness annotations end up on the queue-proxy's
+		// readiness probe.
+		Objects: []runtime.Object{
+			Revision("foo", "tuned-readiness",
+				WithRevisionAnn(serving.QueueSideCarReadinessFailureThresholdAnnotation, "5"),
+				WithRevisionAnn(serving.QueueSideCarReadinessPeriodSecondsAnnotation, "10")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "tuned-readiness", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.QueueSideCarReadinessFailureThresholdAnnotation] = "5"
+				pa.Annotations[serving.QueueSideCarReadinessPeriodSecondsAnnotation] = "10"
+			}),
+			withQueueReadiness(deploy(t, "foo", "tuned-readiness",
+				WithRevisionAnn(serving.QueueSideCarReadinessFailureThresholdAnnotation, "5"),
+				WithRevisionAnn(serving.QueueSideCarReadinessPeriodSecondsAnnotation, "10")), 5, 10),
+			withAnnotation(withAnnotation(image("foo", "tuned-readiness"),
+				serving.QueueSideCarReadinessFailureThresholdAnnotation, "5"),
+				serving.QueueSideCarReadinessPeriodSecondsAnnotation, "10"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "tuned-readiness",
+				WithRevisionAnn(serving.QueueSideCarReadinessFailureThresholdAnnotation, "5"),
+				WithRevisionAnn(serving.QueueSideCarReadinessPeriodSecondsAnnotation, "10"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/tuned-readiness",
+	}, {
+		Name: "rps metric",
+		// Test that the revision's scaling metric is handed to the KPA.
+		Objects: []runtime.Object{
+			Revision("foo", "rps",
+				WithRevisionAnn(autoscaling.MetricAnnotationKey, autoscaling.RPS)),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "rps", WithMetricAnnotation(autoscaling.RPS)),
+			deploy(t, "foo", "rps",
+				WithRevisionAnn(autoscaling.MetricAnnotationKey, autoscaling.RPS)),
+			withAnnotation(image("foo", "rps"),
+				autoscaling.MetricAnnotationKey, autoscaling.RPS),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "rps",
+				WithRevisionAnn(autoscaling.MetricAnnotationKey, autoscaling.RPS),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, WithRevisionObservedGeneration(1),
+				func(r *v1.Revision) { r.Status.CurrentTarget = "140" }),
+		}},
+		Key: "foo/rps",
+	}, {
+		Name: "target annotation",
+		// Test that the target resolved from the revision's annotation is
+		// surfaced in the revision's status.
+		Objects: []runtime.Object{
+			Revision("foo", "target",
+				WithRevisionAnn(autoscaling.TargetAnnotationKey, "50")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "target", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[autoscaling.TargetAnnotationKey] = "50"
+			}),
+			deploy(t, "foo", "target",
+				WithRevisionAnn(autoscaling.TargetAnnotationKey, "50")),
+			withAnnotation(image("foo", "target"),
+				autoscaling.TargetAnnotationKey, "50"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "target",
+				WithRevisionAnn(autoscaling.TargetAnnotationKey, "50"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, WithRevisionObservedGeneration(1),
+				func(r *v1.Revision) { r.Status.CurrentTarget = "35" }),
+		}},
+		Key: "foo/target",
+	}, {
+		Name: "scale down delay",
+		// Test that the revision's scale down delay is handed to the KPA and
+		// surfaced in the revision's status.
+		Objects: []runtime.Object{
+			Revision("foo", "delay",
+				WithRevisionAnn(autoscaling.ScaleDownDelayAnnotationKey, "1m")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "delay", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[autoscaling.ScaleDownDelayAnnotationKey] = "1m"
+			}),
+			deploy(t, "foo", "delay",
+				WithRevisionAnn(autoscaling.ScaleDownDelayAnnotationKey, "1m")),
+			withAnnotation(image("foo", "delay"),
+				autoscaling.ScaleDownDelayAnnotationKey, "1m"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "delay",
+				WithRevisionAnn(autoscaling.ScaleDownDelayAnnotationKey, "1m"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1),
+				func(r *v1.Revision) { r.Status.ScaleDownDelay = "1m0s" }),
+		}},
+		Key: "foo/delay",
+	}, {
+		Name: "logging url override",
+		// Test that an allowed logging URL template of the revision is used for
+		// its LogURL.
+		Objects: []runtime.Object{
+			Revision("foo", "log-override",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_UID}")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "log-override", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.LoggingURLTemplateAnnotation] = "http://team-logs.io/${REVISION_UID}"
+			}),
+			deploy(t, "foo", "log-override",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_UID}")),
+			withAnnotation(image("foo", "log-override"),
+				serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_UID}"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "log-override",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_UID}"),
+				func(r *v1.Revision) { r.Status.LogURL = "http://team-logs.io/test-uid" }, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/log-override",
+	}, {
+		Name: "logging url variables",
+		// Test that the revision's variables are substituted in its LogURL,
+		// leaving the ones that can't be resolved as they are.
+		Objects: []runtime.Object{
+			Revision("foo", "log-vars",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "log-vars", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.LoggingURLTemplateAnnotation] = "http://team-logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}"
+			}),
+			deploy(t, "foo", "log-vars",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}")),
+			withAnnotation(image("foo", "log-vars"),
+				serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "log-vars",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://team-logs.io/${REVISION_NAMESPACE}/${CONFIGURATION_NAME}/${REVISION_NAME}"),
+				func(r *v1.Revision) { r.Status.LogURL = "http://team-logs.io/foo/${CONFIGURATION_NAME}/log-vars" }, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/log-vars",
+	}, {
+		Name: "logging url override not allowed",
+		// Test that a logging URL template which isn't allowed is ignored in
+		// favor of the cluster-wide one.
+		Objects: []runtime.Object{
+			Revision("foo", "log-override-denied",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://evil.io/${REVISION_UID}")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "log-override-denied", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.LoggingURLTemplateAnnotation] = "http://evil.io/${REVISION_UID}"
+			}),
+			deploy(t, "foo", "log-override-denied",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://evil.io/${REVISION_UID}")),
+			withAnnotation(image("foo", "log-override-denied"),
+				serving.LoggingURLTemplateAnnotation, "http://evil.io/${REVISION_UID}"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "log-override-denied",
+				WithRevisionAnn(serving.LoggingURLTemplateAnnotation, "http://evil.io/${REVISION_UID}"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/log-override-denied",
+	}, {
+		Name: "queue-proxy image upgrade",
+		// Test that the revision reports the new queue-proxy image once its
+		// deployment was updated after a controller upgrade.
+		Objects: []runtime.Object{
+			Revision("foo", "qp-upgrade", WithK8sServiceName, WithLogURL, allUnknownConditions,
+				withDefaultContainerStatuses(), WithRevisionObservedGeneration(1),
+				func(r *v1.Revision) { r.Status.QueueProxyImage = "old-queue" }),
+			pa("foo", "qp-upgrade", WithReachabilityUnknown),
+			withOldQueueProxy(deploy(t, "foo", "qp-upgrade")),
+			image("foo", "qp-upgrade"),
+		},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: deploy(t, "foo", "qp-upgrade"),
+		}},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "qp-upgrade", WithK8sServiceName, WithLogURL, allUnknownConditions,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/qp-upgrade",
+	}, {
+		Name: "max request body size",
+		// Test that the max request body size is handed to the queue-proxy.
+		Objects: []runtime.Object{
+			Revision("foo", "max-body",
+				WithRevisionAnn(serving.QueueSideCarMaxRequestBodySizeAnnotation, "10Mi")),
+		},
+		WantCreates: []runtime.Object{
+			pa("foo", "max-body", func(pa *autoscalingv1alpha1.PodAutoscaler) {
+				pa.Annotations[serving.QueueSideCarMaxRequestBodySizeAnnotation] = "10Mi"
+			}),
+			withQueueEnv(deploy(t, "foo", "max-body",
+				WithRevisionAnn(serving.QueueSideCarMaxRequestBodySizeAnnotation, "10Mi")),
+				"MAX_REQUEST_BODY_SIZE", "10485760"),
+			withAnnotation(image("foo", "max-body"),
+				serving.QueueSideCarMaxRequestBodySizeAnnotation, "10Mi"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "max-body",
+				WithRevisionAnn(serving.QueueSideCarMaxRequestBodySizeAnnotation, "10Mi"),
+				WithLogURL, allUnknownConditions, MarkDeploying("Deploying"), WithK8sServiceName,
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/max-body",
+	}, {
+		Name: "surface selector mismatch",
+		// Test that pods of the revision which lost the labels the deployment
+		// selects on are surfaced on the revision.
+		Objects: []runtime.Object{
+			Revision("foo", "selector-mismatch",
+				WithK8sServiceName, WithLogURL, allUnknownConditions, MarkActive),
+			pa("foo", "selector-mismatch"), // PA can't be ready, since no traffic.
+			pod(t, "foo", "selector-mismatch", func(pod *corev1.Pod) {
+				delete(pod.Labels, serving.RevisionUID)
+			}),
+			deploy(t, "foo", "selector-mismatch"),
+			image("foo", "selector-mismatch"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "selector-mismatch", WithK8sServiceName,
+				WithLogURL, allUnknownConditions,
+				MarkResourcesUnavailable(v1.ReasonSelectorMismatch,
+					`Pods of the revision are not selected by Deployment "selector-mismatch-deployment"`),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		WantUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: pa("foo", "selector-mismatch", WithReachabilityUnreachable),
+		}},
+		Key: "foo/selector-mismatch",
+	}, {
+		Name: "selector mismatch not overridden by ready pa",
+		// Test that a ready PA, e.g. left over from before the labels of the pods
+		// drifted, doesn't mark the resources of the revision available again.
+		Objects: []runtime.Object{
+			Revision("foo", "selector-mismatch-ready-pa",
+				WithK8sServiceName, WithLogURL, MarkRevisionReady,
+				WithRoutingState(v1.RoutingStateActive, fc)),
+			pa("foo", "selector-mismatch-ready-pa", WithTraffic, WithPASKSReady,
+				WithScaleTargetInitialized, WithReachabilityReachable,
+				WithPAStatusService("selector-mismatch-ready-pa")),
+			pod(t, "foo", "selector-mismatch-ready-pa", func(pod *corev1.Pod) {
+				delete(pod.Labels, serving.RevisionUID)
+			}),
+			deploy(t, "foo", "selector-mismatch-ready-pa"),
+			image("foo", "selector-mismatch-ready-pa"),
+		},
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: Revision("foo", "selector-mismatch-ready-pa", WithK8sServiceName,
+				WithLogURL, MarkRevisionReady, WithRoutingState(v1.RoutingStateActive, fc),
+				MarkResourcesUnavailable(v1.ReasonSelectorMismatch,
+					`Pods of the revision are not selected by Deployment "selector-mismatch-ready-pa-deployment"`),
+				withDefaultContainerStatuses(), withQueueProxyImage, withCurrentTarget, WithRevisionObservedGeneration(1)),
+		}},
+		Key: "foo/selector-mismatch-ready-pa",
 	}}
 
 	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, cmw configmap.Watcher) controller.Reconciler {
@@ -644,7 +1739,13 @@ func TestReconcile(t *testing.T) {
 			podAutoscalerLister: listers.GetPodAutoscalerLister(),
 			imageLister:         listers.GetImageLister(),
 			deploymentLister:    listers.GetDeploymentLister(),
+			pdbLister:           listers.GetPodDisruptionBudgetLister(),
+			networkPolicyLister: listers.GetNetworkPolicyLister(),
+			serviceLister:       listers.GetK8sServiceLister(),
+			configMapLister:     listers.GetConfigMapLister(),
+			secretLister:        listers.GetSecretLister(),
 			resolver:            &nopResolver{},
+			tracker:             ctx.Value(TrackerKey).(tracker.Interface),
 		}
 
 		return revisionreconciler.NewReconciler(ctx, logging.FromContext(ctx), servingclient.Get(ctx),
@@ -657,6 +1758,27 @@ func TestReconcile(t *testing.T) {
 	}))
 }
 
+var dedicatedToleration = corev1.Toleration{
+	Key:      "dedicated",
+	Operator: corev1.TolerationOpEqual,
+	Value:    "gpu",
+	Effect:   corev1.TaintEffectNoSchedule,
+}
+
+// configContext returns a context that makes testConfigStore apply opt to the
+// test config for a single table row.
+func configContext(opt configOption) context.Context {
+	return context.WithValue(context.Background(), configOptionKey{}, opt)
+}
+
+type configOptionKey struct{}
+
+func tolerationsEnabledContext() context.Context {
+	cfg := defaultconfig.FromContextOrDefaults(context.Background())
+	cfg.Features.PodSpecTolerations = defaultconfig.Enabled
+	return defaultconfig.ToContext(context.Background(), cfg)
+}
+
 func readyDeploy(deploy *appsv1.Deployment) *appsv1.Deployment {
 	deploy.Status.Conditions = []appsv1.DeploymentCondition{{
 		Type:   appsv1.DeploymentProgressing,
@@ -704,6 +1826,95 @@ func imagePullSecrets(Revision *caching.Image, secretName string) *caching.Image
 	return Revision
 }
 
+func withAnnotation(img *caching.Image, key, value string) *caching.Image {
+	img.Annotations[key] = value
+	return img
+}
+
+func withQueueEnv(d *appsv1.Deployment, name, value string) *appsv1.Deployment {
+	for i, c := range d.Spec.Template.Spec.Containers {
+		if c.Name != resources.QueueContainerName {
+			continue
+		}
+		env := c.Env[:0:0]
+		for _, e := range c.Env {
+			if e.Name != name {
+				env = append(env, e)
+			}
+		}
+		d.Spec.Template.Spec.Containers[i].Env = append(env, corev1.EnvVar{Name: name, Value: value})
+	}
+	return d
+}
+
+func withOldQueueProxy(d *appsv1.Deployment) *appsv1.Deployment {
+	for i, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == resources.QueueContainerName {
+			d.Spec.Template.Spec.Containers[i].Image = "old-queue"
+		}
+	}
+	return d
+}
+
+func withQueueProxyImage(r *v1.Revision) {
+	r.Status.QueueProxyImage = testQueueImage
+}
+
+func withCurrentTarget(r *v1.Revision) {
+	r.Status.CurrentTarget = "70"
+}
+
+func withMinReplicas(n int32) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MinReplicas = n
+	}
+}
+
+func withImageFailed(img *caching.Image, reason, message string) *caching.Image {
+	img.Status.Conditions = duckv1.Conditions{{
+		Type:    apis.ConditionReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}}
+	return img
+}
+
+func withImageReady(img *caching.Image) *caching.Image {
+	img.Status.Conditions = duckv1.Conditions{{
+		Type:   apis.ConditionReady,
+		Status: corev1.ConditionTrue,
+	}}
+	return img
+}
+
+func withImageDigest(img *caching.Image, digest string) *caching.Image {
+	img.Spec.Image = digest
+	return img
+}
+
+func withQueueReadiness(d *appsv1.Deployment, failureThreshold, periodSeconds int32) *appsv1.Deployment {
+	for i, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == resources.QueueContainerName {
+			probe := c.ReadinessProbe.DeepCopy()
+			probe.FailureThreshold = failureThreshold
+			probe.PeriodSeconds = periodSeconds
+			d.Spec.Template.Spec.Containers[i].ReadinessProbe = probe
+		}
+	}
+	return d
+}
+
+func withTopologySpread(d *appsv1.Deployment, key string) *appsv1.Deployment {
+	d.Spec.Template.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+		MaxSkew:           1,
+		TopologyKey:       key,
+		WhenUnsatisfiable: corev1.ScheduleAnyway,
+		LabelSelector:     d.Spec.Selector,
+	}}
+	return d
+}
+
 func changeContainers(deploy *appsv1.Deployment) *appsv1.Deployment {
 	podSpec := deploy.Spec.Template.Spec
 	for i := range podSpec.Containers {
@@ -767,6 +1978,119 @@ func image(namespace, name string, co ...configOption) *caching.Image {
 	return resources.MakeImageCache(Revision(namespace, name), name, "")
 }
 
+func pdb(namespace, name string, ro ...RevisionOption) *policyv1beta1.PodDisruptionBudget {
+	return resources.MakePDB(Revision(namespace, name, ro...))
+}
+
+func withMaxUnavailable(pdb *policyv1beta1.PodDisruptionBudget, max int) *policyv1beta1.PodDisruptionBudget {
+	maxUnavailable := intstr.FromInt(max)
+	pdb.Spec.MaxUnavailable = &maxUnavailable
+	return pdb
+}
+
+func sidecarImage(namespace, name string) *caching.Image {
+	return resources.MakeImageCache(Revision(namespace, name, withSidecar()), "sidecar", "")
+}
+
+func withSidecar() RevisionOption {
+	return func(r *v1.Revision) {
+		r.Spec.Containers[0].Ports = []corev1.ContainerPort{{
+			ContainerPort: 8888,
+		}}
+		r.Spec.Containers = append(r.Spec.Containers, corev1.Container{
+			Name:  "sidecar",
+			Image: "busybox-sidecar",
+		})
+	}
+}
+
+func withEnvFromSecret(name string, optional bool) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Spec.Containers[0].EnvFrom = append(r.Spec.Containers[0].EnvFrom, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Optional:             &optional,
+			},
+		})
+	}
+}
+
+func withEnvFromConfigMapKey(name, key string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Spec.Containers[0].Env = append(r.Spec.Containers[0].Env, corev1.EnvVar{
+			Name: "FROM_CONFIG_MAP",
+			ValueFrom: &corev1.EnvVarSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name},
+					Key:                  key,
+				},
+			},
+		})
+	}
+}
+
+func withLivenessProbe() RevisionOption {
+	return func(r *v1.Revision) {
+		r.Spec.Containers[0].LivenessProbe = &corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"},
+			},
+		}
+	}
+}
+
+func secret(namespace, name string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{serving.RevisionReferenceLabelKey: "true"},
+		},
+	}
+}
+
+func withNetworkPolicies(cfg *config.Config) {
+	cfg.Deployment.EnableNetworkPolicy = true
+	cfg.Deployment.NetworkPolicyIngressNamespaces = sets.NewString("kourier-system")
+}
+
+func networkPolicy(namespace, name string, ro ...RevisionOption) *networkingv1.NetworkPolicy {
+	cfg := reconcilerTestConfig()
+	withNetworkPolicies(cfg)
+	return resources.MakeNetworkPolicy(Revision(namespace, name, ro...), cfg)
+}
+
+func withoutIngressRules(np *networkingv1.NetworkPolicy) *networkingv1.NetworkPolicy {
+	np.Spec.Ingress = nil
+	return np
+}
+
+func withHeadlessServices(cfg *config.Config) {
+	cfg.Deployment.EnableHeadlessService = true
+}
+
+func headlessService(namespace, name string, ro ...RevisionOption) *corev1.Service {
+	return resources.MakeHeadlessService(Revision(namespace, name, ro...))
+}
+
+func withoutSelector(svc *corev1.Service) *corev1.Service {
+	svc.Spec.Selector = nil
+	return svc
+}
+
+func withNotReadyAddresses(svc *corev1.Service) *corev1.Service {
+	svc.Spec.PublishNotReadyAddresses = true
+	return svc
+}
+
+func withSidecarContainerStatus() RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.ContainerStatuses = append(r.Status.ContainerStatuses, v1.ContainerStatus{
+			Name: "sidecar",
+		})
+	}
+}
+
 func pa(namespace, name string, ko ...PodAutoscalerOption) *autoscalingv1alpha1.PodAutoscaler {
 	rev := Revision(namespace, name)
 	k := resources.MakePA(rev)
@@ -800,6 +2124,11 @@ type testConfigStore struct {
 }
 
 func (t *testConfigStore) ToContext(ctx context.Context) context.Context {
+	if opt, ok := ctx.Value(configOptionKey{}).(configOption); ok {
+		cfg := reconcilerTestConfig()
+		opt(cfg)
+		return config.ToContext(ctx, cfg)
+	}
 	return config.ToContext(ctx, t.config)
 }
 
@@ -810,7 +2139,11 @@ func reconcilerTestConfig() *config.Config {
 		Config: &defaultconfig.Config{
 			Defaults: &defaultconfig.Defaults{},
 			Autoscaler: &autoscalerconfig.Config{
-				InitialScale: 1,
+				InitialScale:                       1,
+				ContainerConcurrencyTargetDefault:  100,
+				ContainerConcurrencyTargetFraction: 0.7,
+				RPSTargetDefault:                   200,
+				TargetUtilization:                  0.7,
 			},
 			Features: &defaultconfig.Features{},
 		},
@@ -117,13 +117,13 @@ func MakeFactory(ctor Ctor) rtesting.Factory {
 		}
 
 		// Validate all Create operations through the serving client.
+		// The row's context is used, so that rows can enable feature flags
+		// for the validation via config.ToContext.
 		client.PrependReactor("create", "*", func(action ktesting.Action) (handled bool, ret runtime.Object, err error) {
-			// TODO(n3wscott): context.Background is the best we can do at the moment, but it should be set-able.
-			return rtesting.ValidateCreates(context.Background(), action)
+			return rtesting.ValidateCreates(ctx, action)
 		})
 		client.PrependReactor("update", "*", func(action ktesting.Action) (handled bool, ret runtime.Object, err error) {
-			// TODO(n3wscott): context.Background is the best we can do at the moment, but it should be set-able.
-			return rtesting.ValidateUpdates(context.Background(), action)
+			return rtesting.ValidateUpdates(ctx, action)
 		})
 
 		actionRecorderList := rtesting.ActionRecorderList{dynamicClient, client, netclient, kubeClient, cachingClient}
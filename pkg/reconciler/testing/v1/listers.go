@@ -20,11 +20,15 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	fakekubeclientset "k8s.io/client-go/kubernetes/fake"
 	appsv1listers "k8s.io/client-go/listers/apps/v1"
 	autoscalingv2beta1listers "k8s.io/client-go/listers/autoscaling/v2beta1"
 	corev1listers "k8s.io/client-go/listers/core/v1"
+	networkingv1listers "k8s.io/client-go/listers/networking/v1"
+	policyv1beta1listers "k8s.io/client-go/listers/policy/v1beta1"
 	"k8s.io/client-go/tools/cache"
 	cachingv1alpha1 "knative.dev/caching/pkg/apis/caching/v1alpha1"
 	fakecachingclientset "knative.dev/caching/pkg/client/clientset/versioned/fake"
@@ -183,6 +187,16 @@ func (l *Listers) GetDeploymentLister() appsv1listers.DeploymentLister {
 	return appsv1listers.NewDeploymentLister(l.IndexerFor(&appsv1.Deployment{}))
 }
 
+// GetPodDisruptionBudgetLister returns a lister for PodDisruptionBudget objects.
+func (l *Listers) GetPodDisruptionBudgetLister() policyv1beta1listers.PodDisruptionBudgetLister {
+	return policyv1beta1listers.NewPodDisruptionBudgetLister(l.IndexerFor(&policyv1beta1.PodDisruptionBudget{}))
+}
+
+// GetNetworkPolicyLister returns a lister for NetworkPolicy objects.
+func (l *Listers) GetNetworkPolicyLister() networkingv1listers.NetworkPolicyLister {
+	return networkingv1listers.NewNetworkPolicyLister(l.IndexerFor(&networkingv1.NetworkPolicy{}))
+}
+
 // GetK8sServiceLister returns a lister for K8sService objects.
 func (l *Listers) GetK8sServiceLister() corev1listers.ServiceLister {
 	return corev1listers.NewServiceLister(l.IndexerFor(&corev1.Service{}))
@@ -198,6 +212,16 @@ func (l *Listers) GetPodsLister() corev1listers.PodLister {
 	return corev1listers.NewPodLister(l.IndexerFor(&corev1.Pod{}))
 }
 
+// GetConfigMapLister gets lister for ConfigMap resource.
+func (l *Listers) GetConfigMapLister() corev1listers.ConfigMapLister {
+	return corev1listers.NewConfigMapLister(l.IndexerFor(&corev1.ConfigMap{}))
+}
+
+// GetSecretLister gets lister for Secret resource.
+func (l *Listers) GetSecretLister() corev1listers.SecretLister {
+	return corev1listers.NewSecretLister(l.IndexerFor(&corev1.Secret{}))
+}
+
 // GetNamespaceLister gets lister for Namespace resource.
 func (l *Listers) GetNamespaceLister() corev1listers.NamespaceLister {
 	return corev1listers.NewNamespaceLister(l.IndexerFor(&corev1.Namespace{}))
@@ -26,6 +26,7 @@ import (
 
 	"knative.dev/networking/pkg/apis/networking"
 	netv1alpha1 "knative.dev/networking/pkg/apis/networking/v1alpha1"
+	"knative.dev/pkg/ptr"
 	"knative.dev/serving/pkg/apis/autoscaling"
 	autoscalingv1alpha1 "knative.dev/serving/pkg/apis/autoscaling/v1alpha1"
 	"knative.dev/serving/pkg/reconciler/serverlessservice/resources/names"
@@ -110,6 +111,14 @@ func WithPAStatusService(svc string) PodAutoscalerOption {
 	}
 }
 
+// WithPAScale sets the desired and actual scale in the PA Status.
+func WithPAScale(desired, actual int32) PodAutoscalerOption {
+	return func(pa *autoscalingv1alpha1.PodAutoscaler) {
+		pa.Status.DesiredScale = ptr.Int32(desired)
+		pa.Status.ActualScale = ptr.Int32(actual)
+	}
+}
+
 // WithPAMetricsService annotates PA Status with the provided service name.
 func WithPAMetricsService(svc string) PodAutoscalerOption {
 	return func(pa *autoscalingv1alpha1.PodAutoscaler) {
@@ -303,6 +312,23 @@ func WithFailingContainer(name string, exitCode int, message string) PodOption {
 	}
 }
 
+// WithRestartingContainer sets the .Status.ContainerStatuses on the pod to
+// include a container named accordingly, which was killed and restarted the
+// given number of times.
+func WithRestartingContainer(name string, restarts int32) PodOption {
+	return func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:         name,
+			RestartCount: restarts,
+			LastTerminationState: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: 137,
+				},
+			},
+		}}
+	}
+}
+
 // WithUnschedulableContainer sets the .Status.Conditions on the pod to
 // include `PodScheduled` status to `False` with the given message and reason.
 func WithUnschedulableContainer(reason, message string) PodOption {
@@ -332,6 +358,39 @@ func WithWaitingContainer(name, reason, message string) PodOption {
 	}
 }
 
+// WithUnreadyContainer sets the .Status.ContainerStatuses on the pod to
+// include a container named accordingly that is running and has passed its
+// startup probe since the given time without being ready, and sets the pod's
+// Ready condition to `False` with the given message.
+func WithUnreadyContainer(name string, startedAt time.Time, message string) PodOption {
+	return withUnstartedOrUnreadyContainer(name, startedAt, true, message)
+}
+
+// WithStartingContainer is like WithUnreadyContainer, but the container has
+// not passed its startup probe yet.
+func WithStartingContainer(name string, startedAt time.Time, message string) PodOption {
+	return withUnstartedOrUnreadyContainer(name, startedAt, false, message)
+}
+
+func withUnstartedOrUnreadyContainer(name string, startedAt time.Time, started bool, message string) PodOption {
+	return func(pod *corev1.Pod) {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:    name,
+			Started: ptr.Bool(started),
+			State: corev1.ContainerState{
+				Running: &corev1.ContainerStateRunning{
+					StartedAt: metav1.NewTime(startedAt),
+				},
+			},
+		}}
+		pod.Status.Conditions = []corev1.PodCondition{{
+			Type:    corev1.PodReady,
+			Status:  corev1.ConditionFalse,
+			Message: message,
+		}}
+	}
+}
+
 // IngressOption enables further configuration of the Ingress.
 type IngressOption func(*netv1alpha1.Ingress)
 
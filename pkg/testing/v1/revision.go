@@ -24,6 +24,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/clock"
 	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/ptr"
 	"knative.dev/serving/pkg/apis/serving"
 	v1 "knative.dev/serving/pkg/apis/serving/v1"
 )
@@ -125,6 +126,13 @@ func WithImagePullSecrets(secretName string) RevisionOption {
 	}
 }
 
+// WithTolerations sets the tolerations on the Revision's pod spec.
+func WithTolerations(tolerations ...corev1.Toleration) RevisionOption {
+	return func(rev *v1.Revision) {
+		rev.Spec.Tolerations = tolerations
+	}
+}
+
 // MarkActive calls .Status.MarkActive on the Revision.
 func MarkActive(r *v1.Revision) {
 	r.Status.MarkActiveTrue()
@@ -149,6 +157,18 @@ func MarkActivating(reason, message string) RevisionOption {
 	}
 }
 
+// MarkImageCached calls .Status.MarkImageCachedTrue on the Revision.
+func MarkImageCached(r *v1.Revision) {
+	r.Status.MarkImageCachedTrue()
+}
+
+// MarkImageNotCached calls .Status.MarkImageCachedFalse on the Revision.
+func MarkImageNotCached(reason, message string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkImageCachedFalse(reason, message)
+	}
+}
+
 // MarkDeploying calls .Status.MarkDeploying on the Revision.
 func MarkDeploying(reason string) RevisionOption {
 	return func(r *v1.Revision) {
@@ -173,6 +193,30 @@ func MarkContainerMissing(rev *v1.Revision) {
 	rev.Status.MarkContainerHealthyFalse(v1.ReasonContainerMissing, "It's the end of the world as we know it")
 }
 
+// MarkMissingConfiguration calls .Status.MarkContainerHealthyFalse on the
+// Revision with the MissingConfiguration reason.
+func MarkMissingConfiguration(kind, name string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyFalse(v1.ReasonMissingConfiguration, v1.RevisionConfigurationMissingMessage(kind, name))
+	}
+}
+
+// MarkMissingPullSecret calls .Status.MarkContainerHealthyFalse on the
+// Revision with the MissingPullSecret reason.
+func MarkMissingPullSecret(name string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyFalse(v1.ReasonMissingPullSecret, v1.RevisionPullSecretMissingMessage(name))
+	}
+}
+
+// MarkContainerHealthyUnknown calls .Status.MarkContainerHealthyUnknown on
+// the Revision.
+func MarkContainerHealthyUnknown(reason string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyUnknown(reason, "")
+	}
+}
+
 // MarkContainerExiting calls .Status.MarkContainerExiting on the Revision.
 func MarkContainerExiting(exitCode int32, message string) RevisionOption {
 	return func(r *v1.Revision) {
@@ -180,6 +224,39 @@ func MarkContainerExiting(exitCode int32, message string) RevisionOption {
 	}
 }
 
+// MarkImagePullBackOff calls .Status.MarkContainerHealthyFalse on the Revision
+// with the ImagePullBackOff reason.
+func MarkImagePullBackOff(image, message string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyFalse(v1.ReasonImagePullBackOff, v1.RevisionContainerMissingMessage(image, message))
+	}
+}
+
+// MarkSidecarNotReady calls .Status.MarkContainerHealthyFalse on the Revision
+// with the SidecarNotReady reason.
+func MarkSidecarNotReady(container, message string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyFalse(v1.ReasonSidecarNotReady, v1.RevisionSidecarNotReadyMessage(container, message))
+	}
+}
+
+// MarkRestartLoop calls .Status.MarkContainerHealthyFalse on the Revision
+// with the RestartLoop reason.
+func MarkRestartLoop(container string, restarts int32) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyFalse(v1.ReasonRestartLoop,
+			v1.RevisionContainerRestartingMessage(container, restarts))
+	}
+}
+
+// MarkContainerProbeFailed calls .Status.MarkContainerHealthyFalse on the Revision
+// with the ProbeFailed reason.
+func MarkContainerProbeFailed(message string) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.MarkContainerHealthyFalse(v1.ReasonProbeFailed, v1.RevisionContainerProbeFailedMessage(message))
+	}
+}
+
 // MarkResourcesUnavailable calls .Status.MarkResourcesUnavailable on the Revision.
 func MarkResourcesUnavailable(reason, message string) RevisionOption {
 	return func(r *v1.Revision) {
@@ -217,6 +294,15 @@ func WithContainerStatuses(containerStatus []v1.ContainerStatus) RevisionOption
 	}
 }
 
+// WithRevisionReplicas sets the desired and actual replicas in the
+// revision status.
+func WithRevisionReplicas(desired, actual int32) RevisionOption {
+	return func(r *v1.Revision) {
+		r.Status.DesiredReplicas = ptr.Int32(desired)
+		r.Status.ActualReplicas = ptr.Int32(actual)
+	}
+}
+
 // WithRevisionObservedGeneration sets the observed generation on the
 // revision status.
 func WithRevisionObservedGeneration(gen int64) RevisionOption {